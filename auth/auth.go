@@ -1,16 +1,154 @@
 package auth
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms. bcrypt hashes use the usual $2a$ format, argon2id ones the PHC
+// string format, so both carry their own parameters and old hashes keep verifying after a change.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// HashParams chooses how new password hashes are made
+type HashParams struct {
+	Algorithm  string `yaml:"algorithm"`
+	BcryptCost int    `yaml:"bcrypt_cost"`
+	// Argon2 parameters as in RFC 9106: passes, memory in KiB and lanes
+	Argon2Time      uint32 `yaml:"argon2_time"`
+	Argon2MemoryKiB uint32 `yaml:"argon2_memory_kib"`
+	Argon2Threads   uint8  `yaml:"argon2_threads"`
+}
+
+// DefaultHashParams is used until SetHashParams is called
+func DefaultHashParams() HashParams {
+	return HashParams{
+		Algorithm:       AlgorithmBcrypt,
+		BcryptCost:      12,
+		Argon2Time:      3,
+		Argon2MemoryKiB: 64 * 1024,
+		Argon2Threads:   4,
+	}
+}
+
+var (
+	hashMu     sync.RWMutex
+	hashParams = DefaultHashParams()
+)
+
+// SetHashParams changes how HashPassword hashes from now on. Existing hashes stay valid and
+// CheckPassword reports them as outdated so they can be replaced at the next login.
+func SetHashParams(params HashParams) {
+	hashMu.Lock()
+	defer hashMu.Unlock()
+	hashParams = params
+}
+
+func currentHashParams() HashParams {
+	hashMu.RLock()
+	defer hashMu.RUnlock()
+	return hashParams
+}
 
 func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
+	params := currentHashParams()
+	switch params.Algorithm {
+	case AlgorithmBcrypt:
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), params.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashedPassword), nil
+	case AlgorithmArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2MemoryKiB, params.Argon2Threads, argon2KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+			params.Argon2MemoryKiB, params.Argon2Time, params.Argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	default:
+		return "", fmt.Errorf("unknown password hashing algorithm %q", params.Algorithm)
+	}
+}
+
+// CheckPassword reports whether providedPassword matches hashedPassword and, when it does,
+// whether the hash was made with other settings than the current ones and should be replaced
+func CheckPassword(hashedPassword, providedPassword string) (match, outdated bool) {
+	params := currentHashParams()
+
+	if strings.HasPrefix(hashedPassword, "$argon2id$") {
+		hash, err := parseArgon2id(hashedPassword)
+		if err != nil {
+			return false, false
+		}
+		key := argon2.IDKey([]byte(providedPassword), hash.salt, hash.time, hash.memory, hash.threads, uint32(len(hash.key)))
+		if subtle.ConstantTimeCompare(key, hash.key) != 1 {
+			return false, false
+		}
+		outdated = params.Algorithm != AlgorithmArgon2id || hash.time != params.Argon2Time ||
+			hash.memory != params.Argon2MemoryKiB || hash.threads != params.Argon2Threads ||
+			len(hash.salt) != argon2SaltLength || len(hash.key) != argon2KeyLength
+		return true, outdated
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(providedPassword)); err != nil {
+		return false, false
 	}
-	return string(hashedPassword), nil
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return true, err != nil || params.Algorithm != AlgorithmBcrypt || cost != params.BcryptCost
 }
 
-func CheckPassword(hashedPassword, providedPassword string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(providedPassword))
-	return err == nil
+type argon2idHash struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2id reads a $argon2id$v=19$m=...,t=...,p=...$salt$key PHC string
+func parseArgon2id(encoded string) (*argon2idHash, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, errors.New("malformed argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, errors.New("unsupported argon2 version")
+	}
+
+	var hash argon2idHash
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &hash.memory, &hash.time, &hash.threads); err != nil {
+		return nil, errors.New("malformed argon2id parameters")
+	}
+	if hash.time == 0 || hash.threads == 0 {
+		return nil, errors.New("malformed argon2id parameters")
+	}
+
+	var err error
+	if hash.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, errors.New("malformed argon2id salt")
+	}
+	if hash.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(hash.key) == 0 {
+		return nil, errors.New("malformed argon2id key")
+	}
+	return &hash, nil
 }
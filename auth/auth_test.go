@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters keep the tests fast, the algorithms behave the same at any cost
+var (
+	testBcrypt = HashParams{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}
+	testArgon2 = HashParams{Algorithm: AlgorithmArgon2id, Argon2Time: 1, Argon2MemoryKiB: 64, Argon2Threads: 1}
+)
+
+func hashWith(t *testing.T, params HashParams, password string) string {
+	t.Helper()
+	SetHashParams(params)
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword with %s: %v", params.Algorithm, err)
+	}
+	return hash
+}
+
+func TestCheckPassword(t *testing.T) {
+	t.Cleanup(func() { SetHashParams(DefaultHashParams()) })
+	const password = "Quiet-Harbor-81"
+
+	bcryptHash := hashWith(t, testBcrypt, password)
+	argon2Hash := hashWith(t, testArgon2, password)
+	strongerBcrypt := testBcrypt
+	strongerBcrypt.BcryptCost++
+	strongerArgon2 := testArgon2
+	strongerArgon2.Argon2Time++
+
+	tests := []struct {
+		name         string
+		current      HashParams
+		hash         string
+		password     string
+		wantMatch    bool
+		wantOutdated bool
+	}{
+		{"bcrypt with current settings", testBcrypt, bcryptHash, password, true, false},
+		{"bcrypt wrong password", testBcrypt, bcryptHash, "Wrong-Harbor-81", false, false},
+		{"bcrypt after cost change", strongerBcrypt, bcryptHash, password, true, true},
+		{"bcrypt after switch to argon2id", testArgon2, bcryptHash, password, true, true},
+		{"argon2id with current settings", testArgon2, argon2Hash, password, true, false},
+		{"argon2id wrong password", testArgon2, argon2Hash, "Wrong-Harbor-81", false, false},
+		{"argon2id after time change", strongerArgon2, argon2Hash, password, true, true},
+		{"argon2id after switch to bcrypt", testBcrypt, argon2Hash, password, true, true},
+		{"empty hash", testBcrypt, "", password, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetHashParams(tt.current)
+			match, outdated := CheckPassword(tt.hash, tt.password)
+			if match != tt.wantMatch || outdated != tt.wantOutdated {
+				t.Fatalf("CheckPassword = (%v, %v), want (%v, %v)", match, outdated, tt.wantMatch, tt.wantOutdated)
+			}
+		})
+	}
+}
+
+func TestHashPasswordFormat(t *testing.T) {
+	t.Cleanup(func() { SetHashParams(DefaultHashParams()) })
+
+	tests := []struct {
+		name   string
+		params HashParams
+		prefix string
+	}{
+		{"bcrypt", testBcrypt, "$2a$04$"},
+		{"argon2id", testArgon2, "$argon2id$v=19$m=64,t=1,p=1$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := hashWith(t, tt.params, "Quiet-Harbor-81")
+			second := hashWith(t, tt.params, "Quiet-Harbor-81")
+			if !strings.HasPrefix(first, tt.prefix) {
+				t.Fatalf("hash %q does not start with %q", first, tt.prefix)
+			}
+			if first == second {
+				t.Fatal("two hashes of the same password are identical, the salt is not random")
+			}
+		})
+	}
+
+	SetHashParams(HashParams{Algorithm: "md5"})
+	if _, err := HashPassword("Quiet-Harbor-81"); err == nil {
+		t.Fatal("HashPassword accepted an unknown algorithm")
+	}
+}
+
+func TestParseArgon2id(t *testing.T) {
+	const salt, key = "c2FsdHNhbHRzYWx0c2FsdA", "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name    string
+		encoded string
+		wantErr bool
+	}{
+		{"valid", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$" + key, false},
+		{"missing key", "$argon2id$v=19$m=65536,t=3,p=4$" + salt, true},
+		{"old version", "$argon2id$v=16$m=65536,t=3,p=4$" + salt + "$" + key, true},
+		{"missing parameters", "$argon2id$v=19$m=65536$" + salt + "$" + key, true},
+		{"zero passes", "$argon2id$v=19$m=65536,t=0,p=4$" + salt + "$" + key, true},
+		{"zero lanes", "$argon2id$v=19$m=65536,t=3,p=0$" + salt + "$" + key, true},
+		{"padded salt", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "==$" + key, true},
+		{"empty key", "$argon2id$v=19$m=65536,t=3,p=4$" + salt + "$", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := parseArgon2id(tt.encoded)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseArgon2id error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (hash.memory != 65536 || hash.time != 3 || hash.threads != 4 || len(hash.salt) != 16) {
+				t.Fatalf("parsed %+v, want m=65536 t=3 p=4 and a 16-byte salt", hash)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memberCardVersion prefixes every card payload so the format can change without misreading old cards
+const memberCardVersion = "SSE1"
+
+var (
+	ErrMemberCardInvalid = errors.New("member card payload is invalid")
+	ErrMemberCardExpired = errors.New("member card payload has expired")
+)
+
+// MemberCardPayload returns the QR payload proving memberID at time now. The payload changes every
+// rotation period, like a TOTP code, so a screenshot of it stops working shortly after it was taken.
+func MemberCardPayload(key []byte, memberID string, now time.Time, rotation time.Duration) string {
+	step := strconv.FormatInt(memberCardStep(now, rotation), 10)
+	return strings.Join([]string{memberCardVersion, memberID, step, Sign(key, "member-card", memberID, step)}, ".")
+}
+
+// VerifyMemberCard checks a payload made by MemberCardPayload and returns its member ID. Payloads of
+// the current and the previous rotation period are accepted so a code that rotates while it is
+// being scanned still works.
+func VerifyMemberCard(key []byte, payload string, now time.Time, rotation time.Duration) (string, error) {
+	parts := strings.Split(strings.TrimSpace(payload), ".")
+	if len(parts) != 4 || parts[0] != memberCardVersion || parts[1] == "" {
+		return "", ErrMemberCardInvalid
+	}
+	memberID, stepText, signature := parts[1], parts[2], parts[3]
+	if !VerifySignature(key, signature, "member-card", memberID, stepText) {
+		return "", ErrMemberCardInvalid
+	}
+
+	step, err := strconv.ParseInt(stepText, 10, 64)
+	if err != nil {
+		return "", ErrMemberCardInvalid
+	}
+	current := memberCardStep(now, rotation)
+	if step > current || step < current-1 {
+		return "", ErrMemberCardExpired
+	}
+	return memberID, nil
+}
+
+// MemberCardRefresh is how long the payload for now stays the current one
+func MemberCardRefresh(now time.Time, rotation time.Duration) time.Duration {
+	return rotation - time.Duration(now.UnixNano()%int64(rotation))
+}
+
+func memberCardStep(now time.Time, rotation time.Duration) int64 {
+	return now.UnixNano() / int64(rotation)
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyMemberCard(t *testing.T) {
+	key := []byte("member-card-test-key")
+	rotation := 30 * time.Second
+	issued := time.Unix(1700000010, 0)
+	payload := MemberCardPayload(key, "M-000042", issued, rotation)
+	parts := strings.Split(payload, ".")
+	withPart := func(i int, value string) string {
+		changed := append([]string(nil), parts...)
+		changed[i] = value
+		return strings.Join(changed, ".")
+	}
+
+	tests := []struct {
+		name    string
+		payload string
+		at      time.Time
+		wantErr error
+	}{
+		{"scanned right away", payload, issued, nil},
+		{"scanned with surrounding space", " " + payload + "\n", issued, nil},
+		{"scanned after it rotated once", payload, issued.Add(rotation), nil},
+		{"scanned two rotations later", payload, issued.Add(2 * rotation), ErrMemberCardExpired},
+		{"screenshot from yesterday", payload, issued.Add(24 * time.Hour), ErrMemberCardExpired},
+		{"from a clock running ahead", payload, issued.Add(-rotation), ErrMemberCardExpired},
+		{"signed with another key", MemberCardPayload([]byte("other-key"), "M-000042", issued, rotation), issued, ErrMemberCardInvalid},
+		{"member ID swapped", withPart(1, "M-000043"), issued, ErrMemberCardInvalid},
+		{"step moved forward", withPart(2, "56666668"), issued.Add(2 * rotation), ErrMemberCardInvalid},
+		{"signature altered", withPart(3, parts[3][:len(parts[3])-1]+"A"), issued, ErrMemberCardInvalid},
+		{"unknown version", withPart(0, "SSE2"), issued, ErrMemberCardInvalid},
+		{"missing member ID", withPart(1, ""), issued, ErrMemberCardInvalid},
+		{"plain member ID", "M-000042", issued, ErrMemberCardInvalid},
+	}
+	for _, tt := range tests {
+		memberID, err := VerifyMemberCard(key, tt.payload, tt.at, rotation)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && memberID != "M-000042" {
+			t.Errorf("%s: member ID = %q, want M-000042", tt.name, memberID)
+		}
+	}
+}
+
+func TestMemberCardRefresh(t *testing.T) {
+	rotation := 30 * time.Second
+	start := time.Unix(1700000010, 0)
+	if got := MemberCardRefresh(start, rotation); got != rotation {
+		t.Fatalf("refresh at the start of a period = %v, want %v", got, rotation)
+	}
+	if got := MemberCardRefresh(start.Add(20*time.Second), rotation); got != 10*time.Second {
+		t.Fatalf("refresh 20s into a period = %v, want 10s", got)
+	}
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxPasswordBytes is where bcrypt stops reading, longer passwords would be silently truncated
+const maxPasswordBytes = 72
+
+// minPersonalInfoLength keeps very short names like "Al" from ruling out half of all passwords
+const minPersonalInfoLength = 3
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// PasswordPolicy is the set of rules a new password must satisfy
+type PasswordPolicy struct {
+	MinLength int `yaml:"min_length"`
+	MaxLength int `yaml:"max_length"`
+	// MinCharacterClasses is how many of lowercase, uppercase, digits and symbols must appear
+	MinCharacterClasses int `yaml:"min_character_classes"`
+	// DisallowPersonalInfo rejects passwords containing the member's name or email address
+	DisallowPersonalInfo bool `yaml:"disallow_personal_info"`
+	// CheckBreached rejects passwords found on the built-in list of common passwords and on
+	// BreachedListFile, which holds one password or SHA-1 hash (Pwned Passwords format) per line
+	CheckBreached    bool   `yaml:"check_breached"`
+	BreachedListFile string `yaml:"breached_list_file"`
+}
+
+// DefaultPasswordPolicy is used until SetPasswordPolicy is called
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:            10,
+		MaxLength:            64,
+		MinCharacterClasses:  2,
+		DisallowPersonalInfo: true,
+		CheckBreached:        true,
+	}
+}
+
+var (
+	policyMu          sync.RWMutex
+	passwordPolicy    = DefaultPasswordPolicy()
+	breachedPasswords = loadBreachedList(strings.NewReader(commonPasswords))
+)
+
+// SetPasswordPolicy makes policy the one ValidatePassword enforces and loads its breached list
+func SetPasswordPolicy(policy PasswordPolicy) error {
+	breached := loadBreachedList(strings.NewReader(commonPasswords))
+	if policy.CheckBreached && policy.BreachedListFile != "" {
+		file, err := os.Open(policy.BreachedListFile)
+		if err != nil {
+			return fmt.Errorf("failed to open breached password list: %w", err)
+		}
+		defer file.Close()
+
+		extra := loadBreachedList(file)
+		if extra == nil {
+			return fmt.Errorf("failed to read breached password list %s", policy.BreachedListFile)
+		}
+		for hash := range extra {
+			breached[hash] = struct{}{}
+		}
+	}
+
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	passwordPolicy = policy
+	breachedPasswords = breached
+	return nil
+}
+
+// ValidatePassword checks a new password against the active policy. name and email belong to the
+// account it is for. The error, if any, explains the problem in words meant for the member.
+func ValidatePassword(password, name, email string) error {
+	policyMu.RLock()
+	policy := passwordPolicy
+	breached := breachedPasswords
+	policyMu.RUnlock()
+
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		return fmt.Errorf("Password must be at least %d characters long", policy.MinLength)
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		return fmt.Errorf("Password must be at most %d characters long", policy.MaxLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return errors.New("Password is too long, please use fewer or simpler characters")
+	}
+
+	if characterClasses(password) < policy.MinCharacterClasses {
+		return fmt.Errorf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", policy.MinCharacterClasses)
+	}
+
+	if policy.DisallowPersonalInfo && containsPersonalInfo(password, name, email) {
+		return errors.New("Password must not contain your name or email address")
+	}
+
+	if policy.CheckBreached && isBreached(breached, password) {
+		return errors.New("This password is too common or has appeared in a data breach, please choose another one")
+	}
+	return nil
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+// containsPersonalInfo looks for the name, any word of it, the email or its local part in password
+func containsPersonalInfo(password, name, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	localPart, _, _ := strings.Cut(email, "@")
+
+	candidates := append([]string{strings.ToLower(strings.TrimSpace(name)), email, localPart}, strings.Fields(strings.ToLower(name))...)
+	for _, candidate := range candidates {
+		if utf8.RuneCountInString(candidate) >= minPersonalInfoLength && strings.Contains(password, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBreached matches hashed list entries exactly and plain ones regardless of case
+func isBreached(breached map[string]struct{}, password string) bool {
+	if _, found := breached[passwordHash(password)]; found {
+		return true
+	}
+	_, found := breached[passwordHash(strings.ToLower(password))]
+	return found
+}
+
+// passwordHash is the upper-case hex SHA-1 used by the Pwned Passwords lists
+func passwordHash(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// loadBreachedList reads one entry per line. An entry of 40 hex digits, optionally followed by
+// ":count", is taken as the SHA-1 hash of an exact password and anything else as a plain password
+// matched regardless of case; lines starting with # are comments. It returns nil when the list
+// can't be read.
+func loadBreachedList(list io.Reader) map[string]struct{} {
+	hashes := make(map[string]struct{})
+	scanner := bufio.NewScanner(list)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		hash, _, _ := strings.Cut(line, ":")
+		if len(hash) == sha1.Size*2 {
+			if _, err := hex.DecodeString(hash); err == nil {
+				hashes[strings.ToUpper(hash)] = struct{}{}
+				continue
+			}
+		}
+		hashes[passwordHash(strings.ToLower(line))] = struct{}{}
+	}
+	if scanner.Err() != nil {
+		return nil
+	}
+	return hashes
+}
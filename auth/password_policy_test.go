@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	if err := SetPasswordPolicy(DefaultPasswordPolicy()); err != nil {
+		t.Fatalf("SetPasswordPolicy: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		userName string
+		wantErr  string
+	}{
+		{"strong", "Quiet-Harbor-81", "Annabel Lee", ""},
+		{"too short", "Ab1!xyz", "Annabel Lee", "at least 10 characters"},
+		{"too long", strings.Repeat("Ab1!", 17), "Annabel Lee", "at most 64 characters"},
+		{"multibyte over the bcrypt limit", strings.Repeat("ü", 40) + "A1", "Annabel Lee", "too long"},
+		{"one character class", "correcthorsebattery", "Annabel Lee", "at least 2 of"},
+		{"contains a name", "Annabel-Rowing-7", "Annabel Lee", "name or email"},
+		{"contains a name in other case", "xxANNABELxx-12", "Annabel Lee", "name or email"},
+		{"contains the email local part", "jsmith-rowing-7", "Annabel Lee", "name or email"},
+		{"short names are ignored", "Al-rowing-boat-7", "Al", ""},
+		{"common password", "password123", "Annabel Lee", "too common"},
+		{"common password in other case", "PASSWORD123", "Annabel Lee", "too common"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePassword(tt.password, tt.userName, "jsmith@example.com")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("ValidatePassword(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ValidatePassword(%q) = %v, want an error containing %q", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordBreachedListFile(t *testing.T) {
+	hashed := "Hashed-Entry-42"
+	sum := sha1.Sum([]byte(hashed))
+	list := "# extra entries\n" +
+		strings.ToLower(hex.EncodeToString(sum[:])) + ":1093\n" +
+		"Plain-Entry-42\n"
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatalf("write list: %v", err)
+	}
+
+	policy := DefaultPasswordPolicy()
+	policy.BreachedListFile = path
+	if err := SetPasswordPolicy(policy); err != nil {
+		t.Fatalf("SetPasswordPolicy: %v", err)
+	}
+	t.Cleanup(func() { SetPasswordPolicy(DefaultPasswordPolicy()) })
+
+	tests := []struct {
+		name     string
+		password string
+		breached bool
+	}{
+		{"hashed entry", hashed, true},
+		{"hashed entry matches exactly only", strings.ToUpper(hashed), false},
+		{"plain entry", "Plain-Entry-42", true},
+		{"plain entry in other case", "PLAIN-ENTRY-42", true},
+		{"built-in list still applies", "password123", true},
+		{"not listed", "Quiet-Harbor-81", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidatePassword(tt.password, "Annabel Lee", "jsmith@example.com")
+			if breached := err != nil && strings.Contains(err.Error(), "too common"); breached != tt.breached {
+				t.Fatalf("ValidatePassword(%q) = %v, want breached %v", tt.password, err, tt.breached)
+			}
+		})
+	}
+}
+
+func TestSetPasswordPolicyMissingList(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	policy.BreachedListFile = filepath.Join(t.TempDir(), "missing.txt")
+	if err := SetPasswordPolicy(policy); err == nil {
+		t.Fatal("SetPasswordPolicy accepted a missing breached list")
+	}
+
+	policy.CheckBreached = false
+	if err := SetPasswordPolicy(policy); err != nil {
+		t.Fatalf("SetPasswordPolicy without breach checks = %v, want nil", err)
+	}
+	t.Cleanup(func() { SetPasswordPolicy(DefaultPasswordPolicy()) })
+}
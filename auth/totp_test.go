@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key from RFC 6238 appendix B, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+
+	// the RFC lists 8-digit values, authenticator apps show their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+	key, _ := totpEncoding.DecodeString(rfc6238Secret)
+	codeAt := func(offset int64) string { return totpCode(key, step+offset) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current code", rfc6238Secret, codeAt(0), 0, step, true},
+		{"previous period", rfc6238Secret, codeAt(-1), 0, step - 1, true},
+		{"next period", rfc6238Secret, codeAt(1), 0, step + 1, true},
+		{"two periods old", rfc6238Secret, codeAt(-2), 0, 0, false},
+		{"replayed code", rfc6238Secret, codeAt(0), step, 0, false},
+		{"code older than last used", rfc6238Secret, codeAt(-1), step, 0, false},
+		{"newer code after use", rfc6238Secret, codeAt(1), step, step + 1, true},
+		{"surrounding spaces", rfc6238Secret, " " + codeAt(0) + " ", 0, step, true},
+		{"lowercase secret", strings.ToLower(rfc6238Secret), codeAt(0), 0, step, true},
+		{"wrong code", rfc6238Secret, "000000", 0, 0, false},
+		{"too short", rfc6238Secret, codeAt(0)[:5], 0, 0, false},
+		{"too long", rfc6238Secret, codeAt(0) + "0", 0, 0, false},
+		{"malformed secret", "not base32!", codeAt(0), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := ValidateTOTP(tt.secret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Fatalf("ValidateTOTP = (%d, %v), want (%d, %v)", gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecretValidates(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), now, 0); !ok {
+		t.Fatal("a code for a fresh secret did not validate")
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), recoveryCodeCount)
+	}
+	code, hash := codes[0], hashes[0]
+
+	tests := []struct {
+		name  string
+		typed string
+		match bool
+	}{
+		{"as shown", code, true},
+		{"upper case", strings.ToUpper(code), true},
+		{"without dash", strings.ReplaceAll(code, "-", ""), true},
+		{"with spaces", "  " + code + "\n", true},
+		{"other code", codes[1], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HashRecoveryCode(tt.typed) == hash; got != tt.match {
+				t.Fatalf("HashRecoveryCode(%q) matches = %v, want %v", tt.typed, got, tt.match)
+			}
+		})
+	}
+}
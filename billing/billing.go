@@ -0,0 +1,239 @@
+// Package billing turns confirmed payments into memberships and invoices, and renews the
+// memberships of members who opted in to auto-renew.
+package billing
+
+import (
+	"SSE/config"
+	"SSE/invoices"
+	"SSE/mail"
+	"SSE/membership"
+	"SSE/models"
+	"SSE/payments"
+	"SSE/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Service applies payments reported by the provider, whether they were made by a member or by
+// the renewal scheduler
+type Service struct {
+	cfg      *config.Config
+	store    *store.Store
+	provider payments.Provider
+	mailer   mail.Sender
+	// lifecycle makes every membership status change billing decides on
+	lifecycle *membership.Lifecycle
+	now       func() time.Time
+}
+
+func New(cfg *config.Config, appStore *store.Store, provider payments.Provider, mailer mail.Sender, lifecycle *membership.Lifecycle) *Service {
+	return &Service{
+		cfg:       cfg,
+		store:     appStore,
+		provider:  provider,
+		mailer:    mailer,
+		lifecycle: lifecycle,
+		now:       time.Now,
+	}
+}
+
+// Complete marks a payment succeeded, invoices it and adds its plan to the member's membership.
+// It is called for every report of success, from confirmation, webhooks and the renewal
+// scheduler, and applies the plan exactly once.
+func (s *Service) Complete(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := s.store.Payments.Transition(ctx, id, []models.PaymentStatus{models.PaymentPending, models.PaymentFailed}, models.PaymentSucceeded, ""); err != nil {
+		return err
+	}
+	payment, err := s.store.Payments.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if payment.Status != models.PaymentSucceeded || payment.AppliedAt != nil {
+		return nil
+	}
+
+	user, err := s.store.Users.GetByID(ctx, payment.UserID)
+	if err != nil {
+		return err
+	}
+	if payment.PlanChange != nil && planChangeStale(user, payment.PlanChange, s.now()) {
+		// priced for a plan or period the member no longer has, applying it would underpay
+		return s.refundStalePlanChange(ctx, payment, user)
+	}
+	plan, err := s.store.MembershipPlans.GetByID(ctx, payment.PlanID)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	period := membershipPeriod(user, plan, payment, now)
+	if payment.PlanChange != nil {
+		if period.FromPlan, err = s.store.MembershipPlans.GetByID(ctx, payment.PlanChange.FromPlanID); err != nil {
+			return err
+		}
+	}
+	// invoiced before the plan is applied, so a failure here is retried with the next report of success
+	invoice, err := s.issueInvoice(ctx, payment, user, plan, period, now)
+	if err != nil {
+		return err
+	}
+
+	claimed, err := s.store.Payments.MarkApplied(ctx, id, now)
+	if err != nil || !claimed {
+		return err
+	}
+	if err := s.activateMembership(ctx, user, plan, period, now); err != nil {
+		// release the claim so the next report of success applies the plan
+		if unmarkErr := s.store.Payments.UnmarkApplied(ctx, id); unmarkErr != nil {
+			log.Printf("Failed to release payment %s after activation failed: %v", id.Hex(), unmarkErr)
+		}
+		return err
+	}
+
+	if payment.Renewal {
+		s.notify(ctx, user, "Your Fitness Center membership was renewed", fmt.Sprintf(
+			"Hi %s,\n\nWe charged %s for your %s membership, which now runs until %s. Invoice %s is on your profile page:\n\n%s/profile\n",
+			user.Name, invoices.FormatAmount(payment.Amount, payment.Currency), plan.Name,
+			period.End.Format("January 2, 2006"), invoice.Number, s.cfg.Server.BaseURL))
+	}
+	return nil
+}
+
+// FailureIntentLost is the failure reason of payments whose intent the provider doesn't know,
+// like the fake provider's after a restart
+const FailureIntentLost = "payment_intent_lost"
+
+// Fail records that charging payment failed. Renewal payments are retried on the configured
+// schedule and the member is told about every failure; other payments simply fail.
+func (s *Service) Fail(ctx context.Context, payment *models.Payment, reason string) error {
+	return s.fail(ctx, payment, reason, true)
+}
+
+// Abandon fails payment for good after the provider reported its intent unknown. The intent can
+// never be confirmed, so a renewal isn't retried and is left for the grace period to suspend.
+func (s *Service) Abandon(ctx context.Context, payment *models.Payment) error {
+	return s.fail(ctx, payment, FailureIntentLost, false)
+}
+
+func (s *Service) fail(ctx context.Context, payment *models.Payment, reason string, retry bool) error {
+	if !payment.Renewal {
+		_, err := s.store.Payments.Transition(ctx, payment.ID, []models.PaymentStatus{models.PaymentPending}, models.PaymentFailed, reason)
+		return err
+	}
+
+	user, err := s.store.Users.GetByID(ctx, payment.UserID)
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	graceEnds := user.MembershipExpiry.Add(s.cfg.Renewals.GracePeriod)
+	var next *time.Time
+	if attempt := payment.Attempts + 1; retry && attempt <= len(s.cfg.Renewals.RetryIntervals) {
+		if at := now.Add(s.cfg.Renewals.RetryIntervals[attempt-1]); at.Before(graceEnds) {
+			next = &at
+		}
+	}
+
+	err = s.store.Payments.RecordFailedAttempt(ctx, payment.ID, next, reason)
+	if errors.Is(err, store.ErrNotFound) {
+		// already settled by another report
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	amount := invoices.FormatAmount(payment.Amount, payment.Currency)
+	if next != nil {
+		s.notify(ctx, user, "We couldn't renew your Fitness Center membership", fmt.Sprintf(
+			"Hi %s,\n\nCharging %s to renew your membership failed (%s). We will try again on %s.\n\n"+
+				"To pay with another card, choose your plan again at %s/membership.\n",
+			user.Name, amount, reason, next.Format("January 2, 2006"), s.cfg.Server.BaseURL))
+	} else {
+		s.notify(ctx, user, "Your Fitness Center membership could not be renewed", fmt.Sprintf(
+			"Hi %s,\n\nCharging %s to renew your membership failed (%s) and we won't retry it. "+
+				"Unless you renew at %s/membership, your membership will be suspended on %s.\n",
+			user.Name, amount, reason, s.cfg.Server.BaseURL, graceEnds.Format("January 2, 2006")))
+	}
+	return nil
+}
+
+// membershipPeriod is the time plan bought by payment adds to user's membership. Renewals extend
+// it from its current expiry so no paid days are lost, even when they succeed after the expiry or
+// switch to a scheduled downgrade; so does buying the same plan again early. Upgrades pay for the
+// rest of the current period.
+func membershipPeriod(user *models.User, plan *models.MembershipPlan, payment *models.Payment, now time.Time) invoices.Period {
+	period := invoices.Period{Start: now}
+	if payment.PlanChange != nil {
+		period.End = user.MembershipExpiry
+		return period
+	}
+	samePlan := user.MembershipPlanID == plan.ID
+	if (samePlan && user.IsActiveMemberAt(now)) || (payment.Renewal && !user.MembershipExpiry.IsZero()) {
+		period.Start = user.MembershipExpiry
+		period.Renewal = true
+	}
+	period.End = period.Start.AddDate(0, plan.Duration, 0)
+	return period
+}
+
+// activateMembership gives user plan for period. The join date is only set by the first
+// membership a member buys, later purchases and plan changes keep it.
+func (s *Service) activateMembership(ctx context.Context, user *models.User, plan *models.MembershipPlan, period invoices.Period, now time.Time) error {
+	reason := membership.ReasonPurchase
+	if period.Renewal {
+		reason = membership.ReasonRenewal
+	}
+	if user.MembershipStatus == models.StatusNone || user.MembershipStatus == "" {
+		user.JoinDate = now
+	}
+	user.MembershipExpiry = period.End
+	if period.Renewal && plan.ID != user.MembershipPlanID && period.Start.After(now) {
+		// a downgrade renewed early starts once the period paid for on the current plan is over
+		user.ScheduledPlanID = plan.ID
+		user.ScheduledPlanStart = period.Start
+	} else {
+		user.MembershipPlanID = plan.ID
+		// a purchase, renewal or upgrade replaces any downgrade scheduled before it
+		user.ScheduledPlanID = primitive.NilObjectID
+		user.ScheduledPlanStart = time.Time{}
+	}
+	return s.lifecycle.Change(ctx, user, models.StatusActive, reason, primitive.NilObjectID)
+}
+
+// issueInvoice returns the invoice for payment, issuing it numbered from the counter of the
+// current year the first time
+func (s *Service) issueInvoice(ctx context.Context, payment *models.Payment, user *models.User, plan *models.MembershipPlan, period invoices.Period, now time.Time) (*models.Invoice, error) {
+	invoice, err := s.store.Invoices.GetByPayment(ctx, payment.ID)
+	if !errors.Is(err, store.ErrNotFound) {
+		return invoice, err
+	}
+
+	sequence, err := s.store.Counters.Next(ctx, invoices.CounterName(now.Year()))
+	if err != nil {
+		return nil, err
+	}
+	invoice = s.cfg.Invoices.Build(s.cfg.Invoices.Number(now.Year(), sequence), payment, plan, user, period, now)
+	if err := s.store.Invoices.Create(ctx, invoice); errors.Is(err, store.ErrDuplicate) {
+		// a concurrent report of the same success got there first, its number is the one kept
+		return s.store.Invoices.GetByPayment(ctx, payment.ID)
+	} else if err != nil {
+		return nil, err
+	}
+	log.Printf("Issued invoice %s for payment %s", invoice.Number, payment.ID.Hex())
+	return invoice, nil
+}
+
+// notify emails user, a failure is only logged because the billing change has already been made
+func (s *Service) notify(ctx context.Context, user *models.User, subject, body string) {
+	err := s.mailer.Send(ctx, mail.Message{To: user.Email, Subject: subject, Body: body})
+	if err != nil {
+		log.Printf("Failed to email %s about billing: %v", user.Email, err)
+	}
+}
@@ -0,0 +1,205 @@
+package billing
+
+import (
+	"SSE/config"
+	"SSE/mail"
+	"SSE/membership"
+	"SSE/models"
+	"SSE/payments"
+	"SSE/store"
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordingMailer keeps every message instead of sending it
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *recordingMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages)
+}
+
+// testNow is the time the fixture's service runs at
+var testNow = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// fixture is a billing service on the memory store and the fake provider, frozen at now
+type fixture struct {
+	service  *Service
+	store    *store.Store
+	provider *payments.FakeProvider
+	mailer   *recordingMailer
+	now      time.Time
+	basic    models.MembershipPlan
+	premium  models.MembershipPlan
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Payments.Provider = payments.ProviderFake
+	cfg.Payments.WebhookSecret = "whsec_test"
+	cfg.Payments.Fake.Allowed = true
+
+	f := &fixture{
+		store:    store.NewMemoryStore(),
+		provider: payments.NewFakeProvider(cfg.Payments),
+		mailer:   &recordingMailer{},
+		now:      testNow,
+		basic:    models.MembershipPlan{Name: "Basic", Price: 15000, Duration: 1, IsActive: true},
+		premium:  models.MembershipPlan{Name: "Premium", Price: 30000, Duration: 1, IsActive: true},
+	}
+	plans := []models.MembershipPlan{f.basic, f.premium}
+	if err := f.store.MembershipPlans.CreateMany(context.Background(), plans); err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+	f.basic, f.premium = plans[0], plans[1]
+
+	lifecycle := membership.New(cfg.Memberships, f.store.Users, f.store.MembershipHistory)
+	f.service = New(&cfg, f.store, f.provider, f.mailer, lifecycle)
+	f.service.now = func() time.Time { return f.now }
+	return f
+}
+
+func (f *fixture) createUser(t *testing.T, user models.User) *models.User {
+	t.Helper()
+	if user.Email == "" {
+		user.Email = "member@example.com"
+	}
+	if user.MembershipStatus == "" {
+		user.MembershipStatus = models.StatusNone
+	}
+	if err := f.store.Users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
+	return &user
+}
+
+func (f *fixture) createPayment(t *testing.T, payment models.Payment) *models.Payment {
+	t.Helper()
+	if payment.IdempotencyKey == "" {
+		payment.IdempotencyKey = primitive.NewObjectID().Hex()
+	}
+	if payment.Status == "" {
+		payment.Status = models.PaymentPending
+	}
+	payment.Currency = "KZT"
+	payment.Provider = payments.ProviderFake
+	if err := f.store.Payments.Create(context.Background(), &payment); err != nil {
+		t.Fatalf("Create payment: %v", err)
+	}
+	return &payment
+}
+
+func (f *fixture) user(t *testing.T, id primitive.ObjectID) *models.User {
+	t.Helper()
+	user, err := f.store.Users.GetByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	return user
+}
+
+func TestCompleteAppliesPaymentOnce(t *testing.T) {
+	ctx := context.Background()
+	now := testNow
+	joined := now.AddDate(-1, 0, 0)
+
+	tests := []struct {
+		name       string
+		user       models.User
+		status     models.PaymentStatus
+		wantExpiry time.Time
+		wantJoined time.Time
+	}{
+		{
+			name:       "first purchase",
+			status:     models.PaymentPending,
+			wantExpiry: now.AddDate(0, 1, 0),
+			wantJoined: now,
+		},
+		{
+			name:       "success reported after a failure",
+			status:     models.PaymentFailed,
+			wantExpiry: now.AddDate(0, 1, 0),
+			wantJoined: now,
+		},
+		{
+			name:       "same plan bought before the expiry",
+			user:       models.User{MembershipStatus: models.StatusActive, MembershipExpiry: now.AddDate(0, 0, 10), JoinDate: joined},
+			status:     models.PaymentPending,
+			wantExpiry: now.AddDate(0, 0, 10).AddDate(0, 1, 0),
+			wantJoined: joined,
+		},
+		{
+			name:       "returning after the membership expired",
+			user:       models.User{MembershipStatus: models.StatusExpired, MembershipExpiry: now.AddDate(0, 0, -10), JoinDate: joined},
+			status:     models.PaymentPending,
+			wantExpiry: now.AddDate(0, 1, 0),
+			wantJoined: joined,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			tt.user.MembershipPlanID = f.basic.ID
+			user := f.createUser(t, tt.user)
+			payment := f.createPayment(t, models.Payment{UserID: user.ID, PlanID: f.basic.ID, Amount: 1500000, Status: tt.status})
+
+			// confirmation, the webhook and the scheduler may all report the same success
+			for i := 0; i < 3; i++ {
+				if err := f.service.Complete(ctx, payment.ID); err != nil {
+					t.Fatalf("Complete #%d: %v", i+1, err)
+				}
+			}
+
+			got := f.user(t, user.ID)
+			if got.MembershipStatus != models.StatusActive || got.MembershipPlanID != f.basic.ID {
+				t.Fatalf("membership = %s on %s, want active on Basic", got.MembershipStatus, got.MembershipPlanID.Hex())
+			}
+			if !got.MembershipExpiry.Equal(tt.wantExpiry) {
+				t.Fatalf("expiry = %v, want %v", got.MembershipExpiry, tt.wantExpiry)
+			}
+			if !got.JoinDate.Equal(tt.wantJoined) {
+				t.Fatalf("join date = %v, want %v", got.JoinDate, tt.wantJoined)
+			}
+
+			stored, _ := f.store.Payments.GetByID(ctx, payment.ID)
+			if stored.Status != models.PaymentSucceeded || stored.AppliedAt == nil {
+				t.Fatalf("payment is %s applied at %v, want succeeded and applied", stored.Status, stored.AppliedAt)
+			}
+			issued, _ := f.store.Invoices.ListByUser(ctx, user.ID)
+			if len(issued) != 1 {
+				t.Fatalf("issued %d invoices, want 1", len(issued))
+			}
+		})
+	}
+}
+
+func TestCompleteIgnoresRefundedPayment(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.createUser(t, models.User{})
+	payment := f.createPayment(t, models.Payment{UserID: user.ID, PlanID: f.basic.ID, Amount: 1500000, Status: models.PaymentRefunded})
+
+	if err := f.service.Complete(ctx, payment.ID); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if got := f.user(t, user.ID); got.MembershipStatus != models.StatusNone {
+		t.Fatalf("membership = %s, a refunded payment must not activate it", got.MembershipStatus)
+	}
+}
@@ -0,0 +1,202 @@
+package billing
+
+import (
+	"SSE/invoices"
+	"SSE/membership"
+	"SSE/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Plan change directions
+const (
+	// ChangeUpgrade takes effect right away and is charged for the rest of the current period
+	ChangeUpgrade = "upgrade"
+	// ChangeDowngrade takes effect at the end of the current period, nothing is charged or refunded
+	ChangeDowngrade = "downgrade"
+)
+
+var (
+	// ErrNoMembership is returned for plan changes of members without an active membership, they
+	// buy a plan instead
+	ErrNoMembership = errors.New("membership is not active")
+	ErrSamePlan     = errors.New("membership is already on this plan")
+	// ErrRenewedPlanPending is returned for plan changes of members whose renewal already paid
+	// for a scheduled plan that hasn't started yet
+	ErrRenewedPlanPending = errors.New("membership was renewed on a plan that hasn't started yet")
+	// ErrStalePlanChange is returned for upgrade payments priced for a membership that has since
+	// changed plan or period, or lapsed
+	ErrStalePlanChange = errors.New("membership changed since the upgrade was priced")
+)
+
+// PlanChangeQuote prices moving a membership to another plan, amounts are in minor units
+type PlanChangeQuote struct {
+	Direction string             `json:"direction"`
+	FromPlan  primitive.ObjectID `json:"from_plan_id"`
+	ToPlan    primitive.ObjectID `json:"to_plan_id"`
+	// RemainingDays of the PeriodDays long current period are left
+	RemainingDays int   `json:"remaining_days"`
+	PeriodDays    int   `json:"period_days"`
+	Charge        int64 `json:"charge"`
+	Credit        int64 `json:"credit"`
+	// AmountDue is charged now, it is 0 for downgrades
+	AmountDue int64  `json:"amount_due"`
+	Currency  string `json:"currency"`
+	// EffectiveAt is when the member gets the new plan, PeriodEnd when the current period ends
+	EffectiveAt time.Time `json:"effective_at"`
+	PeriodEnd   time.Time `json:"period_end"`
+	// RenewalAmount is what each renewal costs on the new plan
+	RenewalAmount int64 `json:"renewal_amount"`
+}
+
+// QuotePlanChange prices moving user from their current plan to plan. Upgrades, to a plan costing
+// more per month, are charged the new plan for the whole days left in the current period less
+// the unused part of the current plan; the expiry doesn't move. Other changes are downgrades,
+// scheduled for the expiry.
+func (s *Service) QuotePlanChange(user *models.User, from, to *models.MembershipPlan) (*PlanChangeQuote, error) {
+	now := s.now()
+	if !user.IsActiveMemberAt(now) {
+		return nil, ErrNoMembership
+	}
+	if !user.ScheduledPlanStart.IsZero() {
+		return nil, ErrRenewedPlanPending
+	}
+	if from.ID == to.ID {
+		return nil, ErrSamePlan
+	}
+
+	quote := &PlanChangeQuote{
+		Direction:     ChangeDowngrade,
+		FromPlan:      from.ID,
+		ToPlan:        to.ID,
+		Currency:      s.cfg.Payments.Currency,
+		EffectiveAt:   user.MembershipExpiry,
+		PeriodEnd:     user.MembershipExpiry,
+		RenewalAmount: s.cfg.Invoices.ChargeAmount(to.PriceMinor()),
+	}
+
+	periodStart := user.MembershipExpiry.AddDate(0, -from.Duration, 0)
+	quote.PeriodDays = days(user.MembershipExpiry.Sub(periodStart))
+	// the day that has begun is used up
+	quote.RemainingDays = min(int(user.MembershipExpiry.Sub(now)/(24*time.Hour)), quote.PeriodDays)
+
+	// compared per month so plans of different lengths compare fairly
+	if to.PriceMinor()*int64(from.Duration) <= from.PriceMinor()*int64(to.Duration) {
+		return quote, nil
+	}
+
+	quote.Direction = ChangeUpgrade
+	quote.EffectiveAt = now
+	if quote.PeriodDays > 0 {
+		quote.Credit = prorate(s.cfg.Invoices.ChargeAmount(from.PriceMinor()), quote.RemainingDays, quote.PeriodDays)
+	}
+	// the new plan is priced over a period of its own length starting when the current one did
+	if newPeriodDays := days(periodStart.AddDate(0, to.Duration, 0).Sub(periodStart)); newPeriodDays > 0 {
+		quote.Charge = prorate(quote.RenewalAmount, quote.RemainingDays, newPeriodDays)
+	}
+	quote.AmountDue = max(quote.Charge-quote.Credit, 0)
+	return quote, nil
+}
+
+// ScheduleDowngrade switches user to plan at the end of the current period, when the renewal is
+// charged for it. Scheduling the current plan cancels a scheduled downgrade.
+func (s *Service) ScheduleDowngrade(ctx context.Context, user *models.User, plan *models.MembershipPlan) error {
+	if !user.ScheduledPlanStart.IsZero() {
+		return ErrRenewedPlanPending
+	}
+	user.ScheduledPlanID = plan.ID
+	if plan.ID == user.MembershipPlanID {
+		user.ScheduledPlanID = primitive.NilObjectID
+	}
+	user.UpdatedAt = s.now()
+	return s.store.Users.UpdateMembership(ctx, user, user.MembershipStatus)
+}
+
+// ApplyFreeUpgrade switches user to plan right away when the upgrade quoted nothing to pay,
+// which happens on the last day of a period
+func (s *Service) ApplyFreeUpgrade(ctx context.Context, user *models.User, plan *models.MembershipPlan) error {
+	user.MembershipPlanID = plan.ID
+	user.ScheduledPlanID = primitive.NilObjectID
+	return s.lifecycle.Change(ctx, user, models.StatusActive, membership.ReasonPurchase, primitive.NilObjectID)
+}
+
+// PlanChange is the proration recorded on the payment for the upgrade q quotes
+func (q *PlanChangeQuote) PlanChange() *models.PlanChange {
+	return &models.PlanChange{
+		FromPlanID:    q.FromPlan,
+		RemainingDays: q.RemainingDays,
+		PeriodDays:    q.PeriodDays,
+		Charge:        q.Charge,
+		Credit:        q.Credit,
+		PeriodEnd:     q.PeriodEnd,
+	}
+}
+
+// CheckPlanChange makes sure the membership an upgrade payment was priced for is still the
+// member's before it is charged. A stale one is failed and ErrStalePlanChange returned.
+func (s *Service) CheckPlanChange(ctx context.Context, payment *models.Payment) error {
+	if payment.PlanChange == nil {
+		return nil
+	}
+	user, err := s.store.Users.GetByID(ctx, payment.UserID)
+	if err != nil {
+		return err
+	}
+	if !planChangeStale(user, payment.PlanChange, s.now()) {
+		return nil
+	}
+	if _, err := s.store.Payments.Transition(ctx, payment.ID, []models.PaymentStatus{models.PaymentPending}, models.PaymentFailed, "plan_change_stale"); err != nil {
+		return err
+	}
+	return ErrStalePlanChange
+}
+
+// planChangeStale reports whether user's membership at now is no longer the one change was
+// priced for
+func planChangeStale(user *models.User, change *models.PlanChange, now time.Time) bool {
+	return user.MembershipPlanID != change.FromPlanID ||
+		!user.IsActiveMemberAt(now) ||
+		!user.MembershipExpiry.Equal(change.PeriodEnd)
+}
+
+// refundStalePlanChange returns an upgrade payment that was charged after the membership it was
+// priced for changed, instead of applying it
+func (s *Service) refundStalePlanChange(ctx context.Context, payment *models.Payment, user *models.User) error {
+	amount := payment.Amount - payment.RefundedAmount
+	if amount > 0 {
+		// one key per payment, so reports of the same success never refund twice
+		refund, err := s.provider.Refund(ctx, payment.IntentID, amount, payment.ID.Hex()+":stale")
+		if err != nil {
+			return err
+		}
+		if _, err := s.store.Payments.AddRefund(ctx, payment.ID, models.PaymentRefund{
+			ID:        refund.ID,
+			Amount:    refund.Amount,
+			CreatedAt: s.now(),
+		}); err != nil {
+			return err
+		}
+	}
+	log.Printf("Refunded upgrade payment %s, the membership changed since it was priced", payment.ID.Hex())
+	s.notify(ctx, user, "Your Fitness Center plan change was refunded", fmt.Sprintf(
+		"Hi %s,\n\nYour membership changed before your plan upgrade went through, so we refunded the %s "+
+			"we charged for it. You can price the upgrade again at %s/membership.\n",
+		user.Name, invoices.FormatAmount(payment.Amount, payment.Currency), s.cfg.Server.BaseURL))
+	return nil
+}
+
+// days is d in whole days, rounded so daylight saving changes don't lose one
+func days(d time.Duration) int {
+	return int(math.Round(d.Hours() / 24))
+}
+
+// prorate is the part of amount for used out of total days
+func prorate(amount int64, used, total int) int64 {
+	return int64(math.Round(float64(amount) * float64(used) / float64(total)))
+}
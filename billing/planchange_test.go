@@ -0,0 +1,275 @@
+package billing
+
+import (
+	"SSE/models"
+	"SSE/payments"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProrate(t *testing.T) {
+	tests := []struct {
+		amount      int64
+		used, total int
+		want        int64
+	}{
+		{3000000, 31, 31, 3000000},
+		{3000000, 0, 31, 0},
+		{3000000, 20, 31, 1935484},
+		{1500000, 20, 31, 967742},
+		{100, 1, 3, 33},
+		{200, 1, 3, 67},
+	}
+	for _, tt := range tests {
+		if got := prorate(tt.amount, tt.used, tt.total); got != tt.want {
+			t.Errorf("prorate(%d, %d, %d) = %d, want %d", tt.amount, tt.used, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestDays(t *testing.T) {
+	almaty := time.FixedZone("UTC+5", 5*60*60)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       int
+	}{
+		{"March", time.Date(2030, 3, 20, 12, 0, 0, 0, almaty), time.Date(2030, 4, 20, 12, 0, 0, 0, almaty), 31},
+		{"February", time.Date(2030, 2, 1, 0, 0, 0, 0, almaty), time.Date(2030, 3, 1, 0, 0, 0, 0, almaty), 28},
+		{"across the switch to summer time", time.Date(2030, 3, 20, 0, 0, 0, 0, berlin), time.Date(2030, 4, 20, 0, 0, 0, 0, berlin), 31},
+		{"across the switch to winter time", time.Date(2030, 10, 20, 0, 0, 0, 0, berlin), time.Date(2030, 11, 20, 0, 0, 0, 0, berlin), 31},
+	}
+	for _, tt := range tests {
+		if got := days(tt.end.Sub(tt.start)); got != tt.want {
+			t.Errorf("%s: days = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// planChangeExpiry ends the 31 day period of the planChangeFixture member, who is seen on 2026-03-31
+var planChangeExpiry = time.Date(2026, 4, 20, 12, 0, 0, 0, time.UTC)
+
+// planChangeFixture is a member on Basic with 20 and a half days of their period left
+func planChangeFixture(t *testing.T) (*fixture, *models.User) {
+	t.Helper()
+	f := newFixture(t)
+	f.now = time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	user := f.createUser(t, models.User{
+		MembershipStatus: models.StatusActive,
+		MembershipPlanID: f.basic.ID,
+		MembershipExpiry: planChangeExpiry,
+	})
+	return f, user
+}
+
+func TestQuotePlanChange(t *testing.T) {
+	expiry := planChangeExpiry
+	quarterly := &models.MembershipPlan{ID: primitive.NewObjectID(), Name: "Quarterly", Price: 60000, Duration: 3}
+	annual := &models.MembershipPlan{ID: primitive.NewObjectID(), Name: "Annual", Price: 150000, Duration: 12}
+
+	tests := []struct {
+		name      string
+		now       time.Time
+		status    models.MembershipStatus
+		to        func(f *fixture) *models.MembershipPlan
+		wantErr   error
+		direction string
+		remaining int
+		charge    int64
+		credit    int64
+		due       int64
+	}{
+		{
+			name: "upgrade to a pricier plan", to: func(f *fixture) *models.MembershipPlan { return &f.premium },
+			direction: ChangeUpgrade, remaining: 20, charge: 1935484, credit: 967742, due: 967742,
+		},
+		{
+			name: "upgrade to a longer plan pricier per month", to: func(*fixture) *models.MembershipPlan { return quarterly },
+			direction: ChangeUpgrade, remaining: 20, charge: 1304348, credit: 967742, due: 336606,
+		},
+		{
+			name: "longer plan cheaper per month is a downgrade", to: func(*fixture) *models.MembershipPlan { return annual },
+			direction: ChangeDowngrade, remaining: 20,
+		},
+		{
+			name: "upgrade on the last day is free", now: expiry.Add(-12 * time.Hour), to: func(f *fixture) *models.MembershipPlan { return &f.premium },
+			direction: ChangeUpgrade, remaining: 0,
+		},
+		{
+			name: "same plan", to: func(f *fixture) *models.MembershipPlan { return &f.basic },
+			wantErr: ErrSamePlan,
+		},
+		{
+			name: "no active membership", status: models.StatusExpired, to: func(f *fixture) *models.MembershipPlan { return &f.premium },
+			wantErr: ErrNoMembership,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, user := planChangeFixture(t)
+			if !tt.now.IsZero() {
+				f.now = tt.now
+			}
+			if tt.status != "" {
+				user.MembershipStatus = tt.status
+			}
+			to := tt.to(f)
+
+			quote, err := f.service.QuotePlanChange(user, &f.basic, to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("QuotePlanChange = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if quote.Direction != tt.direction || quote.RemainingDays != tt.remaining || quote.PeriodDays != 31 {
+				t.Fatalf("quote is a %s with %d of %d days left, want a %s with %d of 31", quote.Direction, quote.RemainingDays, quote.PeriodDays, tt.direction, tt.remaining)
+			}
+			if quote.Charge != tt.charge || quote.Credit != tt.credit || quote.AmountDue != tt.due {
+				t.Fatalf("charge %d credit %d due %d, want %d, %d and %d", quote.Charge, quote.Credit, quote.AmountDue, tt.charge, tt.credit, tt.due)
+			}
+			wantEffective := expiry
+			if tt.direction == ChangeUpgrade {
+				wantEffective = f.now
+			}
+			if !quote.EffectiveAt.Equal(wantEffective) || !quote.PeriodEnd.Equal(expiry) {
+				t.Fatalf("effective %v ending %v, want %v ending %v", quote.EffectiveAt, quote.PeriodEnd, wantEffective, expiry)
+			}
+			if want := to.PriceMinor(); quote.RenewalAmount != want {
+				t.Fatalf("renewal amount %d, want %d", quote.RenewalAmount, want)
+			}
+		})
+	}
+}
+
+func TestScheduleDowngrade(t *testing.T) {
+	ctx := context.Background()
+	f, user := planChangeFixture(t)
+
+	steps := []struct {
+		plan *models.MembershipPlan
+		want primitive.ObjectID
+	}{
+		{&f.premium, f.premium.ID},
+		{&f.basic, primitive.NilObjectID},
+	}
+	for _, step := range steps {
+		if err := f.service.ScheduleDowngrade(ctx, user, step.plan); err != nil {
+			t.Fatalf("ScheduleDowngrade(%s): %v", step.plan.Name, err)
+		}
+		stored := f.user(t, user.ID)
+		if stored.ScheduledPlanID != step.want || stored.MembershipPlanID != f.basic.ID {
+			t.Fatalf("after scheduling %s: on %s with %s scheduled, want Basic with %s", step.plan.Name,
+				stored.MembershipPlanID.Hex(), stored.ScheduledPlanID.Hex(), step.want.Hex())
+		}
+	}
+}
+
+// upgradePayment is a charged upgrade from Basic to Premium priced for user's current period
+func upgradePayment(t *testing.T, f *fixture, user *models.User) *models.Payment {
+	t.Helper()
+	ctx := context.Background()
+	quote, err := f.service.QuotePlanChange(user, &f.basic, &f.premium)
+	if err != nil {
+		t.Fatalf("QuotePlanChange: %v", err)
+	}
+	intent, _ := f.provider.CreateIntent(ctx, payments.IntentRequest{Amount: quote.AmountDue, Currency: "KZT"})
+	if _, err := f.provider.Confirm(ctx, intent.ID, payments.FakeMethodSucceed); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+	return f.createPayment(t, models.Payment{
+		UserID:     user.ID,
+		PlanID:     f.premium.ID,
+		Amount:     quote.AmountDue,
+		IntentID:   intent.ID,
+		PlanChange: quote.PlanChange(),
+	})
+}
+
+func TestCompleteUpgrade(t *testing.T) {
+	ctx := context.Background()
+	f, user := planChangeFixture(t)
+	payment := upgradePayment(t, f, user)
+
+	if err := f.service.CheckPlanChange(ctx, payment); err != nil {
+		t.Fatalf("CheckPlanChange: %v", err)
+	}
+	if err := f.service.Complete(ctx, payment.ID); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	stored := f.user(t, user.ID)
+	if stored.MembershipPlanID != f.premium.ID || !stored.MembershipExpiry.Equal(user.MembershipExpiry) {
+		t.Fatalf("on %s until %v, want Premium until the unchanged %v", stored.MembershipPlanID.Hex(), stored.MembershipExpiry, user.MembershipExpiry)
+	}
+	issued, _ := f.store.Invoices.ListByUser(ctx, user.ID)
+	if len(issued) != 1 || issued[0].Kind != models.InvoiceUpgrade || len(issued[0].Lines) != 2 || issued[0].Total != 967742 {
+		t.Fatalf("invoices = %+v, want one upgrade invoice of two lines totalling 967742", issued)
+	}
+}
+
+func TestStalePlanChange(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		change func(f *fixture, user *models.User)
+	}{
+		{"plan changed", func(f *fixture, user *models.User) { user.MembershipPlanID = f.premium.ID }},
+		{"period extended", func(f *fixture, user *models.User) { user.MembershipExpiry = user.MembershipExpiry.AddDate(0, 1, 0) }},
+		{"membership cancelled", func(f *fixture, user *models.User) { user.MembershipStatus = models.StatusCancelled }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" before confirmation", func(t *testing.T) {
+			f, user := planChangeFixture(t)
+			payment := upgradePayment(t, f, user)
+			tt.change(f, user)
+			if err := f.store.Users.Update(ctx, user); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			if err := f.service.CheckPlanChange(ctx, payment); !errors.Is(err, ErrStalePlanChange) {
+				t.Fatalf("CheckPlanChange = %v, want ErrStalePlanChange", err)
+			}
+			if stored, _ := f.store.Payments.GetByID(ctx, payment.ID); stored.Status != models.PaymentFailed {
+				t.Fatalf("payment is %s, want failed", stored.Status)
+			}
+		})
+
+		t.Run(tt.name+" before the charge succeeded", func(t *testing.T) {
+			f, user := planChangeFixture(t)
+			payment := upgradePayment(t, f, user)
+			tt.change(f, user)
+			if err := f.store.Users.Update(ctx, user); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+
+			// a success reported twice refunds once
+			for i := 0; i < 2; i++ {
+				if err := f.service.Complete(ctx, payment.ID); err != nil {
+					t.Fatalf("Complete #%d: %v", i+1, err)
+				}
+			}
+
+			stored, _ := f.store.Payments.GetByID(ctx, payment.ID)
+			if stored.Status != models.PaymentRefunded || stored.RefundedAmount != payment.Amount || len(stored.Refunds) != 1 {
+				t.Fatalf("payment %s with %d refunded in %d refunds, want all %d refunded once", stored.Status, stored.RefundedAmount, len(stored.Refunds), payment.Amount)
+			}
+			if stored.AppliedAt != nil {
+				t.Fatal("stale upgrade was applied")
+			}
+			if got := f.user(t, user.ID); got.MembershipPlanID != user.MembershipPlanID || !got.MembershipExpiry.Equal(user.MembershipExpiry) {
+				t.Fatalf("membership changed to %s until %v", got.MembershipPlanID.Hex(), got.MembershipExpiry)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package billing
+
+import (
+	"SSE/membership"
+	"SSE/models"
+	"SSE/payments"
+	"SSE/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// attemptLease is how long a charge attempt is reserved for the server making it. A charge still
+// processing when it runs out is confirmed again, which providers answer without charging twice.
+const attemptLease = 15 * time.Minute
+
+// Run renews due memberships every renewal interval until ctx is done
+func (s *Service) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.cfg.Renewals.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.RenewDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RenewDue charges every auto-renewing member whose membership expires within the lead time,
+// retries failed charges that are due and suspends members whose renewal is still unpaid when
+// the grace period is over
+func (s *Service) RenewDue(ctx context.Context) {
+	now := s.now()
+	s.startScheduledPlans(ctx, now)
+
+	users, err := s.store.Users.ListAutoRenewing(ctx, now.Add(s.cfg.Renewals.LeadTime))
+	if err != nil {
+		log.Printf("Failed to list memberships due for renewal: %v", err)
+		return
+	}
+
+	for i := range users {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.renew(ctx, &users[i], now); err != nil {
+			log.Printf("Failed to renew membership of %s: %v", users[i].ID.Hex(), err)
+		}
+	}
+}
+
+// startScheduledPlans moves members onto the downgrade their renewal paid for once the period it
+// was paid for begins
+func (s *Service) startScheduledPlans(ctx context.Context, now time.Time) {
+	users, err := s.store.Users.ListScheduledPlansDue(ctx, now)
+	if err != nil {
+		log.Printf("Failed to list scheduled plans due to start: %v", err)
+		return
+	}
+
+	for i := range users {
+		if ctx.Err() != nil {
+			return
+		}
+		user := &users[i]
+		user.MembershipPlanID = user.ScheduledPlanID
+		user.ScheduledPlanID = primitive.NilObjectID
+		user.ScheduledPlanStart = time.Time{}
+		err := s.lifecycle.Change(ctx, user, user.MembershipStatus, membership.ReasonRenewal, primitive.NilObjectID)
+		if errors.Is(err, store.ErrConflict) {
+			// its status changed since it was listed, the next run starts the plan
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to start the scheduled plan of %s: %v", user.ID.Hex(), err)
+		}
+	}
+}
+
+// renewalKey is the idempotency key of the payment renewing user's current membership period, so
+// each period is charged at most once however often the scheduler runs
+func renewalKey(user *models.User) string {
+	return "renewal:" + user.MembershipExpiry.UTC().Format(time.RFC3339)
+}
+
+// Renewable reports whether auto-renew may be turned on for user: their membership is active or
+// lapsed less than the grace period ago, so it is charged before it could be suspended
+func (s *Service) Renewable(user *models.User) bool {
+	switch user.MembershipStatus {
+	case models.StatusActive, models.StatusExpired:
+		return s.now().Before(user.MembershipExpiry.Add(s.cfg.Renewals.GracePeriod))
+	}
+	return false
+}
+
+func (s *Service) renew(ctx context.Context, user *models.User, now time.Time) error {
+	graceEnds := user.MembershipExpiry.Add(s.cfg.Renewals.GracePeriod)
+
+	payment, err := s.store.Payments.GetByIdempotencyKey(ctx, user.ID, renewalKey(user))
+	if errors.Is(err, store.ErrNotFound) {
+		if now.After(graceEnds) {
+			// lapsed before any charge was made, only an unpaid renewal suspends a member
+			return nil
+		}
+		payment, err = s.createRenewal(ctx, user, now)
+		if payment == nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	switch payment.Status {
+	case models.PaymentPending:
+		return s.charge(ctx, user, payment, now)
+	case models.PaymentSucceeded:
+		// applies it if an earlier run was interrupted
+		return s.Complete(ctx, payment.ID)
+	case models.PaymentFailed:
+		if now.After(graceEnds) {
+			return s.suspend(ctx, user)
+		}
+	}
+	return nil
+}
+
+// createRenewal creates the pending payment renewing user's plan. It returns nil when the plan is
+// no longer offered, in which case auto-renew is turned off.
+func (s *Service) createRenewal(ctx context.Context, user *models.User, now time.Time) (*models.Payment, error) {
+	planID := user.MembershipPlanID
+	if !user.ScheduledPlanID.IsZero() {
+		// a scheduled downgrade starts with the renewal
+		planID = user.ScheduledPlanID
+	}
+	plan, err := s.store.MembershipPlans.GetActiveByID(ctx, planID)
+	if errors.Is(err, store.ErrNotFound) {
+		if err := s.store.Users.SetAutoRenew(ctx, user.ID, false, "", now); err != nil {
+			return nil, err
+		}
+		s.notify(ctx, user, "Your Fitness Center membership won't renew automatically", fmt.Sprintf(
+			"Hi %s,\n\nYour membership plan is no longer offered, so we turned off auto-renew. "+
+				"Your membership runs until %s, you can choose a new plan at %s/membership.\n",
+			user.Name, user.MembershipExpiry.Format("January 2, 2006"), s.cfg.Server.BaseURL))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	payment := &models.Payment{
+		UserID:         user.ID,
+		PlanID:         plan.ID,
+		Amount:         s.cfg.Invoices.ChargeAmount(plan.PriceMinor()),
+		Currency:       s.cfg.Payments.Currency,
+		IdempotencyKey: renewalKey(user),
+		Provider:       s.provider.Name(),
+		Status:         models.PaymentPending,
+		Renewal:        true,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.store.Payments.Create(ctx, payment); errors.Is(err, store.ErrDuplicate) {
+		return s.store.Payments.GetByIdempotencyKey(ctx, user.ID, payment.IdempotencyKey)
+	} else if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// charge attempts a pending renewal payment if its next attempt is due
+func (s *Service) charge(ctx context.Context, user *models.User, payment *models.Payment, now time.Time) error {
+	claimed, err := s.store.Payments.ClaimAttempt(ctx, payment.ID, now, now.Add(attemptLease))
+	if err != nil || !claimed {
+		return err
+	}
+
+	if payment.IntentID == "" {
+		intent, err := s.provider.CreateIntent(ctx, payments.IntentRequest{
+			Amount:         payment.Amount,
+			Currency:       payment.Currency,
+			Description:    "Membership renewal",
+			IdempotencyKey: payment.ID.Hex(),
+			Metadata:       map[string]string{"payment_id": payment.ID.Hex(), "user_id": user.ID.Hex()},
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.store.Payments.SetIntent(ctx, payment.ID, intent.ID); err != nil {
+			return err
+		}
+		payment.IntentID = intent.ID
+	}
+
+	// a provider error leaves the attempt claimed, it is made again once the lease runs out
+	intent, err := s.provider.Confirm(ctx, payment.IntentID, user.RenewalMethod)
+	if errors.Is(err, payments.ErrUnknownIntent) {
+		return s.Abandon(ctx, payment)
+	}
+	if err != nil {
+		return err
+	}
+	switch intent.Status {
+	case payments.IntentSucceeded:
+		return s.Complete(ctx, payment.ID)
+	case payments.IntentFailed:
+		return s.Fail(ctx, payment, intent.FailureReason)
+	}
+	// still processing, the provider reports the outcome by webhook
+	return nil
+}
+
+// suspend moves a member whose renewal wasn't paid within the grace period to suspended
+func (s *Service) suspend(ctx context.Context, user *models.User) error {
+	err := s.lifecycle.Change(ctx, user, models.StatusSuspended, membership.ReasonUnpaid, primitive.NilObjectID)
+	if errors.Is(err, store.ErrConflict) {
+		// paid, cancelled or suspended since it was listed
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Suspended membership of %s, its renewal wasn't paid", user.ID.Hex())
+	s.notify(ctx, user, "Your Fitness Center membership is suspended", fmt.Sprintf(
+		"Hi %s,\n\nWe couldn't collect the payment to renew your membership, so it is now suspended. "+
+			"You can reactivate it any time by choosing a plan at %s/membership.\n",
+		user.Name, s.cfg.Server.BaseURL))
+	return nil
+}
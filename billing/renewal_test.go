@@ -0,0 +1,284 @@
+package billing
+
+import (
+	"SSE/membership"
+	"SSE/models"
+	"SSE/payments"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenewDueCharges(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	expiry := f.now.Add(48 * time.Hour)
+	user := f.createUser(t, models.User{
+		MembershipStatus: models.StatusActive,
+		MembershipPlanID: f.basic.ID,
+		MembershipExpiry: expiry,
+		AutoRenew:        true,
+		RenewalMethod:    payments.FakeMethodSucceed,
+	})
+
+	// the second run finds the membership already renewed
+	for i := 0; i < 2; i++ {
+		f.service.RenewDue(ctx)
+	}
+
+	got := f.user(t, user.ID)
+	if want := expiry.AddDate(0, 1, 0); !got.MembershipExpiry.Equal(want) {
+		t.Fatalf("expiry = %v, want %v", got.MembershipExpiry, want)
+	}
+	charged, _ := f.store.Payments.ListByUser(ctx, user.ID)
+	if len(charged) != 1 || !charged[0].Renewal || charged[0].Status != models.PaymentSucceeded || charged[0].Amount != 1500000 {
+		t.Fatalf("payments = %+v, want one succeeded renewal of 1500000", charged)
+	}
+	if f.mailer.count() != 1 {
+		t.Fatalf("sent %d emails, want the renewal receipt", f.mailer.count())
+	}
+}
+
+func TestRenewDueScheduledDowngrade(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	expiry := f.now.Add(48 * time.Hour)
+	user := f.createUser(t, models.User{
+		MembershipStatus: models.StatusActive,
+		MembershipPlanID: f.premium.ID,
+		ScheduledPlanID:  f.basic.ID,
+		MembershipExpiry: expiry,
+		AutoRenew:        true,
+		RenewalMethod:    payments.FakeMethodSucceed,
+	})
+
+	f.service.RenewDue(ctx)
+
+	got := f.user(t, user.ID)
+	if got.MembershipPlanID != f.premium.ID || got.ScheduledPlanID != f.basic.ID || !got.ScheduledPlanStart.Equal(expiry) {
+		t.Fatalf("before the old expiry: on %s with %s from %v, want Premium with Basic from %v",
+			got.MembershipPlanID.Hex(), got.ScheduledPlanID.Hex(), got.ScheduledPlanStart, expiry)
+	}
+	if want := expiry.AddDate(0, f.basic.Duration, 0); !got.MembershipExpiry.Equal(want) {
+		t.Fatalf("expiry = %v, want %v", got.MembershipExpiry, want)
+	}
+	charged, _ := f.store.Payments.ListByUser(ctx, user.ID)
+	if len(charged) != 1 || charged[0].PlanID != f.basic.ID || charged[0].Amount != 1500000 {
+		t.Fatalf("payments = %+v, want one renewal charging Basic", charged)
+	}
+	if _, err := f.service.QuotePlanChange(got, &f.premium, &f.basic); !errors.Is(err, ErrRenewedPlanPending) {
+		t.Fatalf("QuotePlanChange = %v, want ErrRenewedPlanPending", err)
+	}
+
+	f.now = expiry.Add(-time.Minute)
+	f.service.RenewDue(ctx)
+	if got := f.user(t, user.ID); got.MembershipPlanID != f.premium.ID {
+		t.Fatalf("a minute before the old expiry: on %s, want Premium", got.MembershipPlanID.Hex())
+	}
+
+	f.now = expiry
+	f.service.RenewDue(ctx)
+	got = f.user(t, user.ID)
+	if got.MembershipPlanID != f.basic.ID || !got.ScheduledPlanID.IsZero() || !got.ScheduledPlanStart.IsZero() || got.MembershipStatus != models.StatusActive {
+		t.Fatalf("at the old expiry: %s on %s with %s scheduled from %v, want active on Basic with nothing scheduled",
+			got.MembershipStatus, got.MembershipPlanID.Hex(), got.ScheduledPlanID.Hex(), got.ScheduledPlanStart)
+	}
+	if charged, _ := f.store.Payments.ListByUser(ctx, user.ID); len(charged) != 1 {
+		t.Fatalf("%d payments, want the one renewal", len(charged))
+	}
+}
+
+func TestRenewDueDunning(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	start := f.now
+	expiry := start.Add(48 * time.Hour)
+	user := f.createUser(t, models.User{
+		MembershipStatus: models.StatusActive,
+		MembershipPlanID: f.basic.ID,
+		MembershipExpiry: expiry,
+		AutoRenew:        true,
+		RenewalMethod:    payments.FakeMethodDecline,
+	})
+
+	// with retries after 1, 2 and 3 days and a 7 day grace period, the runs happen in this order
+	steps := []struct {
+		name          string
+		at            time.Time
+		wantAttempts  int
+		wantPayment   models.PaymentStatus
+		wantMembers   models.MembershipStatus
+		wantMails     int
+		wantLastEmail string
+	}{
+		{"first charge is declined", start, 1, models.PaymentPending, models.StatusActive, 1, "We couldn't renew"},
+		{"retry isn't due yet", start.Add(time.Hour), 1, models.PaymentPending, models.StatusActive, 1, "We couldn't renew"},
+		{"first retry", start.Add(24 * time.Hour), 2, models.PaymentPending, models.StatusActive, 2, "We couldn't renew"},
+		{"second retry", start.Add(72 * time.Hour), 3, models.PaymentPending, models.StatusActive, 3, "We couldn't renew"},
+		{"last retry gives up", start.Add(144 * time.Hour), 4, models.PaymentFailed, models.StatusActive, 4, "could not be renewed"},
+		{"still within the grace period", expiry.Add(6 * 24 * time.Hour), 4, models.PaymentFailed, models.StatusActive, 4, "could not be renewed"},
+		{"grace period is over", expiry.Add(7*24*time.Hour + time.Hour), 4, models.PaymentFailed, models.StatusSuspended, 5, "is suspended"},
+		{"suspended members are left alone", expiry.Add(8 * 24 * time.Hour), 4, models.PaymentFailed, models.StatusSuspended, 5, "is suspended"},
+	}
+	for _, step := range steps {
+		f.now = step.at
+		f.service.RenewDue(ctx)
+
+		charged, _ := f.store.Payments.ListByUser(ctx, user.ID)
+		if len(charged) != 1 {
+			t.Fatalf("%s: %d payments, want the one renewal payment", step.name, len(charged))
+		}
+		if charged[0].Attempts != step.wantAttempts || charged[0].Status != step.wantPayment {
+			t.Fatalf("%s: payment %s after %d attempts, want %s after %d", step.name, charged[0].Status, charged[0].Attempts, step.wantPayment, step.wantAttempts)
+		}
+		if got := f.user(t, user.ID); got.MembershipStatus != step.wantMembers {
+			t.Fatalf("%s: membership %s, want %s", step.name, got.MembershipStatus, step.wantMembers)
+		}
+		if f.mailer.count() != step.wantMails {
+			t.Fatalf("%s: sent %d emails, want %d", step.name, f.mailer.count(), step.wantMails)
+		}
+		if last := f.mailer.messages[len(f.mailer.messages)-1]; !strings.Contains(last.Subject, step.wantLastEmail) {
+			t.Fatalf("%s: last email %q, want one about %q", step.name, last.Subject, step.wantLastEmail)
+		}
+	}
+
+	history, _ := f.store.MembershipHistory.ListByUser(ctx, user.ID)
+	if len(history) != 1 || history[0].To != models.StatusSuspended || history[0].Reason != membership.ReasonUnpaid {
+		t.Fatalf("history = %+v, want one suspension for non-payment", history)
+	}
+}
+
+func TestRenewDueWithoutPayment(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		user          models.User
+		retirePlan    bool
+		wantStatus    models.MembershipStatus
+		wantAutoRenew bool
+		wantPayments  int
+	}{
+		{
+			name:          "plan no longer offered",
+			user:          models.User{MembershipStatus: models.StatusActive, MembershipExpiry: testNow.Add(24 * time.Hour)},
+			retirePlan:    true,
+			wantStatus:    models.StatusActive,
+			wantAutoRenew: false,
+			wantPayments:  0,
+		},
+		{
+			name:          "lapsed past the grace period before any attempt",
+			user:          models.User{MembershipStatus: models.StatusExpired, MembershipExpiry: testNow.AddDate(0, 0, -8)},
+			wantStatus:    models.StatusExpired,
+			wantAutoRenew: true,
+			wantPayments:  0,
+		},
+		{
+			name:          "no membership period to renew yet",
+			user:          models.User{MembershipStatus: models.StatusActive, MembershipExpiry: testNow.AddDate(0, 0, 10)},
+			wantStatus:    models.StatusActive,
+			wantAutoRenew: true,
+			wantPayments:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			if tt.retirePlan {
+				f.store.MembershipPlans.Sync(ctx, []models.MembershipPlan{f.premium})
+			}
+			tt.user.MembershipPlanID = f.basic.ID
+			tt.user.AutoRenew = true
+			tt.user.RenewalMethod = payments.FakeMethodSucceed
+			user := f.createUser(t, tt.user)
+
+			f.service.RenewDue(ctx)
+
+			got := f.user(t, user.ID)
+			if got.MembershipStatus != tt.wantStatus || got.AutoRenew != tt.wantAutoRenew {
+				t.Fatalf("membership %s with auto-renew %v, want %s with %v", got.MembershipStatus, got.AutoRenew, tt.wantStatus, tt.wantAutoRenew)
+			}
+			if charged, _ := f.store.Payments.ListByUser(ctx, user.ID); len(charged) != tt.wantPayments {
+				t.Fatalf("%d payments, want %d", len(charged), tt.wantPayments)
+			}
+		})
+	}
+}
+
+func TestRenewable(t *testing.T) {
+	tests := []struct {
+		name string
+		user models.User
+		want bool
+	}{
+		{"active", models.User{MembershipStatus: models.StatusActive, MembershipExpiry: testNow.AddDate(0, 0, 10)}, true},
+		{"expired within the grace period", models.User{MembershipStatus: models.StatusExpired, MembershipExpiry: testNow.AddDate(0, 0, -6)}, true},
+		{"expired past the grace period", models.User{MembershipStatus: models.StatusExpired, MembershipExpiry: testNow.AddDate(0, 0, -8)}, false},
+		{"suspended", models.User{MembershipStatus: models.StatusSuspended, MembershipExpiry: testNow.AddDate(0, 0, -1)}, false},
+		{"never a member", models.User{MembershipStatus: models.StatusNone}, false},
+	}
+	for _, tt := range tests {
+		f := newFixture(t)
+		if got := f.service.Renewable(&tt.user); got != tt.want {
+			t.Errorf("%s: Renewable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRenewDueIntentLost(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	expiry := f.now.Add(48 * time.Hour)
+	user := f.createUser(t, models.User{
+		MembershipStatus: models.StatusActive,
+		MembershipPlanID: f.basic.ID,
+		MembershipExpiry: expiry,
+		AutoRenew:        true,
+		RenewalMethod:    payments.FakeMethodSucceed,
+	})
+	// an intent created before the provider restarted and forgot it
+	payment := f.createPayment(t, models.Payment{
+		UserID:         user.ID,
+		PlanID:         f.basic.ID,
+		Amount:         15000,
+		IdempotencyKey: renewalKey(user),
+		IntentID:       "pi_fake_lost",
+		Renewal:        true,
+	})
+
+	f.service.RenewDue(ctx)
+	failed, _ := f.store.Payments.GetByID(ctx, payment.ID)
+	if failed.Status != models.PaymentFailed || failed.FailureReason != FailureIntentLost || failed.NextAttemptAt != nil {
+		t.Fatalf("payment %s (%s), next attempt %v, want it failed for good", failed.Status, failed.FailureReason, failed.NextAttemptAt)
+	}
+	if f.mailer.count() != 1 || !strings.Contains(f.mailer.messages[0].Subject, "could not be renewed") {
+		t.Fatalf("sent %d emails, want the one saying the renewal won't be retried", f.mailer.count())
+	}
+
+	f.now = expiry.Add(7*24*time.Hour + time.Hour)
+	f.service.RenewDue(ctx)
+	if got := f.user(t, user.ID); got.MembershipStatus != models.StatusSuspended {
+		t.Fatalf("membership %s after the grace period, want suspended", got.MembershipStatus)
+	}
+}
+
+func TestAbandonPurchase(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	user := f.createUser(t, models.User{})
+	payment := f.createPayment(t, models.Payment{UserID: user.ID, PlanID: f.basic.ID, Amount: 15000, IntentID: "pi_fake_lost"})
+
+	if err := f.service.Abandon(ctx, payment); err != nil {
+		t.Fatalf("Abandon: %v", err)
+	}
+	failed, _ := f.store.Payments.GetByID(ctx, payment.ID)
+	if failed.Status != models.PaymentFailed || failed.FailureReason != FailureIntentLost {
+		t.Fatalf("payment %s (%s), want failed with %s", failed.Status, failed.FailureReason, FailureIntentLost)
+	}
+	if f.mailer.count() != 0 {
+		t.Fatalf("sent %d emails for an abandoned purchase, want none", f.mailer.count())
+	}
+}
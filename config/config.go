@@ -0,0 +1,561 @@
+package config
+
+import (
+	"SSE/auth"
+	"SSE/database"
+	"SSE/invoices"
+	"SSE/mail"
+	"SSE/payments"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is every setting the application reads at startup
+type Config struct {
+	Server      ServerConfig      `yaml:"server"`
+	Session     SessionConfig     `yaml:"session"`
+	Store       StoreConfig       `yaml:"store"`
+	MongoDB     database.Config   `yaml:"mongodb"`
+	Gemini      GeminiConfig      `yaml:"gemini"`
+	Planner     PlannerConfig     `yaml:"planner"`
+	OpenWeather OpenWeatherConfig `yaml:"openweather"`
+	Auth        AuthConfig        `yaml:"auth"`
+	LoginGuard  LoginGuardConfig  `yaml:"login_guard"`
+	OIDC        OIDCConfig        `yaml:"oidc"`
+	CheckIn     CheckInConfig     `yaml:"check_in"`
+	Occupancy   OccupancyConfig   `yaml:"occupancy"`
+	Mail        mail.Config       `yaml:"mail"`
+	Payments    payments.Config   `yaml:"payments"`
+	Invoices    invoices.Config   `yaml:"invoices"`
+	Renewals    RenewalConfig     `yaml:"renewals"`
+	Memberships MembershipConfig  `yaml:"memberships"`
+}
+
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	// BaseURL is the public address used to build links in emails
+	BaseURL         string        `yaml:"base_url"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type SessionConfig struct {
+	Key     string `yaml:"key"`
+	KeyFile string `yaml:"key_file"`
+	// MaxAge is the absolute session lifetime, IdleTimeout ends sessions that go unused
+	MaxAge        time.Duration `yaml:"max_age"`
+	IdleTimeout   time.Duration `yaml:"idle_timeout"`
+	SecureCookies bool          `yaml:"secure_cookies"`
+}
+
+type StoreConfig struct {
+	// Backend is either "mongo" or "memory"
+	Backend string `yaml:"backend"`
+}
+
+type GeminiConfig struct {
+	APIKey     string `yaml:"api_key"`
+	APIKeyFile string `yaml:"api_key_file"`
+	Model      string `yaml:"model"`
+}
+
+type PlannerConfig struct {
+	URL     string        `yaml:"url"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type AuthConfig struct {
+	// SigningKey signs confirmation links, it defaults to the session key when unset
+	SigningKey                 string        `yaml:"signing_key"`
+	SigningKeyFile             string        `yaml:"signing_key_file"`
+	PasswordResetTTL           time.Duration `yaml:"password_reset_ttl"`
+	EmailVerificationTTL       time.Duration `yaml:"email_verification_ttl"`
+	VerificationResendCooldown time.Duration `yaml:"verification_resend_cooldown"`
+	// TOTPIssuer is the account name shown in members' authenticator apps
+	TOTPIssuer      string              `yaml:"totp_issuer"`
+	PasswordPolicy  auth.PasswordPolicy `yaml:"password_policy"`
+	PasswordHashing auth.HashParams     `yaml:"password_hashing"`
+}
+
+type LoginGuardConfig struct {
+	// Window is how long failures are remembered after the most recent one
+	Window  time.Duration  `yaml:"window"`
+	Account ThrottlePolicy `yaml:"account"`
+	IP      ThrottlePolicy `yaml:"ip"`
+}
+
+// ThrottlePolicy allows FreeAttempts failures, then makes each further attempt wait twice as long
+// as the previous one starting at BaseDelay, and locks out after LockoutThreshold failures
+type ThrottlePolicy struct {
+	FreeAttempts int           `yaml:"free_attempts"`
+	BaseDelay    time.Duration `yaml:"base_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+	// LockoutThreshold of 0 disables lockouts
+	LockoutThreshold int           `yaml:"lockout_threshold"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration"`
+}
+
+type CheckInConfig struct {
+	// DuplicateWindow rejects a second check-in of the same member this soon after the first
+	DuplicateWindow time.Duration `yaml:"duplicate_window"`
+	// DefaultLocation is recorded when the front desk doesn't name one
+	DefaultLocation string `yaml:"default_location"`
+	// CardRotation is how often the QR code on a member's card changes. A scanned code is
+	// accepted for up to two rotations, after that a screenshot of it is useless.
+	CardRotation time.Duration `yaml:"card_rotation"`
+}
+
+type OccupancyConfig struct {
+	// AutoCheckOut closes visits of members who never checked out this long after they checked in
+	AutoCheckOut time.Duration `yaml:"auto_check_out"`
+	// RefreshInterval is how often the live counts are reloaded and stale visits closed, changes
+	// made by this server are pushed right away
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// HeatmapWeeks is how much history the hour-of-week heatmap averages over
+	HeatmapWeeks int `yaml:"heatmap_weeks"`
+}
+
+// RenewalConfig controls how memberships of members who opted in to auto-renew are charged
+type RenewalConfig struct {
+	// Interval is how often the scheduler looks for memberships to renew
+	Interval time.Duration `yaml:"interval"`
+	// LeadTime is how long before the expiry the first charge is attempted
+	LeadTime time.Duration `yaml:"lead_time"`
+	// RetryIntervals are the waits after each failed charge, one retry per entry
+	RetryIntervals []time.Duration `yaml:"retry_intervals"`
+	// GracePeriod is how long after the expiry failed renewals are retried before the member is
+	// suspended
+	GracePeriod time.Duration `yaml:"grace_period"`
+}
+
+type MembershipConfig struct {
+	// ExpiryInterval is how often active memberships past their expiry are moved to expired
+	ExpiryInterval time.Duration `yaml:"expiry_interval"`
+}
+
+// OIDCConfig describes the external OpenID Connect identity provider members may sign in with
+type OIDCConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// DisplayName labels the sign-in button, e.g. "Google"
+	DisplayName      string   `yaml:"display_name"`
+	Issuer           string   `yaml:"issuer"`
+	ClientID         string   `yaml:"client_id"`
+	ClientSecret     string   `yaml:"client_secret"`
+	ClientSecretFile string   `yaml:"client_secret_file"`
+	Scopes           []string `yaml:"scopes"`
+	// RedirectURL defaults to server.base_url + /oidc/callback
+	RedirectURL string `yaml:"redirect_url"`
+	// the endpoints are discovered from the issuer, setting them skips discovery
+	AuthorizationURL string `yaml:"authorization_url"`
+	TokenURL         string `yaml:"token_url"`
+	JWKSURL          string `yaml:"jwks_url"`
+	// AllowSignup creates an account for identities that match no existing member
+	AllowSignup bool          `yaml:"allow_signup"`
+	HTTPTimeout time.Duration `yaml:"http_timeout"`
+	// AllowInsecureHTTP permits plain http provider URLs, only meant for a local mock provider
+	AllowInsecureHTTP bool `yaml:"allow_insecure_http"`
+}
+
+type OpenWeatherConfig struct {
+	APIKey     string `yaml:"api_key"`
+	APIKeyFile string `yaml:"api_key_file"`
+}
+
+const (
+	BackendMongo  = "mongo"
+	BackendMemory = "memory"
+
+	minSessionKeyLength = 32
+)
+
+// Default returns the configuration used before the file and environment are applied
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:            ":3000",
+			BaseURL:         "http://localhost:3000",
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Session: SessionConfig{
+			MaxAge:        7 * 24 * time.Hour,
+			IdleTimeout:   12 * time.Hour,
+			SecureCookies: true,
+		},
+		Store:   StoreConfig{Backend: BackendMongo},
+		MongoDB: database.DefaultConfig(),
+		Gemini:  GeminiConfig{Model: "gemini-2.5-flash"},
+		Planner: PlannerConfig{Timeout: 30 * time.Second},
+		Auth: AuthConfig{
+			PasswordResetTTL:           time.Hour,
+			EmailVerificationTTL:       48 * time.Hour,
+			VerificationResendCooldown: time.Minute,
+			TOTPIssuer:                 "Fitness Center",
+			PasswordPolicy:             auth.DefaultPasswordPolicy(),
+			PasswordHashing:            auth.DefaultHashParams(),
+		},
+		LoginGuard: LoginGuardConfig{
+			Window: time.Hour,
+			Account: ThrottlePolicy{
+				FreeAttempts:     3,
+				BaseDelay:        time.Second,
+				MaxDelay:         5 * time.Minute,
+				LockoutThreshold: 10,
+				LockoutDuration:  30 * time.Minute,
+			},
+			// one address may be shared by many members, e.g. the gym's own wifi
+			IP: ThrottlePolicy{
+				FreeAttempts:     20,
+				BaseDelay:        time.Second,
+				MaxDelay:         5 * time.Minute,
+				LockoutThreshold: 100,
+				LockoutDuration:  30 * time.Minute,
+			},
+		},
+		CheckIn: CheckInConfig{
+			DuplicateWindow: time.Hour,
+			DefaultLocation: "main",
+			CardRotation:    30 * time.Second,
+		},
+		Occupancy: OccupancyConfig{
+			AutoCheckOut:    3 * time.Hour,
+			RefreshInterval: 15 * time.Second,
+			HeatmapWeeks:    8,
+		},
+		Renewals: RenewalConfig{
+			Interval:       time.Hour,
+			LeadTime:       3 * 24 * time.Hour,
+			RetryIntervals: []time.Duration{24 * time.Hour, 2 * 24 * time.Hour, 3 * 24 * time.Hour},
+			GracePeriod:    7 * 24 * time.Hour,
+		},
+		Memberships: MembershipConfig{ExpiryInterval: 15 * time.Minute},
+		OIDC: OIDCConfig{
+			DisplayName: "Single Sign-On",
+			Scopes:      []string{"openid", "email", "profile"},
+			AllowSignup: true,
+			HTTPTimeout: 10 * time.Second,
+		},
+		Mail: mail.Config{Driver: mail.DriverLog, From: "Fitness Center <no-reply@localhost>"},
+		Payments: payments.Config{
+			Currency:         "KZT",
+			WebhookTolerance: 5 * time.Minute,
+			Fake:             payments.FakeConfig{WebhookDelay: 2 * time.Second},
+		},
+		Invoices: invoices.Config{
+			NumberPrefix: "INV",
+			Seller:       invoices.Seller{Name: "Fitness Center"},
+			VAT:          invoices.VATConfig{Rate: 16, PricesIncludeVAT: true},
+		},
+	}
+}
+
+// Load reads defaults, then the YAML file named by CONFIG_FILE (if set), then environment
+// variables, resolves *_file secrets and validates the result
+func Load() (*Config, error) {
+	cfg := Default()
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.resolveSecrets(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("unsupported config file format %q, expected .yaml or .yml", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	// an empty file decodes to io.EOF and simply leaves the defaults in place
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// resolveSecrets fills secret values from their *_file counterparts when set directly is empty
+func (c *Config) resolveSecrets() error {
+	secrets := []struct {
+		name  string
+		value *string
+		file  string
+	}{
+		{"session.key", &c.Session.Key, c.Session.KeyFile},
+		{"mongodb.uri", &c.MongoDB.URI, c.MongoDB.URIFile},
+		{"gemini.api_key", &c.Gemini.APIKey, c.Gemini.APIKeyFile},
+		{"openweather.api_key", &c.OpenWeather.APIKey, c.OpenWeather.APIKeyFile},
+		{"mail.smtp.password", &c.Mail.SMTP.Password, c.Mail.SMTP.PasswordFile},
+		{"auth.signing_key", &c.Auth.SigningKey, c.Auth.SigningKeyFile},
+		{"oidc.client_secret", &c.OIDC.ClientSecret, c.OIDC.ClientSecretFile},
+		{"payments.webhook_secret", &c.Payments.WebhookSecret, c.Payments.WebhookSecretFile},
+	}
+
+	for _, s := range secrets {
+		if *s.value != "" || s.file == "" {
+			continue
+		}
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return fmt.Errorf("failed to read secret file for %s: %w", s.name, err)
+		}
+		*s.value = strings.TrimSpace(string(data))
+	}
+
+	if c.Auth.SigningKey == "" {
+		c.Auth.SigningKey = c.Session.Key
+	}
+	if c.OIDC.RedirectURL == "" {
+		c.OIDC.RedirectURL = strings.TrimRight(c.Server.BaseURL, "/") + "/oidc/callback"
+	}
+	if c.Payments.Provider == payments.ProviderFake {
+		// the fake provider signs its own webhooks, any key of ours will do
+		if c.Payments.WebhookSecret == "" {
+			c.Payments.WebhookSecret = c.Auth.SigningKey
+		}
+		if c.Payments.Fake.WebhookURL == "" {
+			c.Payments.Fake.WebhookURL = strings.TrimRight(c.Server.BaseURL, "/") + "/payments/webhook"
+		}
+	}
+	return nil
+}
+
+// Validate checks that every required setting is present and sane
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.Server.Addr == "" {
+		problems = append(problems, "server.addr is required")
+	}
+	if c.Server.BaseURL == "" {
+		problems = append(problems, "server.base_url is required")
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		problems = append(problems, "server.shutdown_timeout must be positive")
+	}
+	if c.Session.MaxAge <= 0 {
+		problems = append(problems, "session.max_age must be positive")
+	}
+	if c.Session.IdleTimeout <= 0 {
+		problems = append(problems, "session.idle_timeout must be positive")
+	}
+	if c.Planner.Timeout <= 0 {
+		problems = append(problems, "planner.timeout must be positive")
+	}
+	if c.Auth.PasswordResetTTL <= 0 {
+		problems = append(problems, "auth.password_reset_ttl must be positive")
+	}
+	if c.Auth.EmailVerificationTTL <= 0 {
+		problems = append(problems, "auth.email_verification_ttl must be positive")
+	}
+	if c.Auth.TOTPIssuer == "" {
+		problems = append(problems, "auth.totp_issuer is required")
+	}
+	if policy := c.Auth.PasswordPolicy; policy.MinLength < 1 || policy.MaxLength < policy.MinLength || policy.MaxLength > 72 {
+		problems = append(problems, "auth.password_policy needs 1 <= min_length <= max_length <= 72")
+	}
+	if classes := c.Auth.PasswordPolicy.MinCharacterClasses; classes < 0 || classes > 4 {
+		problems = append(problems, "auth.password_policy.min_character_classes must be between 0 and 4")
+	}
+	switch hashing := c.Auth.PasswordHashing; hashing.Algorithm {
+	case auth.AlgorithmBcrypt:
+		if hashing.BcryptCost < bcrypt.MinCost || hashing.BcryptCost > bcrypt.MaxCost {
+			problems = append(problems, fmt.Sprintf("auth.password_hashing.bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+		}
+	case auth.AlgorithmArgon2id:
+		if hashing.Argon2Time < 1 || hashing.Argon2Threads < 1 || hashing.Argon2MemoryKiB < 8*uint32(hashing.Argon2Threads) {
+			problems = append(problems, "auth.password_hashing needs argon2_time >= 1, argon2_threads >= 1 and argon2_memory_kib >= 8 * argon2_threads")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("auth.password_hashing.algorithm must be %q or %q, got %q", auth.AlgorithmBcrypt, auth.AlgorithmArgon2id, hashing.Algorithm))
+	}
+	if c.LoginGuard.Window <= 0 {
+		problems = append(problems, "login_guard.window must be positive")
+	}
+	policies := []struct {
+		name   string
+		policy ThrottlePolicy
+	}{
+		{"account", c.LoginGuard.Account},
+		{"ip", c.LoginGuard.IP},
+	}
+	for _, p := range policies {
+		if p.policy.FreeAttempts < 0 || p.policy.BaseDelay < 0 || p.policy.MaxDelay < p.policy.BaseDelay {
+			problems = append(problems, fmt.Sprintf("login_guard.%s needs free_attempts >= 0 and 0 <= base_delay <= max_delay", p.name))
+		}
+		if p.policy.LockoutThreshold > 0 && p.policy.LockoutDuration <= 0 {
+			problems = append(problems, fmt.Sprintf("login_guard.%s.lockout_duration must be positive when lockouts are enabled", p.name))
+		}
+	}
+	if c.CheckIn.DuplicateWindow < 0 {
+		problems = append(problems, "check_in.duplicate_window must not be negative")
+	}
+	if c.CheckIn.DefaultLocation == "" {
+		problems = append(problems, "check_in.default_location is required")
+	}
+	if c.CheckIn.CardRotation < time.Second {
+		problems = append(problems, "check_in.card_rotation must be at least 1s")
+	}
+	if c.Occupancy.AutoCheckOut <= 0 {
+		problems = append(problems, "occupancy.auto_check_out must be positive")
+	}
+	if c.Occupancy.RefreshInterval < time.Second {
+		problems = append(problems, "occupancy.refresh_interval must be at least 1s")
+	}
+	if c.Occupancy.HeatmapWeeks < 1 || c.Occupancy.HeatmapWeeks > 52 {
+		problems = append(problems, "occupancy.heatmap_weeks must be between 1 and 52")
+	}
+	switch c.Payments.Provider {
+	case "":
+		problems = append(problems, "payments.provider is required")
+	case payments.ProviderFake:
+		if !c.Payments.Fake.Allowed {
+			problems = append(problems, "payments.provider fake accepts payments without charging, set payments.fake.allowed only for development and tests")
+		}
+	}
+	if len(c.Payments.Currency) != 3 {
+		problems = append(problems, "payments.currency must be a three-letter ISO 4217 code")
+	}
+	if c.Payments.WebhookSecret == "" {
+		problems = append(problems, "payments.webhook_secret is required")
+	}
+	if c.Payments.WebhookTolerance <= 0 {
+		problems = append(problems, "payments.webhook_tolerance must be positive")
+	}
+	if c.Invoices.NumberPrefix == "" {
+		problems = append(problems, "invoices.number_prefix is required")
+	}
+	if c.Invoices.Seller.Name == "" {
+		problems = append(problems, "invoices.seller.name is required")
+	}
+	if c.Invoices.VAT.Enabled && (c.Invoices.VAT.Rate <= 0 || c.Invoices.VAT.Rate >= 100) {
+		problems = append(problems, "invoices.vat.rate must be between 0 and 100 percent")
+	}
+	if c.Renewals.Interval < time.Second {
+		problems = append(problems, "renewals.interval must be at least 1s")
+	}
+	if c.Renewals.LeadTime < 0 || c.Renewals.GracePeriod < 0 {
+		problems = append(problems, "renewals.lead_time and renewals.grace_period must not be negative")
+	}
+	for _, retry := range c.Renewals.RetryIntervals {
+		if retry <= 0 {
+			problems = append(problems, "renewals.retry_intervals must be positive")
+			break
+		}
+	}
+	if c.Memberships.ExpiryInterval < time.Second {
+		problems = append(problems, "memberships.expiry_interval must be at least 1s")
+	}
+	if c.OIDC.Enabled {
+		problems = append(problems, c.OIDC.validate()...)
+	}
+	if len(c.Session.Key) < minSessionKeyLength {
+		problems = append(problems, fmt.Sprintf("session.key must be at least %d bytes (set SESSION_KEY or SESSION_KEY_FILE)", minSessionKeyLength))
+	}
+
+	switch c.Store.Backend {
+	case BackendMemory:
+	case BackendMongo:
+		if err := c.MongoDB.Validate(); err != nil {
+			problems = append(problems, err.Error()+" (set MONGODB_URI or MONGODB_URI_FILE)")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("store.backend must be %q or %q, got %q", BackendMongo, BackendMemory, c.Store.Backend))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
+
+func (c OIDCConfig) validate() []string {
+	var problems []string
+	if c.ClientID == "" {
+		problems = append(problems, "oidc.client_id is required when oidc is enabled")
+	}
+	if c.HTTPTimeout <= 0 {
+		problems = append(problems, "oidc.http_timeout must be positive")
+	}
+
+	hasOpenID := false
+	for _, scope := range c.Scopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		problems = append(problems, `oidc.scopes must include "openid"`)
+	}
+
+	urls := []struct {
+		name     string
+		value    string
+		required bool
+	}{
+		{"oidc.issuer", c.Issuer, true},
+		{"oidc.redirect_url", c.RedirectURL, true},
+		{"oidc.authorization_url", c.AuthorizationURL, false},
+		{"oidc.token_url", c.TokenURL, false},
+		{"oidc.jwks_url", c.JWKSURL, false},
+	}
+	for _, u := range urls {
+		if u.value == "" {
+			if u.required {
+				problems = append(problems, u.name+" is required when oidc is enabled")
+			}
+			continue
+		}
+		parsed, err := url.Parse(u.value)
+		if err != nil || parsed.Host == "" {
+			problems = append(problems, u.name+" must be an absolute URL")
+			continue
+		}
+		// the redirect URL is ours, it follows server.base_url rather than the provider's rules
+		if u.name == "oidc.redirect_url" {
+			continue
+		}
+		if parsed.Scheme != "https" && !(parsed.Scheme == "http" && c.AllowInsecureHTTP) {
+			problems = append(problems, u.name+" must use https (set oidc.allow_insecure_http for a local mock provider)")
+		}
+	}
+
+	// discovery needs every endpoint or none, a partial set would silently mix two sources
+	set := 0
+	for _, endpoint := range []string{c.AuthorizationURL, c.TokenURL, c.JWKSURL} {
+		if endpoint != "" {
+			set++
+		}
+	}
+	if set != 0 && set != 3 {
+		problems = append(problems, "oidc.authorization_url, oidc.token_url and oidc.jwks_url must be set together")
+	}
+	return problems
+}
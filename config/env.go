@@ -0,0 +1,181 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// applyEnv overrides settings with any environment variables that are set
+func (c *Config) applyEnv() error {
+	envString("SERVER_ADDR", &c.Server.Addr)
+	envString("PUBLIC_BASE_URL", &c.Server.BaseURL)
+	envString("SESSION_KEY", &c.Session.Key)
+	envString("SESSION_KEY_FILE", &c.Session.KeyFile)
+	envString("STORE_BACKEND", &c.Store.Backend)
+	envString("MONGODB_URI", &c.MongoDB.URI)
+	envString("MONGODB_URI_FILE", &c.MongoDB.URIFile)
+	envString("MONGODB_DATABASE", &c.MongoDB.Database)
+	envString("MONGODB_TLS_CA_FILE", &c.MongoDB.TLS.CAFile)
+	envString("MONGODB_TLS_CERT_KEY_FILE", &c.MongoDB.TLS.CertificateKeyFile)
+	envString("GEMINI_API_KEY", &c.Gemini.APIKey)
+	envString("GEMINI_API_KEY_FILE", &c.Gemini.APIKeyFile)
+	envString("GEMINI_MODEL", &c.Gemini.Model)
+	envString("FITNESS_PLANNER_URL", &c.Planner.URL)
+	envString("OPENWEATHER_API_KEY", &c.OpenWeather.APIKey)
+	envString("OPENWEATHER_API_KEY_FILE", &c.OpenWeather.APIKeyFile)
+	envString("SIGNING_KEY", &c.Auth.SigningKey)
+	envString("SIGNING_KEY_FILE", &c.Auth.SigningKeyFile)
+	envString("TOTP_ISSUER", &c.Auth.TOTPIssuer)
+	envString("CHECKIN_DEFAULT_LOCATION", &c.CheckIn.DefaultLocation)
+	envString("OIDC_ISSUER", &c.OIDC.Issuer)
+	envString("OIDC_CLIENT_ID", &c.OIDC.ClientID)
+	envString("OIDC_CLIENT_SECRET", &c.OIDC.ClientSecret)
+	envString("OIDC_CLIENT_SECRET_FILE", &c.OIDC.ClientSecretFile)
+	envString("OIDC_REDIRECT_URL", &c.OIDC.RedirectURL)
+	envString("OIDC_DISPLAY_NAME", &c.OIDC.DisplayName)
+	envString("PASSWORD_HASH_ALGORITHM", &c.Auth.PasswordHashing.Algorithm)
+	envString("PASSWORD_BREACHED_LIST_FILE", &c.Auth.PasswordPolicy.BreachedListFile)
+	envString("PAYMENTS_PROVIDER", &c.Payments.Provider)
+	envString("PAYMENTS_CURRENCY", &c.Payments.Currency)
+	envString("PAYMENTS_WEBHOOK_SECRET", &c.Payments.WebhookSecret)
+	envString("PAYMENTS_WEBHOOK_SECRET_FILE", &c.Payments.WebhookSecretFile)
+	envString("PAYMENTS_FAKE_WEBHOOK_URL", &c.Payments.Fake.WebhookURL)
+	envString("INVOICES_NUMBER_PREFIX", &c.Invoices.NumberPrefix)
+	envString("INVOICES_SELLER_NAME", &c.Invoices.Seller.Name)
+	envString("INVOICES_SELLER_BIN", &c.Invoices.Seller.BIN)
+	envString("INVOICES_SELLER_ADDRESS", &c.Invoices.Seller.Address)
+	envString("MAIL_DRIVER", &c.Mail.Driver)
+	envString("MAIL_FROM", &c.Mail.From)
+	envString("MAIL_DIR", &c.Mail.Dir)
+	envString("SMTP_HOST", &c.Mail.SMTP.Host)
+	envString("SMTP_USERNAME", &c.Mail.SMTP.Username)
+	envString("SMTP_PASSWORD", &c.Mail.SMTP.Password)
+	envString("SMTP_PASSWORD_FILE", &c.Mail.SMTP.PasswordFile)
+
+	parsers := []error{
+		envDuration("SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout),
+		envDuration("SESSION_MAX_AGE", &c.Session.MaxAge),
+		envDuration("SESSION_IDLE_TIMEOUT", &c.Session.IdleTimeout),
+		envBool("SESSION_SECURE_COOKIES", &c.Session.SecureCookies),
+		envUint("MONGODB_MAX_POOL_SIZE", &c.MongoDB.MaxPoolSize),
+		envUint("MONGODB_MIN_POOL_SIZE", &c.MongoDB.MinPoolSize),
+		envDuration("MONGODB_CONNECT_TIMEOUT", &c.MongoDB.ConnectTimeout),
+		envDuration("MONGODB_SERVER_SELECTION_TIMEOUT", &c.MongoDB.ServerSelectionTimeout),
+		envBool("MONGODB_TLS", &c.MongoDB.TLS.Enabled),
+		envBool("MONGODB_TLS_INSECURE", &c.MongoDB.TLS.InsecureSkipVerify),
+		envBool("MONGODB_AUTO_MIGRATE", &c.MongoDB.AutoMigrate),
+		envDuration("FITNESS_PLANNER_TIMEOUT", &c.Planner.Timeout),
+		envDuration("PASSWORD_RESET_TTL", &c.Auth.PasswordResetTTL),
+		envDuration("EMAIL_VERIFICATION_TTL", &c.Auth.EmailVerificationTTL),
+		envDuration("VERIFICATION_RESEND_COOLDOWN", &c.Auth.VerificationResendCooldown),
+		envInt("PASSWORD_BCRYPT_COST", &c.Auth.PasswordHashing.BcryptCost),
+		envInt("PASSWORD_MIN_LENGTH", &c.Auth.PasswordPolicy.MinLength),
+		envInt("PASSWORD_MIN_CHARACTER_CLASSES", &c.Auth.PasswordPolicy.MinCharacterClasses),
+		envBool("PASSWORD_CHECK_BREACHED", &c.Auth.PasswordPolicy.CheckBreached),
+		envDuration("LOGIN_GUARD_WINDOW", &c.LoginGuard.Window),
+		envInt("LOGIN_ACCOUNT_FREE_ATTEMPTS", &c.LoginGuard.Account.FreeAttempts),
+		envInt("LOGIN_ACCOUNT_LOCKOUT_THRESHOLD", &c.LoginGuard.Account.LockoutThreshold),
+		envDuration("LOGIN_ACCOUNT_LOCKOUT_DURATION", &c.LoginGuard.Account.LockoutDuration),
+		envInt("LOGIN_IP_FREE_ATTEMPTS", &c.LoginGuard.IP.FreeAttempts),
+		envInt("LOGIN_IP_LOCKOUT_THRESHOLD", &c.LoginGuard.IP.LockoutThreshold),
+		envDuration("LOGIN_IP_LOCKOUT_DURATION", &c.LoginGuard.IP.LockoutDuration),
+		envDuration("CHECKIN_DUPLICATE_WINDOW", &c.CheckIn.DuplicateWindow),
+		envDuration("CHECKIN_CARD_ROTATION", &c.CheckIn.CardRotation),
+		envDuration("OCCUPANCY_AUTO_CHECK_OUT", &c.Occupancy.AutoCheckOut),
+		envDuration("OCCUPANCY_REFRESH_INTERVAL", &c.Occupancy.RefreshInterval),
+		envInt("OCCUPANCY_HEATMAP_WEEKS", &c.Occupancy.HeatmapWeeks),
+		envBool("OIDC_ENABLED", &c.OIDC.Enabled),
+		envBool("OIDC_ALLOW_SIGNUP", &c.OIDC.AllowSignup),
+		envBool("OIDC_ALLOW_INSECURE_HTTP", &c.OIDC.AllowInsecureHTTP),
+		envInt("SMTP_PORT", &c.Mail.SMTP.Port),
+		envDuration("PAYMENTS_WEBHOOK_TOLERANCE", &c.Payments.WebhookTolerance),
+		envDuration("PAYMENTS_FAKE_WEBHOOK_DELAY", &c.Payments.Fake.WebhookDelay),
+		envBool("PAYMENTS_FAKE_ALLOWED", &c.Payments.Fake.Allowed),
+		envDuration("RENEWALS_INTERVAL", &c.Renewals.Interval),
+		envDuration("RENEWALS_LEAD_TIME", &c.Renewals.LeadTime),
+		envDuration("RENEWALS_GRACE_PERIOD", &c.Renewals.GracePeriod),
+		envDuration("MEMBERSHIPS_EXPIRY_INTERVAL", &c.Memberships.ExpiryInterval),
+		envBool("INVOICES_VAT_ENABLED", &c.Invoices.VAT.Enabled),
+		envFloat("INVOICES_VAT_RATE", &c.Invoices.VAT.Rate),
+		envBool("INVOICES_PRICES_INCLUDE_VAT", &c.Invoices.VAT.PricesIncludeVAT),
+	}
+	for _, err := range parsers {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envString(name string, target *string) {
+	if v, ok := os.LookupEnv(name); ok && v != "" {
+		*target = v
+	}
+}
+
+func envBool(name string, target *bool) error {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+func envUint(name string, target *uint64) error {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+func envDuration(name string, target *time.Duration) error {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+func envInt(name string, target *int) error {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil
+	}
+	parsed, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*target = parsed
+	return nil
+}
+
+func envFloat(name string, target *float64) error {
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return nil
+	}
+	parsed, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", name, err)
+	}
+	*target = parsed
+	return nil
+}
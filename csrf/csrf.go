@@ -0,0 +1,127 @@
+// Package csrf implements signed double-submit tokens. A random token is kept in a cookie and
+// every state-changing request must echo it back in the X-CSRF-Token header or a csrf_token form
+// field. The cookie is HMAC-signed so a sibling subdomain can't plant a token of its choosing.
+package csrf
+
+import (
+	"SSE/auth"
+	"SSE/config"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	CookieName = "csrf_token"
+	HeaderName = "X-CSRF-Token"
+	FieldName  = "csrf_token"
+)
+
+var (
+	signingKey []byte
+	secure     bool
+	maxAge     time.Duration
+	// exempt holds the paths of endpoints called by other servers, which authenticate themselves
+	exempt = map[string]bool{}
+)
+
+// Initialize configures token signing and the cookie attributes, it must be called before serving
+func Initialize(key string, session config.SessionConfig) {
+	signingKey = []byte(key)
+	secure = session.SecureCookies
+	maxAge = session.MaxAge
+}
+
+// Exempt turns off the check for paths. They must authenticate requests some other way, like the
+// signature on payment webhooks. It must be called before serving.
+func Exempt(paths ...string) {
+	for _, path := range paths {
+		exempt[path] = true
+	}
+}
+
+// Token returns the request's CSRF token, issuing a new cookie when there is no valid one yet.
+// It must be called once per response, before the body is written.
+func Token(w http.ResponseWriter, r *http.Request) (string, error) {
+	if token, ok := cookieToken(r); ok {
+		return token, nil
+	}
+
+	random, _, err := auth.GenerateToken()
+	if err != nil {
+		return "", err
+	}
+	token := random + "." + auth.Sign(signingKey, "csrf", random)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     CookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+// Protect rejects unsafe requests that don't carry the token from their CSRF cookie
+func Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if exempt[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// browsers never attach an Authorization header on their own, so bearer requests can't be forged
+		if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected, ok := cookieToken(r)
+		if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(submittedToken(r))) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "Invalid or missing CSRF token, reload the page and try again"}`))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cookieToken returns the token in the request's cookie if its signature is valid
+func cookieToken(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return "", false
+	}
+
+	random, signature, found := strings.Cut(cookie.Value, ".")
+	if !found || random == "" || !auth.VerifySignature(signingKey, signature, "csrf", random) {
+		return "", false
+	}
+	return cookie.Value, true
+}
+
+// submittedToken reads the token from the header, falling back to the form field for HTML forms.
+// JSON bodies are never parsed here so handlers can still decode them.
+func submittedToken(r *http.Request) string {
+	if token := r.Header.Get(HeaderName); token != "" {
+		return token
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") || strings.HasPrefix(contentType, "multipart/form-data") {
+		return r.PostFormValue(FieldName)
+	}
+	return ""
+}
@@ -0,0 +1,120 @@
+package csrf
+
+import (
+	"SSE/config"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func issueToken(t *testing.T) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	token, err := Token(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != CookieName || cookies[0].Value != token {
+		t.Fatalf("Token set cookies %v, want one %s cookie holding the token", cookies, CookieName)
+	}
+	return token
+}
+
+func TestProtect(t *testing.T) {
+	Initialize("0123456789abcdef0123456789abcdef", config.SessionConfig{MaxAge: time.Hour})
+	Exempt("/payments/webhook")
+	token := issueToken(t)
+	other := issueToken(t)
+	random, _, _ := strings.Cut(token, ".")
+	forged := random + ".forged-signature"
+
+	form := url.Values{FieldName: {token}}.Encode()
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		cookie      string
+		header      string
+		contentType string
+		body        string
+		bearer      bool
+		want        int
+	}{
+		{name: "safe method without token", method: http.MethodGet, path: "/profile", want: http.StatusOK},
+		{name: "header matches cookie", method: http.MethodPost, path: "/profile", cookie: token, header: token, want: http.StatusOK},
+		{name: "form field matches cookie", method: http.MethodPost, path: "/profile", cookie: token,
+			contentType: "application/x-www-form-urlencoded", body: form, want: http.StatusOK},
+		{name: "no cookie", method: http.MethodPost, path: "/profile", header: token, want: http.StatusForbidden},
+		{name: "no submitted token", method: http.MethodPost, path: "/profile", cookie: token, want: http.StatusForbidden},
+		{name: "token of another cookie", method: http.MethodDelete, path: "/profile", cookie: token, header: other, want: http.StatusForbidden},
+		{name: "unsigned cookie", method: http.MethodPost, path: "/profile", cookie: forged, header: forged, want: http.StatusForbidden},
+		{name: "token in JSON body is ignored", method: http.MethodPost, path: "/profile", cookie: token,
+			contentType: "application/json", body: `{"csrf_token":"` + token + `"}`, want: http.StatusForbidden},
+		{name: "bearer request", method: http.MethodPost, path: "/api/visits", bearer: true, want: http.StatusOK},
+		{name: "exempt path", method: http.MethodPost, path: "/payments/webhook", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := Protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CookieName, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(HeaderName, tt.header)
+			}
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.bearer {
+				r.Header.Set("Authorization", "Bearer some-api-token")
+			}
+
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, r)
+			if recorder.Code != tt.want {
+				t.Fatalf("status = %d, want %d", recorder.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenReusesValidCookie(t *testing.T) {
+	Initialize("0123456789abcdef0123456789abcdef", config.SessionConfig{MaxAge: time.Hour})
+	token := issueToken(t)
+
+	tests := []struct {
+		name   string
+		cookie string
+		reused bool
+	}{
+		{"valid cookie", token, true},
+		{"tampered cookie", token + "x", false},
+		{"cookie without signature", "just-random", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.AddCookie(&http.Cookie{Name: CookieName, Value: tt.cookie})
+			recorder := httptest.NewRecorder()
+
+			got, err := Token(recorder, r)
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+			if reused := got == tt.cookie; reused != tt.reused {
+				t.Fatalf("reused cookie = %v, want %v", reused, tt.reused)
+			}
+			if issued := len(recorder.Result().Cookies()) > 0; issued == tt.reused {
+				t.Fatalf("new cookie issued = %v, want %v", issued, !tt.reused)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config describes how to reach MongoDB, it is filled in by the config package
+type Config struct {
+	URI                    string        `yaml:"uri"`
+	URIFile                string        `yaml:"uri_file"`
+	Database               string        `yaml:"database"`
+	MaxPoolSize            uint64        `yaml:"max_pool_size"`
+	MinPoolSize            uint64        `yaml:"min_pool_size"`
+	ConnectTimeout         time.Duration `yaml:"connect_timeout"`
+	ServerSelectionTimeout time.Duration `yaml:"server_selection_timeout"`
+	TLS                    TLSConfig     `yaml:"tls"`
+	// AutoMigrate applies pending schema migrations when the server starts
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// TLSConfig holds the optional TLS settings for the Mongo connection
+type TLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertificateKeyFile string `yaml:"certificate_key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// DefaultConfig returns the settings used when nothing is configured. There is deliberately no
+// default URI, it carries credentials and must come from MONGODB_URI or MONGODB_URI_FILE
+func DefaultConfig() Config {
+	return Config{
+		Database:               "SSE",
+		MaxPoolSize:            100,
+		ConnectTimeout:         10 * time.Second,
+		ServerSelectionTimeout: 10 * time.Second,
+		AutoMigrate:            true,
+	}
+}
+
+// Validate reports settings that would make the connection impossible
+func (c Config) Validate() error {
+	if c.URI == "" {
+		return fmt.Errorf("MongoDB URI is required")
+	}
+	if c.Database == "" {
+		return fmt.Errorf("MongoDB database name is required")
+	}
+	if c.MinPoolSize > c.MaxPoolSize && c.MaxPoolSize != 0 {
+		return fmt.Errorf("MongoDB min pool size %d exceeds max pool size %d", c.MinPoolSize, c.MaxPoolSize)
+	}
+	if c.ConnectTimeout <= 0 {
+		return fmt.Errorf("MongoDB connect timeout must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"SSE/models"
+	"SSE/rbac"
+	"SSE/sessions"
+	"SSE/store"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+var errNoSessionUser = errors.New("no signed-in user")
+
+// actingUser loads the signed-in user from the session
+func actingUser(r *http.Request) (*models.User, error) {
+	session, err := sessions.Get(r)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, ok := session.Values["user_id"].(string)
+	if !ok || userID == "" {
+		return nil, errNoSessionUser
+	}
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, errNoSessionUser
+	}
+
+	user, err := repo.Users.GetByID(r.Context(), objID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, errNoSessionUser
+	}
+	return user, err
+}
+
+// resolveTargetUser returns the user a request operates on. Without requestedID that is the
+// signed-in user; another user's record is only returned when the acting role holds permission,
+// the actor has enrolled the second factor their role requires, and the target ranks below the
+// actor or the actor may manage roles. On failure the error response has already been written.
+func resolveTargetUser(w http.ResponseWriter, r *http.Request, requestedID string, permission rbac.Permission) (*models.User, bool) {
+	actor, err := actingUser(r)
+	if err != nil {
+		if errors.Is(err, errNoSessionUser) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		} else {
+			http.Error(w, "Failed to retrieve session", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	if requestedID == "" || requestedID == actor.ID.Hex() {
+		return actor, true
+	}
+
+	if !rbac.Can(actor.EffectiveRole(), permission) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	// the same rule middleware.RequirePermission applies to staff routes
+	if actor.EffectiveRole().RequiresTwoFactor() && !actor.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication must be enabled for your role", http.StatusForbidden)
+		return nil, false
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(requestedID)
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	target, err := repo.Users.GetByID(r.Context(), objectID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+
+	// otherwise front desk staff could take over an admin account by changing its email or password
+	if !actor.EffectiveRole().Outranks(target.EffectiveRole()) && !rbac.Can(actor.EffectiveRole(), rbac.PermManageRoles) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return target, true
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"SSE/middleware"
+	"SSE/models"
+	"SSE/store"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+func UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		UserID string      `json:"user_id"`
+		Role   models.Role `json:"role"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !requestData.Role.IsValid() {
+		http.Error(w, "Unknown role", http.StatusBadRequest)
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(requestData.UserID)
+	if err != nil {
+		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	user, err := repo.Users.GetByID(r.Context(), objectID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	user.Role = requestData.Role
+	user.UpdatedAt = time.Now()
+
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated successfully", "role": string(user.Role)})
+}
+
+// UnlockAccount clears the failed login counters and lockout of a user, found by ID or email
+func UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		UserID string `json:"user_id"`
+		Email  string `json:"email"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := requestData.Email
+	if requestData.UserID != "" {
+		objectID, err := primitive.ObjectIDFromHex(requestData.UserID)
+		if err != nil {
+			http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+			return
+		}
+
+		user, err := repo.Users.GetByID(r.Context(), objectID)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				http.Error(w, "User not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "Failed to load user", http.StatusInternalServerError)
+			}
+			return
+		}
+		email = user.Email
+	}
+
+	if email == "" {
+		http.Error(w, "user_id or email is required", http.StatusBadRequest)
+		return
+	}
+
+	unlocked, err := guard.Unlock(r.Context(), email)
+	if err != nil {
+		http.Error(w, "Failed to unlock account", http.StatusInternalServerError)
+		return
+	}
+
+	if admin, ok := middleware.CurrentUser(r); ok {
+		log.Printf("admin %s cleared login lockout of %s", admin.ID.Hex(), email)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Account unlocked", "had_failures": unlocked})
+}
+
+// ListFailedLogins returns the newest failed login attempts, optionally for one account
+func ListFailedLogins(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 100
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 1000 {
+			http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	attempts, err := guard.RecentFailures(r.Context(), r.URL.Query().Get("email"), limit)
+	if err != nil {
+		http.Error(w, "Failed to load login attempts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(attempts)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"SSE/auth"
+	"SSE/models"
+	"SSE/store"
+	"SSE/web"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// apiTokenPrefix makes leaked tokens easy to recognise, e.g. by secret scanners
+	apiTokenPrefix      = "sse_pat_"
+	maxAPITokensPerUser = 20
+	maxAPITokenNameLen  = 64
+	maxAPITokenDays     = 365
+)
+
+// ListAPITokens returns the signed-in member's tokens, never the token values themselves
+func ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := repo.APITokens.ListByUser(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, "Failed to list API tokens", http.StatusInternalServerError)
+			return
+		}
+		if tokens == nil {
+			tokens = []models.APIToken{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+
+	case http.MethodPost:
+		createAPIToken(w, r, user)
+
+	default:
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+// createAPIToken issues a new token. The token value is only ever returned in this response.
+func createAPIToken(w http.ResponseWriter, r *http.Request, user *models.User) {
+	var requestData struct {
+		Name          string              `json:"name"`
+		Scopes        []models.TokenScope `json:"scopes"`
+		ExpiresInDays int                 `json:"expires_in_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	requestData.Name = strings.TrimSpace(requestData.Name)
+	if requestData.Name == "" || len(requestData.Name) > maxAPITokenNameLen {
+		http.Error(w, "Name is required and must be at most 64 characters", http.StatusBadRequest)
+		return
+	}
+	if len(requestData.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range requestData.Scopes {
+		if !scope.IsValid() {
+			http.Error(w, "Unknown scope: "+string(scope), http.StatusBadRequest)
+			return
+		}
+	}
+	if requestData.ExpiresInDays < 0 || requestData.ExpiresInDays > maxAPITokenDays {
+		http.Error(w, "expires_in_days must be between 0 (never) and 365", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := repo.APITokens.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list API tokens", http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxAPITokensPerUser {
+		http.Error(w, "You have reached the maximum number of API tokens, revoke one first", http.StatusConflict)
+		return
+	}
+
+	random, _, err := auth.GenerateToken()
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+	value := apiTokenPrefix + random
+
+	now := time.Now()
+	token := models.APIToken{
+		UserID:    user.ID,
+		Name:      requestData.Name,
+		TokenHash: auth.HashToken(value),
+		Prefix:    value[:len(apiTokenPrefix)+6],
+		Scopes:    requestData.Scopes,
+		CreatedAt: now,
+	}
+	if requestData.ExpiresInDays > 0 {
+		expiresAt := now.AddDate(0, 0, requestData.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := repo.APITokens.Create(r.Context(), &token); err != nil {
+		http.Error(w, "Failed to create API token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.APIToken
+		Token string `json:"token"`
+	}{token, value})
+}
+
+// RevokeAPIToken deletes one of the signed-in member's tokens
+func RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokenID, err := primitive.ObjectIDFromHex(requestData.ID)
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := repo.APITokens.Delete(r.Context(), user.ID, tokenID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "API token not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to revoke API token", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API token revoked"})
+}
+
+// APITokensPage lets members create and revoke tokens from the browser
+func APITokensPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	web.Render(w, r, "templates/api_tokens.html", struct {
+		Scopes []models.TokenScope
+	}{
+		Scopes: models.TokenScopes(),
+	})
+}
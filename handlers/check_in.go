@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"SSE/models"
+	"SSE/rbac"
+	"SSE/store"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVisitsPageSize = 20
+	maxVisitsPageSize     = 100
+)
+
+var (
+	errMembershipInactive = errors.New("membership is not active")
+	errAlreadyCheckedIn   = errors.New("member already checked in")
+	errInvalidMemberID    = errors.New("malformed member ID")
+)
+
+// checkIn records a visit of member, counting it on the member's record first so that the
+// duplicate window is enforced atomically. staff is the user who let the member in.
+func checkIn(ctx context.Context, member, staff *models.User, location string, method models.CheckInMethod) (*models.Visit, *models.User, error) {
+	if !member.IsActiveMember() {
+		return nil, nil, errMembershipInactive
+	}
+
+	now := time.Now()
+	updated, err := repo.Users.RecordCheckIn(ctx, member.ID, now, settings.CheckIn.DuplicateWindow)
+	if errors.Is(err, store.ErrDuplicate) {
+		return nil, nil, errAlreadyCheckedIn
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a member who left without checking out is counted out when they come back
+	if _, err := repo.Visits.CheckOut(ctx, member.ID, now); err != nil && !errors.Is(err, store.ErrNotFound) {
+		log.Printf("failed to close previous visit of user %s: %v", member.ID.Hex(), err)
+	}
+
+	visit := &models.Visit{
+		UserID:      member.ID,
+		CheckedInAt: now,
+		Location:    location,
+		Method:      method,
+		StaffID:     staff.ID,
+	}
+	if err := repo.Visits.Create(ctx, visit); err != nil {
+		// the check-in was already counted and a retry would be refused as a duplicate, so the
+		// member is let in; only the history entry and their place in the occupancy are missing
+		log.Printf("failed to record visit of user %s: %v", member.ID.Hex(), err)
+		return visit, updated, nil
+	}
+	tracker.Notify()
+	return visit, updated, nil
+}
+
+// memberByMemberID looks up a member ID typed in or scanned at the front desk, rejecting one
+// with a wrong check digit without a lookup
+func memberByMemberID(ctx context.Context, memberID string) (*models.User, error) {
+	memberID = strings.ToUpper(strings.TrimSpace(memberID))
+	if !models.ValidMemberID(memberID) {
+		return nil, errInvalidMemberID
+	}
+	return repo.Users.GetByMemberID(ctx, memberID)
+}
+
+// writeCheckIn answers a successful check-in with the visit and the member's updated count
+func writeCheckIn(w http.ResponseWriter, visit *models.Visit, member *models.User) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"visit":        visit,
+		"member_name":  member.Name,
+		"member_id":    member.MemberID,
+		"total_visits": member.TotalVisits,
+	})
+}
+
+// writeCheckInError answers a failed check-in, member is who was being checked in
+func writeCheckInError(w http.ResponseWriter, member *models.User, err error) {
+	switch {
+	case errors.Is(err, errMembershipInactive):
+		http.Error(w, "Membership is not active", http.StatusForbidden)
+	case errors.Is(err, errAlreadyCheckedIn):
+		http.Error(w, fmt.Sprintf("Member already checked in at %s", member.LastCheckIn.Local().Format("15:04")), http.StatusConflict)
+	case errors.Is(err, errInvalidMemberID):
+		http.Error(w, "Invalid member ID, please check it for typos", http.StatusBadRequest)
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Member not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to check in", http.StatusInternalServerError)
+	}
+}
+
+// CheckInMember lets front desk staff check a member in by user ID or member ID
+func CheckInMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		UserID   string               `json:"user_id"`
+		MemberID string               `json:"member_id"`
+		Location string               `json:"location"`
+		Method   models.CheckInMethod `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestData.Method == "" {
+		requestData.Method = models.CheckInManual
+	}
+	if !requestData.Method.Valid() {
+		http.Error(w, "Unknown check-in method", http.StatusBadRequest)
+		return
+	}
+	if requestData.Method == models.CheckInQR {
+		// only a verified QR payload may be recorded as a QR check-in
+		http.Error(w, "QR codes must be checked in through /checkin/scan", http.StatusBadRequest)
+		return
+	}
+	location := strings.TrimSpace(requestData.Location)
+	if location == "" {
+		location = settings.CheckIn.DefaultLocation
+	}
+
+	staff, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var member *models.User
+	switch {
+	case requestData.UserID != "":
+		objID, parseErr := primitive.ObjectIDFromHex(requestData.UserID)
+		if parseErr != nil {
+			http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+			return
+		}
+		member, err = repo.Users.GetByID(r.Context(), objID)
+	case requestData.MemberID != "":
+		member, err = memberByMemberID(r.Context(), requestData.MemberID)
+	default:
+		http.Error(w, "user_id or member_id is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeCheckInError(w, member, err)
+		return
+	}
+
+	visit, updated, err := checkIn(r.Context(), member, staff, location, requestData.Method)
+	if err != nil {
+		writeCheckInError(w, member, err)
+		return
+	}
+
+	writeCheckIn(w, visit, updated)
+}
+
+// CheckOutMember ends a member's current visit. Members check themselves out, staff who can check
+// members in may name anyone by user ID or member ID.
+func CheckOutMember(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		UserID   string `json:"user_id"`
+		MemberID string `json:"member_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userID := requestData.UserID
+	if memberID := strings.TrimSpace(requestData.MemberID); memberID != "" {
+		member, err := memberByMemberID(r.Context(), memberID)
+		if err != nil {
+			writeCheckInError(w, member, err)
+			return
+		}
+		userID = member.ID.Hex()
+	}
+	member, ok := resolveTargetUser(w, r, userID, rbac.PermCheckInMembers)
+	if !ok {
+		return
+	}
+
+	visit, err := repo.Visits.CheckOut(r.Context(), member.ID, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Member is not checked in", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check out", http.StatusInternalServerError)
+		return
+	}
+	tracker.Notify()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"visit":          visit,
+		"member_name":    member.Name,
+		"member_id":      member.MemberID,
+		"minutes_stayed": int(visit.CheckedOutAt.Sub(visit.CheckedInAt).Minutes()),
+	})
+}
+
+// ListVisits returns a page of a member's visit history, newest first. Members see their own,
+// staff who can view members may pass user_id.
+func ListVisits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	page, err := positiveQueryInt(query.Get("page"), 1)
+	if err != nil || page > math.MaxInt32/maxVisitsPageSize {
+		http.Error(w, "page must be a positive number", http.StatusBadRequest)
+		return
+	}
+	pageSize, err := positiveQueryInt(query.Get("page_size"), defaultVisitsPageSize)
+	if err != nil || pageSize > maxVisitsPageSize {
+		http.Error(w, fmt.Sprintf("page_size must be between 1 and %d", maxVisitsPageSize), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := resolveTargetUser(w, r, query.Get("user_id"), rbac.PermViewMembers)
+	if !ok {
+		return
+	}
+
+	visits, total, err := repo.Visits.ListByUser(r.Context(), user.ID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		http.Error(w, "Failed to load visits", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"visits":        visits,
+		"page":          page,
+		"page_size":     pageSize,
+		"total":         total,
+		"total_visits":  user.TotalVisits,
+		"last_check_in": user.LastCheckIn,
+	})
+}
+
+// positiveQueryInt parses an optional positive query parameter, returning fallback when it is empty
+func positiveQueryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		return 0, errors.New("not a positive number")
+	}
+	return parsed, nil
+}
@@ -2,13 +2,12 @@ package handlers
 
 import (
 	"SSE/auth"
-	"SSE/database"
 	"SSE/models"
 	"SSE/sessions"
-	"context"
-	"go.mongodb.org/mongo-driver/bson"
+	"SSE/store"
+	"SSE/web"
+	"errors"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"html/template"
 	"log"
 	"net/http"
 	"time"
@@ -33,45 +32,17 @@ func EditProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "users")
+	user, err := repo.Users.GetByID(r.Context(), objID)
 	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
+		// User not found - clear session and redirect to login
+		sessions.ClearSession(w, r)
+		http.Redirect(w, r, "/login?error=session_expired", http.StatusSeeOther)
 		return
 	}
 
 	switch r.Method {
 	case http.MethodGet:
-		var user models.User
-		if err := collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&user); err != nil {
-			// User not found - clear session and redirect to login
-			sessions.ClearSession(w, r)
-			http.Redirect(w, r, "/login?error=session_expired", http.StatusSeeOther)
-			return
-		}
-
-		tmpl, err := template.ParseFiles("templates/edit_profile.html")
-		if err != nil {
-			log.Printf("template parse error: %v", err)
-			http.Error(w, "Failed to load template: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		data := struct {
-			Name  string
-			Email string
-			ID    string
-		}{
-			Name:  user.Name,
-			Email: user.Email,
-			ID:    userID,
-		}
-
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		if err := tmpl.Execute(w, data); err != nil {
-			log.Printf("template execute error: %v", err)
-			http.Error(w, "Failed to render page: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
+		renderEditProfile(w, r, user, "")
 
 	case http.MethodPost:
 		if err := r.ParseForm(); err != nil {
@@ -84,54 +55,92 @@ func EditProfile(w http.ResponseWriter, r *http.Request) {
 		newPassword := r.FormValue("password")
 		currentPassword := r.FormValue("current_password")
 
-		updateFields := bson.M{}
+		changed := false
 
 		if name != "" {
-			updateFields["name"] = name
-		}
-		if email != "" {
-			updateFields["email"] = email
+			user.Name = name
+			changed = true
 		}
+
+		// the password is settled first so a rejected one doesn't leave a confirmation email behind
 		if newPassword != "" {
 			if currentPassword == "" {
 				http.Redirect(w, r, "/edit-profile?error=required_current_password", http.StatusSeeOther)
 				return
 			}
-			var user models.User
-			err := collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&user)
-			if err != nil {
-				// User not found - clear session and redirect to login
-				sessions.ClearSession(w, r)
-				http.Redirect(w, r, "/login?error=session_expired", http.StatusSeeOther)
-				return
-			}
 			if !user.CheckPassword(currentPassword) {
 				http.Redirect(w, r, "/edit-profile?error=incorrect_password", http.StatusSeeOther)
 				return
 			}
+			accountEmail := user.Email
+			if email != "" {
+				accountEmail = email
+			}
+			if err := auth.ValidatePassword(newPassword, user.Name, accountEmail); err != nil {
+				renderEditProfile(w, r, user, err.Error())
+				return
+			}
 			hashed, err := auth.HashPassword(newPassword)
 			if err != nil {
 				http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 				return
 			}
-			updateFields["password"] = hashed
+			user.Password = hashed
+			changed = true
+		}
+
+		if email != "" && email != user.Email {
+			if err := requestEmailChange(r, user, email); err != nil {
+				if errors.Is(err, errEmailTaken) {
+					http.Redirect(w, r, "/edit-profile?error=email_taken", http.StatusSeeOther)
+					return
+				}
+				log.Printf("failed to send email verification: %v", err)
+				http.Error(w, "Failed to send confirmation email", http.StatusInternalServerError)
+				return
+			}
+			changed = true
 		}
 
-		if len(updateFields) == 0 {
+		if !changed {
 			http.Redirect(w, r, "/profile", http.StatusSeeOther)
 			return
 		}
 
-		updateFields["updated_at"] = time.Now()
+		user.UpdatedAt = time.Now()
 
-		_, err := collection.UpdateOne(r.Context(), bson.M{"_id": objID}, bson.M{"$set": updateFields})
-		if err != nil {
+		if err := repo.Users.Update(r.Context(), user); err != nil {
+			if errors.Is(err, store.ErrDuplicate) {
+				http.Redirect(w, r, "/edit-profile?error=email_taken", http.StatusSeeOther)
+				return
+			}
 			http.Error(w, "Failed to update profile", http.StatusInternalServerError)
 			return
 		}
 
+		if user.PendingEmail != "" {
+			http.Redirect(w, r, "/profile?email_pending=1", http.StatusSeeOther)
+			return
+		}
 		http.Redirect(w, r, "/profile", http.StatusSeeOther)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+// renderEditProfile shows the edit form for user, with errorMessage in the error dialog when set
+func renderEditProfile(w http.ResponseWriter, r *http.Request, user *models.User, errorMessage string) {
+	data := struct {
+		Name  string
+		Email string
+		ID    string
+		Error string
+	}{
+		Name:  user.Name,
+		Email: user.Email,
+		ID:    user.ID.Hex(),
+		Error: errorMessage,
+	}
+
+	web.Render(w, r, "templates/edit_profile.html", data)
+}
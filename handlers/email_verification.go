@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"SSE/auth"
+	"SSE/mail"
+	"SSE/models"
+	"SSE/store"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var errEmailTaken = errors.New("email already in use")
+
+// sendVerificationEmail mails a signed confirmation link for email and records when it was sent.
+// The caller is responsible for persisting user.
+func sendVerificationEmail(r *http.Request, user *models.User, email string) error {
+	expires := time.Now().Add(settings.Auth.EmailVerificationTTL).Unix()
+	exp := strconv.FormatInt(expires, 10)
+	signature := auth.Sign([]byte(settings.Auth.SigningKey), "verify-email", user.ID.Hex(), email, exp)
+
+	query := url.Values{}
+	query.Set("uid", user.ID.Hex())
+	query.Set("email", email)
+	query.Set("exp", exp)
+	query.Set("sig", signature)
+	link := settings.Server.BaseURL + "/verify-email?" + query.Encode()
+
+	user.VerificationSentAt = time.Now()
+	return mailer.Send(r.Context(), mail.Message{
+		To:      email,
+		Subject: "Confirm your Fitness Center email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that %s is your email address by opening the link below "+
+			"within %s:\n\n%s\n\nIf you didn't request this, you can ignore this email.\n",
+			user.Name, email, settings.Auth.EmailVerificationTTL, link),
+	})
+}
+
+// requestEmailChange parks newEmail on the user until it is confirmed and mails the link to it.
+// The caller is responsible for persisting user.
+func requestEmailChange(r *http.Request, user *models.User, newEmail string) error {
+	if newEmail == user.Email {
+		user.PendingEmail = ""
+		return nil
+	}
+
+	if _, err := repo.Users.GetByEmail(r.Context(), newEmail); err == nil {
+		return errEmailTaken
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	user.PendingEmail = newEmail
+	return sendVerificationEmail(r, user, newEmail)
+}
+
+// VerifyEmail confirms the address in a signed link, either the account email or a pending change
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	userID, email, exp, signature := query.Get("uid"), query.Get("email"), query.Get("exp"), query.Get("sig")
+
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expires ||
+		!auth.VerifySignature([]byte(settings.Auth.SigningKey), signature, "verify-email", userID, email, exp) {
+		http.Error(w, "This confirmation link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		http.Error(w, "This confirmation link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+
+	user, err := repo.Users.GetByID(r.Context(), objID)
+	if err != nil {
+		http.Error(w, "This confirmation link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+
+	switch email {
+	case user.PendingEmail:
+		user.Email = user.PendingEmail
+		user.PendingEmail = ""
+	case user.Email:
+	default:
+		// the link was for an address the member has since replaced
+		http.Error(w, "This confirmation link is invalid or has expired", http.StatusBadRequest)
+		return
+	}
+
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		if errors.Is(err, store.ErrDuplicate) {
+			http.Error(w, "That email address is already used by another account", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	if actor, err := actingUser(r); err == nil && actor.ID == user.ID {
+		http.Redirect(w, r, "/profile?email_verified=1", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/login?email_verified=1", http.StatusSeeOther)
+}
+
+// ResendVerification mails a fresh confirmation link, at most once per cooldown period
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerified {
+			http.Error(w, "Your email address is already verified", http.StatusBadRequest)
+			return
+		}
+		email = user.Email
+	}
+
+	if wait := settings.Auth.VerificationResendCooldown - time.Since(user.VerificationSentAt); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		http.Error(w, "Please wait before requesting another confirmation email", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := sendVerificationEmail(r, user, email); err != nil {
+		http.Error(w, "Failed to send confirmation email", http.StatusInternalServerError)
+		return
+	}
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"message": "Confirmation email sent"}`))
+}
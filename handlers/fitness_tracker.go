@@ -1,17 +1,13 @@
 package handlers
 
 import (
-	"SSE/database"
 	"SSE/models"
 	"SSE/sessions"
+	"SSE/web"
 	"bytes"
-	"context"
 	"encoding/json"
 	"fmt"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"html/template"
 	"io/ioutil"
 	"net/http"
 	"time"
@@ -19,13 +15,6 @@ import (
 
 func FitnessTrackerPageHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("FitnessTrackerPageHandler called")
-	tmpl, err := template.ParseFiles("templates/fitness_tracker.html")
-	if err != nil {
-		fmt.Println("Template error:", err)
-		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	session, err := sessions.Get(r)
 	if err != nil {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -42,13 +31,7 @@ func FitnessTrackerPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userCollection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	var user models.User
-	err = userCollection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&user)
+	user, err := repo.Users.GetByID(r.Context(), objID)
 	if err != nil {
 		// User not found - clear session and redirect to login
 		sessions.ClearSession(w, r)
@@ -56,23 +39,15 @@ func FitnessTrackerPageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fitnessCollection, err := database.GetCollection("SSE", "fitness_profiles")
-	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
 	var profile models.FitnessProfile
-	err = fitnessCollection.FindOne(context.TODO(), bson.M{"user_id": objID}).Decode(&profile)
+	storedProfile, profileErr := repo.FitnessProfiles.GetByUserID(r.Context(), objID)
+	if profileErr == nil {
+		profile = *storedProfile
+	}
 
-	activityCollection, err := database.GetCollection("SSE", "activities")
+	activities, err := repo.Activities.ListRecentByUser(r.Context(), objID, 10)
 	if err != nil {
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	cursor, err := activityCollection.Find(context.TODO(), bson.M{"user_id": objID}, options.Find().SetSort(bson.M{"date": -1}).SetLimit(10))
-	var activities []models.Activity
-	if err == nil {
-		cursor.All(context.TODO(), &activities)
+		fmt.Println("Activity lookup error:", err)
 	}
 
 	data := struct {
@@ -85,18 +60,13 @@ func FitnessTrackerPageHandler(w http.ResponseWriter, r *http.Request) {
 		UserName:      user.Name,
 		Profile:       profile,
 		Activities:    activities,
-		HasProfile:    err == nil,
+		HasProfile:    profileErr == nil,
 		Authenticated: true,
 	}
 
 	fmt.Println("Template data - UserName:", data.UserName, "HasProfile:", data.HasProfile)
 
-	err = tmpl.Execute(w, data)
-	if err != nil {
-		fmt.Println("Template execution error:", err)
-		http.Error(w, "Template execution error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	web.Render(w, r, "templates/fitness_tracker.html", data)
 }
 
 func CreateFitnessProfileHandler(w http.ResponseWriter, r *http.Request) {
@@ -139,23 +109,7 @@ func CreateFitnessProfileHandler(w http.ResponseWriter, r *http.Request) {
 	profile.CreatedAt = time.Now()
 	profile.UpdatedAt = time.Now()
 
-	collection, err := database.GetCollection("SSE", "fitness_profiles")
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-
-	var existingProfile models.FitnessProfile
-	err = collection.FindOne(context.TODO(), bson.M{"user_id": objID}).Decode(&existingProfile)
-	if err == nil {
-		profile.ID = existingProfile.ID
-		profile.CreatedAt = existingProfile.CreatedAt
-		_, err = collection.ReplaceOne(context.TODO(), bson.M{"_id": existingProfile.ID}, profile)
-	} else {
-		_, err = collection.InsertOne(context.TODO(), profile)
-	}
-
-	if err != nil {
+	if err := repo.FitnessProfiles.Save(r.Context(), &profile); err != nil {
 		http.Error(w, "Failed to save profile", http.StatusInternalServerError)
 		return
 	}
@@ -201,14 +155,7 @@ func AddActivityHandler(w http.ResponseWriter, r *http.Request) {
 		activity.Date = time.Now()
 	}
 
-	collection, err := database.GetCollection("SSE", "activities")
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = collection.InsertOne(context.TODO(), activity)
-	if err != nil {
+	if err := repo.Activities.Create(r.Context(), &activity); err != nil {
 		http.Error(w, "Failed to save activity", http.StatusInternalServerError)
 		return
 	}
@@ -242,13 +189,7 @@ func GetFitnessRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "fitness_profiles")
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-	var profile models.FitnessProfile
-	err = collection.FindOne(context.TODO(), bson.M{"user_id": objID}).Decode(&profile)
+	profile, err := repo.FitnessProfiles.GetByUserID(r.Context(), objID)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]string{
@@ -268,7 +209,7 @@ func GetFitnessRecommendationsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fmt.Println("Calling fitness recommendation AI API...")
-	recommendations, err := GetAIFitnessRecommendations(profile, req.RequestType, req.SpecificQuestion)
+	recommendations, err := GetAIFitnessRecommendations(*profile, req.RequestType, req.SpecificQuestion)
 	if err != nil {
 		fmt.Println("AI API error:", err)
 		http.Error(w, "Failed to get recommendations", http.StatusInternalServerError)
@@ -329,8 +270,10 @@ func GetAIFitnessRecommendations(profile models.FitnessProfile, requestType, spe
 		return "", err
 	}
 
-	apiURL := "https://meatiest-inkier-miriam.ngrok-free.dev/plan"
-	request, err := http.NewRequest("POST", apiURL, bytes.NewReader(jsonPayload))
+	if settings.Planner.URL == "" {
+		return "", fmt.Errorf("fitness planner URL is not configured")
+	}
+	request, err := http.NewRequest("POST", settings.Planner.URL, bytes.NewReader(jsonPayload))
 	if err != nil {
 		fmt.Println("HTTP request creation error:", err)
 		return "", err
@@ -338,7 +281,7 @@ func GetAIFitnessRecommendations(profile models.FitnessProfile, requestType, spe
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Accept", "application/json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := &http.Client{Timeout: settings.Planner.Timeout}
 	resp, err := client.Do(request)
 	if err != nil {
 		fmt.Println("HTTP request error:", err)
@@ -556,8 +499,10 @@ type WeatherResponse struct {
 }
 
 func getAstanaWeatherMessage() (string, error) {
-	apiKey := "e07c1dae22075230a36cf1534b6284e0"
-	url := fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?lat=51.1694&lon=71.4491&appid=%s&units=metric", apiKey)
+	if settings.OpenWeather.APIKey == "" {
+		return "", fmt.Errorf("OpenWeather API key is not configured")
+	}
+	url := fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?lat=51.1694&lon=71.4491&appid=%s&units=metric", settings.OpenWeather.APIKey)
 
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Get(url)
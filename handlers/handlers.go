@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"SSE/billing"
+	"SSE/config"
+	"SSE/loginguard"
+	"SSE/mail"
+	"SSE/membership"
+	"SSE/occupancy"
+	"SSE/oidc"
+	"SSE/payments"
+	"SSE/store"
+)
+
+// Dependencies holds everything the handlers need from the outside world
+type Dependencies struct {
+	Store  *store.Store
+	Config *config.Config
+	Mailer mail.Sender
+	// LoginGuard is used to unlock accounts and read the failed login audit trail
+	LoginGuard *loginguard.Guard
+	// IdentityProvider is nil when signing in with an external provider is disabled
+	IdentityProvider oidc.Provider
+	// Occupancy is told about check-ins and check-outs and serves the live counts
+	Occupancy *occupancy.Tracker
+	// Payments charges members for the plans they select
+	Payments payments.Provider
+	// Billing applies payments to memberships
+	Billing *billing.Service
+	// Memberships makes membership status changes requested by members and staff
+	Memberships *membership.Lifecycle
+}
+
+var (
+	repo     *store.Store
+	settings *config.Config
+	mailer   mail.Sender
+	guard    *loginguard.Guard
+	// identityProvider is nil when external sign-in is disabled
+	identityProvider oidc.Provider
+	tracker          *occupancy.Tracker
+	paymentProvider  payments.Provider
+	billingService   *billing.Service
+	lifecycle        *membership.Lifecycle
+)
+
+// Initialize injects the handler dependencies; it must be called before routes are served
+func Initialize(deps Dependencies) {
+	repo = deps.Store
+	settings = deps.Config
+	mailer = deps.Mailer
+	guard = deps.LoginGuard
+	identityProvider = deps.IdentityProvider
+	tracker = deps.Occupancy
+	paymentProvider = deps.Payments
+	billingService = deps.Billing
+	lifecycle = deps.Memberships
+}
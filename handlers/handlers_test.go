@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"SSE/config"
+	"SSE/mail"
+	"SSE/models"
+	"SSE/sessions"
+	"SSE/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingMailer keeps every message instead of sending it
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func (m *recordingMailer) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages)
+}
+
+// testEnv is the handlers wired to a memory store and server-side sessions the way main wires them
+type testEnv struct {
+	store  *store.Store
+	cfg    *config.Config
+	mailer *recordingMailer
+}
+
+// newTestEnv initializes the handlers, deps may set the dependencies a test needs beyond the
+// store, config and mailer
+func newTestEnv(t *testing.T, deps Dependencies) *testEnv {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Store.Backend = config.BackendMemory
+	cfg.Session.Key = strings.Repeat("session-key-", 4)
+	cfg.Session.SecureCookies = false
+	cfg.Auth.SigningKey = strings.Repeat("signing-key-", 4)
+
+	env := &testEnv{store: store.NewMemoryStore(), cfg: &cfg, mailer: &recordingMailer{}}
+	deps.Store, deps.Config, deps.Mailer = env.store, env.cfg, env.mailer
+	sessions.Initialize(cfg.Session, env.store.Sessions)
+	Initialize(deps)
+	return env
+}
+
+// createUser stores user, a verified member unless it says otherwise
+func (e *testEnv) createUser(t *testing.T, user models.User) *models.User {
+	t.Helper()
+	if user.Email == "" {
+		user.Email = "member@example.com"
+	}
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	if user.MembershipStatus == "" {
+		user.MembershipStatus = models.StatusNone
+	}
+	if err := e.store.Users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
+	return &user
+}
+
+// signIn returns the cookies of a session signed in as user
+func (e *testEnv) signIn(t *testing.T, user *models.User) []*http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := sessions.SetUserSession(w, httptest.NewRequest(http.MethodGet, "/", nil), user.ID.Hex()); err != nil {
+		t.Fatalf("SetUserSession: %v", err)
+	}
+	return w.Result().Cookies()
+}
+
+// request builds a request carrying cookies
+func request(method, target, body string, cookies []*http.Cookie) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
@@ -1,23 +1,13 @@
 package handlers
 
 import (
-	"SSE/database"
-	"SSE/models"
 	"SSE/sessions"
-	"context"
-	"go.mongodb.org/mongo-driver/bson"
+	"SSE/web"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"html/template"
 	"net/http"
 )
 
 func HomePage(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("templates/index.html")
-	if err != nil {
-		http.Error(w, "Error loading template", http.StatusInternalServerError)
-		return
-	}
-
 	session, err := sessions.Get(r)
 	if err != nil {
 		http.Error(w, "Failed to retrieve session", http.StatusInternalServerError)
@@ -33,7 +23,7 @@ func HomePage(w http.ResponseWriter, r *http.Request) {
 			Authenticated: false,
 			UserName:      "",
 		}
-		tmpl.Execute(w, data)
+		web.Render(w, r, "templates/index.html", data)
 		return
 	}
 
@@ -43,14 +33,7 @@ func HomePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
-		return
-	}
-
-	var user models.User
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&user)
+	user, err := repo.Users.GetByID(r.Context(), objID)
 	if err != nil {
 		// User not found - clear session and redirect to login
 		sessions.ClearSession(w, r)
@@ -68,8 +51,5 @@ func HomePage(w http.ResponseWriter, r *http.Request) {
 		UserName:      user.Name,
 	}
 
-	err = tmpl.Execute(w, data)
-	if err != nil {
-		http.Error(w, "Failed to render page", http.StatusInternalServerError)
-	}
+	web.Render(w, r, "templates/index.html", data)
 }
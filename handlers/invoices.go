@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"SSE/invoices"
+	"SSE/rbac"
+	"SSE/store"
+	"SSE/web"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListInvoices returns the invoices of the signed-in member, or of user_id for staff
+func ListInvoices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := resolveTargetUser(w, r, r.URL.Query().Get("user_id"), rbac.PermViewMembers)
+	if !ok {
+		return
+	}
+
+	list, err := repo.Invoices.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch invoices", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// InvoiceReceipt serves the receipt for invoice id as a printable page, or as a PDF download
+// with format=pdf
+func InvoiceReceipt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+	invoice, err := repo.Invoices.GetByID(r.Context(), invoiceID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch invoice", http.StatusInternalServerError)
+		return
+	}
+	if _, ok := resolveTargetUser(w, r, invoice.UserID.Hex(), rbac.PermViewMembers); !ok {
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "html":
+		web.Render(w, r, "templates/receipt.html", struct {
+			invoices.Receipt
+			ID string
+		}{invoices.NewReceipt(invoice, invoices.FormatAmount), invoice.ID.Hex()})
+	case "pdf":
+		// rendered into a buffer so a failure can still be answered with an error
+		var document bytes.Buffer
+		if err := invoices.WritePDF(&document, invoice); err != nil {
+			log.Printf("Failed to render invoice %s: %v", invoice.Number, err)
+			http.Error(w, "Failed to render receipt", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", invoice.Number+".pdf"))
+		w.Header().Set("Content-Length", strconv.Itoa(document.Len()))
+		w.Write(document.Bytes())
+	default:
+		http.Error(w, "Invalid format, use html or pdf", http.StatusBadRequest)
+	}
+}
+
+// ExportInvoices returns the invoices issued between the from and to dates, both included, as
+// CSV for accounting. Without dates it covers the current month.
+func ExportInvoices(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := from.AddDate(0, 1, 0)
+	if value := r.URL.Query().Get("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid from date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if value := r.URL.Query().Get("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			http.Error(w, "Invalid to date, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		http.Error(w, "from must not be after to", http.StatusBadRequest)
+		return
+	}
+
+	list, err := repo.Invoices.ListIssued(r.Context(), from, to)
+	if err != nil {
+		http.Error(w, "Failed to fetch invoices", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		fmt.Sprintf("invoices-%s-%s.csv", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02"))))
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"number", "issued_at", "kind", "customer", "email", "member_id", "currency", "subtotal", "vat_rate", "vat_amount", "total", "period_start", "period_end"})
+	for _, invoice := range list {
+		writer.Write([]string{
+			invoice.Number,
+			invoice.IssuedAt.Local().Format("2006-01-02"),
+			string(invoice.Kind),
+			spreadsheetText(invoice.Customer.Name),
+			spreadsheetText(invoice.Customer.Email),
+			spreadsheetText(invoice.Customer.MemberID),
+			invoice.Currency,
+			decimalAmount(invoice.Subtotal),
+			strconv.FormatFloat(invoice.VATRate, 'f', -1, 64),
+			decimalAmount(invoice.VATAmount),
+			decimalAmount(invoice.Total),
+			invoice.PeriodStart.Local().Format("2006-01-02"),
+			invoice.PeriodEnd.Local().Format("2006-01-02"),
+		})
+	}
+	writer.Flush()
+}
+
+// spreadsheetText keeps a text cell from being run as a formula when the export is opened in a
+// spreadsheet, the values come from members' profiles
+func spreadsheetText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// decimalAmount writes minor units as a plain decimal spreadsheets read as a number, e.g. 13499.00
+func decimalAmount(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import "testing"
+
+func TestSpreadsheetText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Annabel Lee", "Annabel Lee"},
+		{"", ""},
+		{`=HYPERLINK("http://evil.example","x")`, `'=HYPERLINK("http://evil.example","x")`},
+		{"+7 701 000 0000", "'+7 701 000 0000"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1+1", "'\t=1+1"},
+		{"\r=1+1", "'\r=1+1"},
+		{"a=b", "a=b"},
+		{"GYM-2026-0001233", "GYM-2026-0001233"},
+	}
+	for _, tt := range tests {
+		if got := spreadsheetText(tt.value); got != tt.want {
+			t.Errorf("spreadsheetText(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDecimalAmount(t *testing.T) {
+	tests := []struct {
+		amount int64
+		want   string
+	}{
+		{1349900, "13499.00"},
+		{5, "0.05"},
+		{-400050, "-4000.50"},
+		{0, "0.00"},
+	}
+	for _, tt := range tests {
+		if got := decimalAmount(tt.amount); got != tt.want {
+			t.Errorf("decimalAmount(%d) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
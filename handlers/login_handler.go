@@ -1,12 +1,14 @@
 package handlers
 
 import (
-	"SSE/database"
+	"SSE/auth"
 	"SSE/models"
 	"SSE/sessions"
+	"SSE/web"
 	"encoding/json"
-	"go.mongodb.org/mongo-driver/bson"
+	"log"
 	"net/http"
+	"time"
 )
 
 func LoginCustomer(w http.ResponseWriter, r *http.Request) {
@@ -25,28 +27,34 @@ func LoginCustomer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "users")
+	user, err := repo.Users.GetByEmail(r.Context(), credentials.Email)
 	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	var user models.User
-	err = collection.FindOne(r.Context(), bson.M{"email": credentials.Email}).Decode(&user)
-	if err != nil {
+	match, outdated := auth.CheckPassword(user.Password, credentials.Password)
+	if !match {
 		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
+	if outdated {
+		rehashPassword(r, user, credentials.Password)
+	}
 
-	if !user.CheckPassword(credentials.Password) {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+	pendingSecondFactor, err := beginSession(w, r, user)
+	if err != nil {
+		http.Error(w, "Failed to set session", http.StatusInternalServerError)
 		return
 	}
 
-	userID := user.ID.Hex()
-
-	if err := sessions.SetUserSession(w, r, userID); err != nil {
-		http.Error(w, "Failed to set session", http.StatusInternalServerError)
+	if pendingSecondFactor {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"enrollment_required": !user.TwoFactor.Enabled,
+		})
 		return
 	}
 
@@ -54,3 +62,47 @@ func LoginCustomer(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
 }
+
+// rehashPassword replaces an outdated password hash while the plain password is at hand. A failure
+// only postpones the upgrade to the next login.
+func rehashPassword(r *http.Request, user *models.User, password string) {
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		log.Printf("failed to rehash password for user %s: %v", user.ID.Hex(), err)
+		return
+	}
+
+	user.Password = hashed
+	user.UpdatedAt = time.Now()
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		log.Printf("failed to store rehashed password for user %s: %v", user.ID.Hex(), err)
+	}
+}
+
+// beginSession signs in a user whose first factor has been checked, or parks the login until a
+// second factor is supplied. It reports whether the login is waiting for the second factor.
+func beginSession(w http.ResponseWriter, r *http.Request, user *models.User) (bool, error) {
+	userID := user.ID.Hex()
+
+	// staff must enroll before their first full sign-in, so they also stop at the second step
+	if user.TwoFactor.Enabled || user.EffectiveRole().RequiresTwoFactor() {
+		return true, sessions.SetPendingLogin(w, r, userID)
+	}
+	return false, sessions.SetUserSession(w, r, userID)
+}
+
+// LoginPage renders the sign-in form, offering the external identity provider when one is configured
+func LoginPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := struct {
+		SSOName string
+	}{}
+	if identityProvider != nil {
+		data.SSOName = identityProvider.DisplayName()
+	}
+	web.Render(w, r, "templates/login.html", data)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"SSE/auth"
+	"SSE/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// memberCardImageSize is the width and height of the QR code PNG in pixels
+const memberCardImageSize = 320
+
+// MemberCardImage serves the signed-in member's current check-in QR code as a PNG. The code rotates,
+// so the response must not be cached; X-Refresh-After tells the page when to fetch the next one.
+func MemberCardImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.MemberID == "" {
+		http.Error(w, "No member ID assigned", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	rotation := settings.CheckIn.CardRotation
+	payload := auth.MemberCardPayload([]byte(settings.Auth.SigningKey), user.MemberID, now, rotation)
+	image, err := qrcode.Encode(payload, qrcode.Medium, memberCardImageSize)
+	if err != nil {
+		log.Printf("failed to render member card of user %s: %v", user.ID.Hex(), err)
+		http.Error(w, "Failed to render member card", http.StatusInternalServerError)
+		return
+	}
+
+	refresh := int(math.Ceil(auth.MemberCardRefresh(now, rotation).Seconds()))
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Refresh-After", strconv.Itoa(refresh))
+	w.Write(image)
+}
+
+// ScanMemberCard checks a member in from the payload of their scanned QR code
+func ScanMemberCard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Payload  string `json:"payload"`
+		Location string `json:"location"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	memberID, err := auth.VerifyMemberCard([]byte(settings.Auth.SigningKey), requestData.Payload, time.Now(), settings.CheckIn.CardRotation)
+	switch {
+	case errors.Is(err, auth.ErrMemberCardExpired):
+		http.Error(w, "Member card code has expired, ask the member to refresh it", http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, "Invalid member card", http.StatusBadRequest)
+		return
+	}
+
+	location := strings.TrimSpace(requestData.Location)
+	if location == "" {
+		location = settings.CheckIn.DefaultLocation
+	}
+
+	staff, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	member, err := memberByMemberID(r.Context(), memberID)
+	if err != nil {
+		writeCheckInError(w, member, err)
+		return
+	}
+
+	visit, updated, err := checkIn(r.Context(), member, staff, location, models.CheckInQR)
+	if err != nil {
+		writeCheckInError(w, member, err)
+		return
+	}
+
+	writeCheckIn(w, visit, updated)
+}
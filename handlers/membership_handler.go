@@ -1,12 +1,17 @@
 package handlers
 
 import (
-	"SSE/database"
+	"SSE/billing"
+	"SSE/membership"
 	"SSE/models"
+	"SSE/rbac"
+	"SSE/store"
 	"encoding/json"
-	"go.mongodb.org/mongo-driver/bson"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -16,34 +21,15 @@ func GetMembershipPlans(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "membership_plans")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
-		return
-	}
-
-	var plans []models.MembershipPlan
-	cursor, err := collection.Find(r.Context(), bson.M{"is_active": true})
+	plans, err := repo.MembershipPlans.ListActive(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to fetch membership plans", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(r.Context())
-
-	if err = cursor.All(r.Context(), &plans); err != nil {
-		http.Error(w, "Failed to decode membership plans", http.StatusInternalServerError)
-		return
-	}
 
 	if len(plans) == 0 {
 		defaultPlans := models.GetDefaultPlans()
-		var interfaces []interface{}
-		for _, plan := range defaultPlans {
-			interfaces = append(interfaces, plan)
-		}
-
-		_, err = collection.InsertMany(r.Context(), interfaces)
-		if err != nil {
+		if err := repo.MembershipPlans.CreateMany(r.Context(), defaultPlans); err != nil {
 			http.Error(w, "Failed to create default plans", http.StatusInternalServerError)
 			return
 		}
@@ -54,6 +40,8 @@ func GetMembershipPlans(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(plans)
 }
 
+// SelectMembershipPlan starts the purchase of a plan. It needs an Idempotency-Key header so a
+// retried request returns the same payment instead of charging twice.
 func SelectMembershipPlan(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
@@ -70,117 +58,363 @@ func SelectMembershipPlan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(requestData.UserID)
+	planObjID, err := primitive.ObjectIDFromHex(requestData.MembershipPlanID)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		http.Error(w, "Invalid membership plan ID", http.StatusBadRequest)
 		return
 	}
 
-	planObjID, err := primitive.ObjectIDFromHex(requestData.MembershipPlanID)
+	plan, err := repo.MembershipPlans.GetActiveByID(r.Context(), planObjID)
 	if err != nil {
-		http.Error(w, "Invalid membership plan ID", http.StatusBadRequest)
+		http.Error(w, "Membership plan not found", http.StatusNotFound)
 		return
 	}
 
-	planCollection, err := database.GetCollection("SSE", "membership_plans")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
+	user, ok := resolveTargetUser(w, r, requestData.UserID, rbac.PermManageMembers)
+	if !ok {
+		return
+	}
+
+	if !user.EmailVerified {
+		http.Error(w, "Email address must be verified before selecting a membership plan", http.StatusForbidden)
+		return
+	}
+
+	if user.IsActiveMember() && user.MembershipPlanID != plan.ID {
+		// buying another plan would throw away the paid days of the current one
+		http.Error(w, "Use /membership/change to switch the plan of an active membership", http.StatusConflict)
+		return
+	}
+
+	// the plan is only activated once the payment is confirmed, see billing.Service.Complete
+	startCheckout(w, r, user, plan, nil)
+}
+
+func GetUserMembership(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := resolveTargetUser(w, r, r.URL.Query().Get("user_id"), rbac.PermViewMembers)
+	if !ok {
 		return
 	}
 
 	var plan models.MembershipPlan
-	err = planCollection.FindOne(r.Context(), bson.M{"_id": planObjID, "is_active": true}).Decode(&plan)
-	if err != nil {
-		http.Error(w, "Membership plan not found", http.StatusNotFound)
+	if !user.MembershipPlanID.IsZero() {
+		if userPlan, err := repo.MembershipPlans.GetByID(r.Context(), user.MembershipPlanID); err == nil {
+			plan = *userPlan
+		}
+	}
+
+	membershipInfo := map[string]interface{}{
+		"member_id":         user.MemberID,
+		"membership_status": user.MembershipStatus,
+		"membership_expiry": user.MembershipExpiry.Format("2006-01-02"),
+		"join_date":         user.JoinDate.Format("2006-01-02"),
+		"total_visits":      user.TotalVisits,
+		"days_until_expiry": user.DaysUntilExpiry(),
+		"is_active":         user.IsActiveMember(),
+		"auto_renew":        user.AutoRenew,
+		"plan":              plan,
+	}
+	if !user.ScheduledPlanID.IsZero() {
+		membershipInfo["scheduled_plan_id"] = user.ScheduledPlanID
+	}
+	if !user.ScheduledPlanStart.IsZero() {
+		membershipInfo["scheduled_plan_start"] = user.ScheduledPlanStart.Format("2006-01-02")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(membershipInfo)
+}
+
+// SetAutoRenew turns automatic renewal of the member's current plan on or off. Turning it on needs
+// the payment method renewals are charged to and a membership that is active or still within the
+// grace period, a lapsed one is bought again instead.
+func SetAutoRenew(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userCollection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
+	var requestData struct {
+		UserID        string `json:"user_id"`
+		Enabled       bool   `json:"enabled"`
+		PaymentMethod string `json:"payment_method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	now := time.Now()
-	expiryDate := now.AddDate(0, plan.Duration, 0)
+	user, ok := resolveTargetUser(w, r, requestData.UserID, rbac.PermManageMembers)
+	if !ok {
+		return
+	}
 
-	updateFields := bson.M{
-		"membership_plan_id": planObjID,
-		"membership_status":  models.StatusActive,
-		"membership_expiry":  expiryDate,
-		"join_date":          now,
-		"updated_at":         now,
+	if requestData.Enabled {
+		if user.MembershipPlanID.IsZero() {
+			http.Error(w, "Choose a membership plan before turning on auto-renew", http.StatusConflict)
+			return
+		}
+		if !billingService.Renewable(user) {
+			http.Error(w, "Your membership has lapsed, choose a plan to renew it", http.StatusConflict)
+			return
+		}
+		if requestData.PaymentMethod == "" {
+			http.Error(w, "A payment method is required for auto-renew", http.StatusBadRequest)
+			return
+		}
+		user.RenewalMethod = requestData.PaymentMethod
+	} else {
+		user.RenewalMethod = ""
 	}
+	user.AutoRenew = requestData.Enabled
+	user.UpdatedAt = time.Now()
 
-	result, err := userCollection.UpdateOne(r.Context(), bson.M{"_id": userObjID}, bson.M{"$set": updateFields})
+	// only the auto-renew fields are written so concurrent membership changes aren't overwritten
+	if err := repo.Users.SetAutoRenew(r.Context(), user.ID, user.AutoRenew, user.RenewalMethod, user.UpdatedAt); err != nil {
+		http.Error(w, "Failed to update auto-renew", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"auto_renew":        user.AutoRenew,
+		"membership_expiry": user.MembershipExpiry.Format("2006-01-02"),
+	})
+}
+
+// ChangeMembershipStatus moves a membership to another status. Members may only cancel their own
+// membership, staff who manage members may make any allowed change.
+func ChangeMembershipStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		UserID string `json:"user_id"`
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	to := models.MembershipStatus(requestData.Status)
+	if !to.Valid() || to == models.StatusNone {
+		http.Error(w, "Invalid membership status", http.StatusBadRequest)
+		return
+	}
+
+	actor, err := actingUser(r)
 	if err != nil {
-		http.Error(w, "Failed to update user membership", http.StatusInternalServerError)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	user, ok := resolveTargetUser(w, r, requestData.UserID, rbac.PermManageMembers)
+	if !ok {
+		return
+	}
+
+	reason := membership.ReasonCancelled
+	if rbac.Can(actor.EffectiveRole(), rbac.PermManageMembers) {
+		reason = strings.TrimSpace(requestData.Reason)
+		if reason == "" {
+			reason = membership.ReasonStaff
+		} else if len(reason) > maxStatusReasonLength {
+			http.Error(w, "Reason is too long", http.StatusBadRequest)
+			return
+		}
+	} else if to != models.StatusCancelled {
+		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
 
-	if result.MatchedCount == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	switch to {
+	case models.StatusActive:
+		// memberships are bought through a plan, staff may only reinstate time already paid for
+		if !time.Now().Before(user.MembershipExpiry) {
+			http.Error(w, "Membership has no paid time left, a plan must be purchased", http.StatusConflict)
+			return
+		}
+	case models.StatusCancelled:
+		user.AutoRenew = false
+		user.RenewalMethod = ""
+	}
+
+	err = lifecycle.Change(r.Context(), user, to, reason, actor.ID)
+	switch {
+	case errors.Is(err, membership.ErrInvalidTransition):
+		http.Error(w, fmt.Sprintf("A %s membership can't become %s", user.MembershipStatus, to), http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, "Membership changed meanwhile, please try again", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to change membership status", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":     "Membership plan selected successfully",
-		"plan_name":   plan.Name,
-		"expiry_date": expiryDate.Format("2006-01-02"),
+		"membership_status": user.MembershipStatus,
+		"auto_renew":        user.AutoRenew,
 	})
 }
 
-func GetUserMembership(w http.ResponseWriter, r *http.Request) {
+// maxStatusReasonLength bounds the reason staff give for a status change
+const maxStatusReasonLength = 200
+
+// GetMembershipHistory lists the status changes of a member's membership, newest first
+func GetMembershipHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	user, ok := resolveTargetUser(w, r, r.URL.Query().Get("user_id"), rbac.PermViewMembers)
+	if !ok {
 		return
 	}
 
-	userObjID, err := primitive.ObjectIDFromHex(userID)
+	changes, err := repo.MembershipHistory.ListByUser(r.Context(), user.ID)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		http.Error(w, "Failed to fetch membership history", http.StatusInternalServerError)
 		return
 	}
 
-	userCollection, err := database.GetCollection("SSE", "users")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// planChangeRequest resolves the member and the plan of a plan change preview or request and
+// prices the change, writing the error response when it can't be made
+func planChangeRequest(w http.ResponseWriter, r *http.Request, userID, planID string) (*models.User, *models.MembershipPlan, *billing.PlanChangeQuote, bool) {
+	planObjID, err := primitive.ObjectIDFromHex(planID)
 	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
+		http.Error(w, "Invalid membership plan ID", http.StatusBadRequest)
+		return nil, nil, nil, false
+	}
+	plan, err := repo.MembershipPlans.GetActiveByID(r.Context(), planObjID)
+	if err != nil {
+		http.Error(w, "Membership plan not found", http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+
+	user, ok := resolveTargetUser(w, r, userID, rbac.PermManageMembers)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	current, err := repo.MembershipPlans.GetByID(r.Context(), user.MembershipPlanID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Failed to fetch membership plan", http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+	if current == nil {
+		http.Error(w, "No active membership to change, choose a plan instead", http.StatusConflict)
+		return nil, nil, nil, false
+	}
+
+	quote, err := billingService.QuotePlanChange(user, current, plan)
+	switch {
+	case errors.Is(err, billing.ErrNoMembership):
+		http.Error(w, "No active membership to change, choose a plan instead", http.StatusConflict)
+		return nil, nil, nil, false
+	case errors.Is(err, billing.ErrRenewedPlanPending):
+		http.Error(w, "Membership was already renewed on another plan, change it once that plan starts", http.StatusConflict)
+		return nil, nil, nil, false
+	case errors.Is(err, billing.ErrSamePlan) && user.ScheduledPlanID.IsZero():
+		http.Error(w, "Membership is already on this plan", http.StatusConflict)
+		return nil, nil, nil, false
+	case errors.Is(err, billing.ErrSamePlan):
+		// going back to the current plan cancels the scheduled downgrade
+		return user, plan, nil, true
+	case err != nil:
+		http.Error(w, "Failed to price plan change", http.StatusInternalServerError)
+		return nil, nil, nil, false
+	}
+	return user, plan, quote, true
+}
+
+// PreviewPlanChange shows what moving the membership to another plan costs before it is confirmed
+func PreviewPlanChange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var user models.User
-	err = userCollection.FindOne(r.Context(), bson.M{"_id": userObjID}).Decode(&user)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	_, _, quote, ok := planChangeRequest(w, r, r.URL.Query().Get("user_id"), r.URL.Query().Get("plan_id"))
+	if !ok {
+		return
+	}
+	if quote == nil {
+		http.Error(w, "Membership is already on this plan", http.StatusConflict)
 		return
 	}
 
-	var plan models.MembershipPlan
-	if !user.MembershipPlanID.IsZero() {
-		planCollection, err := database.GetCollection("SSE", "membership_plans")
-		if err == nil {
-			planCollection.FindOne(r.Context(), bson.M{"_id": user.MembershipPlanID}).Decode(&plan)
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// ChangeMembershipPlan moves an active membership to another plan. Upgrades start a checkout for
+// the prorated amount, confirmed like any other payment, and need an Idempotency-Key header.
+// Downgrades are scheduled for the end of the current period and choosing the current plan
+// again cancels a scheduled one; the join date is kept either way.
+func ChangeMembershipPlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
 	}
 
-	membershipInfo := map[string]interface{}{
-		"member_id":         user.MemberID,
-		"membership_status": user.MembershipStatus,
-		"membership_expiry": user.MembershipExpiry.Format("2006-01-02"),
-		"join_date":         user.JoinDate.Format("2006-01-02"),
-		"total_visits":      user.TotalVisits,
-		"days_until_expiry": user.DaysUntilExpiry(),
-		"is_active":         user.IsActiveMember(),
-		"plan":              plan,
+	var requestData struct {
+		UserID           string `json:"user_id"`
+		MembershipPlanID string `json:"membership_plan_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
 	}
 
+	user, plan, quote, ok := planChangeRequest(w, r, requestData.UserID, requestData.MembershipPlanID)
+	if !ok {
+		return
+	}
+
+	if quote != nil && quote.Direction == billing.ChangeUpgrade {
+		if quote.AmountDue > 0 {
+			startCheckout(w, r, user, plan, quote)
+			return
+		}
+		if err := billingService.ApplyFreeUpgrade(r.Context(), user, plan); err != nil {
+			planChangeError(w, err)
+			return
+		}
+	} else if err := billingService.ScheduleDowngrade(r.Context(), user, plan); err != nil {
+		planChangeError(w, err)
+		return
+	}
+
+	result := map[string]interface{}{
+		"membership_plan_id": user.MembershipPlanID,
+		"membership_expiry":  user.MembershipExpiry.Format("2006-01-02"),
+		"quote":              quote,
+	}
+	if !user.ScheduledPlanID.IsZero() {
+		result["scheduled_plan_id"] = user.ScheduledPlanID
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(membershipInfo)
+	json.NewEncoder(w).Encode(result)
+}
+
+func planChangeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, "Membership changed meanwhile, please try again", http.StatusConflict)
+		return
+	}
+	http.Error(w, "Failed to change membership plan", http.StatusInternalServerError)
 }
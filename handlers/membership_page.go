@@ -2,8 +2,7 @@ package handlers
 
 import (
 	"SSE/sessions"
-	"html/template"
-	"log"
+	"SSE/web"
 	"net/http"
 )
 
@@ -25,23 +24,11 @@ func MembershipPlansPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/membership_plans.html")
-	if err != nil {
-		log.Printf("template parse error: %v", err)
-		http.Error(w, "Failed to load template: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
 	data := struct {
 		UserID string
 	}{
 		UserID: userID,
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := tmpl.Execute(w, data); err != nil {
-		log.Printf("template execute error: %v", err)
-		http.Error(w, "Failed to render page: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
+	web.Render(w, r, "templates/membership_plans.html", data)
 }
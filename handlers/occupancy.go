@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// occupancyHeartbeat keeps idle event streams from being cut off by proxies
+const occupancyHeartbeat = 25 * time.Second
+
+// Occupancy returns how many members are in the gym right now, per location and in total
+func Occupancy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(tracker.Current())
+}
+
+// OccupancyHeatmap returns the average occupancy by hour of the week, for ?location= or everywhere
+func OccupancyHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	heatmap, err := tracker.Heatmap(r.Context(), strings.TrimSpace(r.URL.Query().Get("location")))
+	if err != nil {
+		log.Printf("failed to build occupancy heatmap: %v", err)
+		http.Error(w, "Failed to load occupancy history", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(heatmap)
+}
+
+// OccupancyStream sends the occupancy as Server-Sent Events, once on connect and again whenever it changes
+func OccupancyStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	updates, unsubscribe := tracker.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(occupancyHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case snapshot, open := <-updates:
+			if !open {
+				return
+			}
+			data, err := json.Marshal(snapshot)
+			if err != nil {
+				log.Printf("failed to encode occupancy: %v", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: occupancy\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
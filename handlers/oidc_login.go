@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"SSE/models"
+	"SSE/oidc"
+	"SSE/sessions"
+	"SSE/store"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	errIdentityNoEmail  = errors.New("identity provider did not share an email address")
+	errIdentityConflict = errors.New("email belongs to an account that can't be linked automatically")
+	errSignupDisabled   = errors.New("no account is linked to this identity and signups are disabled")
+)
+
+// OIDCLogin sends the browser to the identity provider to sign in
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if identityProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	flow, err := sessions.StartLoginFlow(w)
+	if err != nil {
+		http.Error(w, "Failed to start sign-in", http.StatusInternalServerError)
+		return
+	}
+
+	target, err := identityProvider.AuthCodeURL(r.Context(), flow.State, flow.Nonce, flow.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc: failed to build authorization URL: %v", err)
+		http.Redirect(w, r, "/login?error=sso_unavailable", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// OIDCCallback completes the sign-in when the identity provider sends the browser back
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if identityProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	flow, ok := sessions.TakeLoginFlow(w, r, query.Get("state"))
+	if !ok {
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("oidc: provider returned %s: %s", providerError, query.Get("error_description"))
+		http.Redirect(w, r, "/login?error=sso_cancelled", http.StatusSeeOther)
+		return
+	}
+
+	identity, err := identityProvider.Exchange(r.Context(), query.Get("code"), flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		log.Printf("oidc: sign-in failed: %v", err)
+		http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		return
+	}
+
+	user, err := userForIdentity(r, identity)
+	if err != nil {
+		log.Printf("oidc: no user for %s at %s: %v", identity.Subject, identity.Issuer, err)
+		switch {
+		case errors.Is(err, errIdentityNoEmail):
+			http.Redirect(w, r, "/login?error=sso_no_email", http.StatusSeeOther)
+		case errors.Is(err, errIdentityConflict):
+			http.Redirect(w, r, "/login?error=sso_link_refused", http.StatusSeeOther)
+		case errors.Is(err, errSignupDisabled):
+			http.Redirect(w, r, "/login?error=sso_no_account", http.StatusSeeOther)
+		default:
+			http.Redirect(w, r, "/login?error=sso_failed", http.StatusSeeOther)
+		}
+		return
+	}
+
+	pendingSecondFactor, err := beginSession(w, r, user)
+	if err != nil {
+		http.Error(w, "Failed to set session", http.StatusInternalServerError)
+		return
+	}
+
+	target := "/"
+	if pendingSecondFactor && user.TwoFactor.Enabled {
+		target = "/login?second_factor=1"
+	} else if pendingSecondFactor {
+		target = "/2fa"
+	}
+	redirectWithinSite(w, target)
+}
+
+// userForIdentity finds the member an external identity belongs to. An unknown identity is linked
+// to the account with the same email when both sides have verified it, otherwise a new account is
+// created if signups are allowed.
+func userForIdentity(r *http.Request, identity *oidc.Identity) (*models.User, error) {
+	ctx := r.Context()
+	user, err := repo.Users.GetByIdentity(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if identity.Email == "" {
+		return nil, errIdentityNoEmail
+	}
+	now := time.Now()
+	link := models.ExternalIdentity{
+		Issuer:   identity.Issuer,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: now,
+	}
+
+	user, err = repo.Users.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		// an unverified address on either side could let whoever claimed it first into the other account
+		if !identity.EmailVerified || !user.EmailVerified {
+			return nil, errIdentityConflict
+		}
+		user.Identities = append(user.Identities, link)
+		user.UpdatedAt = now
+		if err := repo.Users.Update(ctx, user); err != nil {
+			return nil, err
+		}
+		log.Printf("oidc: linked %s at %s to user %s", identity.Subject, identity.Issuer, user.ID.Hex())
+		return user, nil
+	case !errors.Is(err, store.ErrNotFound):
+		return nil, err
+	}
+
+	if !settings.OIDC.AllowSignup {
+		return nil, errSignupDisabled
+	}
+
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	// the account has no password, the member can set one through the password reset flow
+	user = &models.User{
+		Name:             name,
+		Email:            identity.Email,
+		EmailVerified:    identity.EmailVerified,
+		Role:             models.RoleMember,
+		Identities:       []models.ExternalIdentity{link},
+		MembershipStatus: models.StatusNone,
+		JoinDate:         now,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	if err := assignMemberID(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if err := repo.Users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if !user.EmailVerified {
+		if err := sendVerificationEmail(r, user, user.Email); err != nil {
+			log.Printf("failed to send email verification to user %s: %v", user.ID.Hex(), err)
+		} else if err := repo.Users.Update(ctx, user); err != nil {
+			log.Printf("failed to record verification email for user %s: %v", user.ID.Hex(), err)
+		}
+	}
+	return user, nil
+}
+
+var sameSiteRedirect = template.Must(template.New("redirect").Parse(`<!DOCTYPE html>
+<html><head><meta http-equiv="refresh" content="0;url={{.}}"></head>
+<body><a href="{{.}}">Continue</a></body></html>
+`))
+
+// redirectWithinSite navigates to target from a page of our own. A plain redirect would still
+// count as part of the provider's cross-site navigation, and the SameSite=Strict session cookie
+// that was just set would be left off the next request.
+func redirectWithinSite(w http.ResponseWriter, target string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := sameSiteRedirect.Execute(w, target); err != nil {
+		log.Printf("template execute error: %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"SSE/models"
+	"SSE/oidc"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// stubIdentityProvider vouches for identity and records the login flow values it was given
+type stubIdentityProvider struct {
+	identity oidc.Identity
+
+	state, nonce, verifier string
+	exchanges              int
+	exchangedVerifier      string
+	exchangedNonce         string
+}
+
+func (p *stubIdentityProvider) DisplayName() string { return "Test IdP" }
+
+func (p *stubIdentityProvider) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	p.state, p.nonce, p.verifier = state, nonce, codeVerifier
+	return "https://idp.example/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p *stubIdentityProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*oidc.Identity, error) {
+	p.exchanges++
+	p.exchangedVerifier, p.exchangedNonce = codeVerifier, nonce
+	identity := p.identity
+	return &identity, nil
+}
+
+func TestOIDCCallbackState(t *testing.T) {
+	tests := []struct {
+		name         string
+		state        func(p *stubIdentityProvider) string
+		keepCookie   bool
+		wantRedirect string
+	}{
+		{"matching state", func(p *stubIdentityProvider) string { return p.state }, true, ""},
+		{"state of another login", func(*stubIdentityProvider) string { return "forged" }, true, "/login?error=sso_failed"},
+		{"flow started in another browser", func(p *stubIdentityProvider) string { return p.state }, false, "/login?error=sso_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &stubIdentityProvider{identity: oidc.Identity{Issuer: "https://idp.example", Subject: "user-42"}}
+			env := newTestEnv(t, Dependencies{IdentityProvider: provider})
+			env.createUser(t, models.User{
+				Identities: []models.ExternalIdentity{{Issuer: "https://idp.example", Subject: "user-42"}},
+			})
+
+			login := httptest.NewRecorder()
+			OIDCLogin(login, httptest.NewRequest(http.MethodGet, "/oidc/login", nil))
+			if login.Code != http.StatusFound || !strings.HasPrefix(login.Header().Get("Location"), "https://idp.example/authorize") {
+				t.Fatalf("login answered %d to %q, want a redirect to the provider", login.Code, login.Header().Get("Location"))
+			}
+			var cookies []*http.Cookie
+			if tt.keepCookie {
+				cookies = login.Result().Cookies()
+			}
+
+			callback := httptest.NewRecorder()
+			OIDCCallback(callback, request(http.MethodGet, "/oidc/callback?code=abc&state="+url.QueryEscape(tt.state(provider)), "", cookies))
+
+			if tt.wantRedirect != "" {
+				if callback.Header().Get("Location") != tt.wantRedirect || provider.exchanges != 0 {
+					t.Fatalf("callback redirected to %q after %d exchanges, want %q without exchanging the code",
+						callback.Header().Get("Location"), provider.exchanges, tt.wantRedirect)
+				}
+				return
+			}
+			if callback.Code != http.StatusOK || !strings.Contains(callback.Body.String(), `url=/"`) {
+				t.Fatalf("callback answered %d: %s, want the page continuing to /", callback.Code, callback.Body.String())
+			}
+			if provider.exchangedVerifier != provider.verifier || provider.exchangedNonce != provider.nonce {
+				t.Fatal("code was exchanged without the verifier and nonce of the login it belongs to")
+			}
+		})
+	}
+}
+
+func TestUserForIdentity(t *testing.T) {
+	ctx := context.Background()
+	const issuer = "https://idp.example"
+
+	tests := []struct {
+		name        string
+		existing    *models.User
+		identity    oidc.Identity
+		noSignup    bool
+		wantErr     error
+		wantLinked  bool
+		wantCreated bool
+		wantMails   int
+	}{
+		{
+			name:     "already linked",
+			existing: &models.User{Email: "annabel@example.com", Identities: []models.ExternalIdentity{{Issuer: issuer, Subject: "user-42"}}},
+			identity: oidc.Identity{Issuer: issuer, Subject: "user-42", Email: "someone-else@example.com"},
+		},
+		{
+			name:       "verified email on both sides links the account",
+			existing:   &models.User{Email: "annabel@example.com", EmailVerified: true},
+			identity:   oidc.Identity{Issuer: issuer, Subject: "user-42", Email: "annabel@example.com", EmailVerified: true},
+			wantLinked: true,
+		},
+		{
+			name:     "unverified email at the provider",
+			existing: &models.User{Email: "annabel@example.com", EmailVerified: true},
+			identity: oidc.Identity{Issuer: issuer, Subject: "user-42", Email: "annabel@example.com"},
+			wantErr:  errIdentityConflict,
+		},
+		{
+			name:     "unverified email on the account",
+			existing: &models.User{Email: "annabel@example.com"},
+			identity: oidc.Identity{Issuer: issuer, Subject: "user-42", Email: "annabel@example.com", EmailVerified: true},
+			wantErr:  errIdentityConflict,
+		},
+		{
+			name:     "no email shared",
+			identity: oidc.Identity{Issuer: issuer, Subject: "user-42"},
+			wantErr:  errIdentityNoEmail,
+		},
+		{
+			name:     "unknown identity with signups disabled",
+			identity: oidc.Identity{Issuer: issuer, Subject: "user-42", Email: "new@example.com", EmailVerified: true},
+			noSignup: true,
+			wantErr:  errSignupDisabled,
+		},
+		{
+			name:        "unknown identity signs up",
+			identity:    oidc.Identity{Issuer: issuer, Subject: "user-42", Email: "new@example.com", EmailVerified: true},
+			wantCreated: true,
+		},
+		{
+			name:        "unknown identity with an unverified email signs up and is asked to verify it",
+			identity:    oidc.Identity{Issuer: issuer, Subject: "user-42", Email: "new@example.com"},
+			wantCreated: true,
+			wantMails:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t, Dependencies{})
+			env.cfg.OIDC.AllowSignup = !tt.noSignup
+			var existing *models.User
+			if tt.existing != nil {
+				existing = env.createUser(t, *tt.existing)
+			}
+
+			user, err := userForIdentity(httptest.NewRequest(http.MethodGet, "/oidc/callback", nil), &tt.identity)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("userForIdentity = %v, want %v", err, tt.wantErr)
+			}
+			if existing != nil {
+				stored, _ := env.store.Users.GetByID(ctx, existing.ID)
+				if linked := stored.HasIdentity(issuer, "user-42"); linked != (tt.wantLinked || len(tt.existing.Identities) > 0) {
+					t.Fatalf("identity linked = %v", linked)
+				}
+				if err == nil && user.ID != existing.ID {
+					t.Fatalf("signed in as %s, want the existing account %s", user.ID.Hex(), existing.ID.Hex())
+				}
+			}
+			if tt.wantCreated {
+				stored, err := env.store.Users.GetByIdentity(ctx, issuer, "user-42")
+				if err != nil || stored.ID != user.ID || stored.EmailVerified != tt.identity.EmailVerified || !models.ValidMemberID(stored.MemberID) {
+					t.Fatalf("created %+v (%v), want a member linked to the identity", stored, err)
+				}
+			}
+			if env.mailer.count() != tt.wantMails {
+				t.Fatalf("sent %d emails, want %d", env.mailer.count(), tt.wantMails)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"SSE/auth"
+	"SSE/mail"
+	"SSE/models"
+	"SSE/sessions"
+	"SSE/store"
+	"SSE/web"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// passwordResetSendTimeout bounds the background lookup and send started by ForgotPassword
+const passwordResetSendTimeout = 30 * time.Second
+
+// ForgotPassword shows the request form and, on POST, emails a reset link. The response never
+// reveals whether the email belongs to an account: the lookup and send run in the background so
+// known and unknown addresses answer in the same time.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		web.Render(w, r, "templates/forgot_password.html", nil)
+
+	case http.MethodPost:
+		var requestData struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.Email == "" {
+			http.Error(w, "Email is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), passwordResetSendTimeout)
+		ip := web.ClientIP(r)
+		go func() {
+			defer cancel()
+			if err := sendPasswordReset(ctx, requestData.Email, ip); err != nil {
+				log.Printf("password reset for %s failed: %v", requestData.Email, err)
+			}
+		}()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "If an account exists for that email, a reset link has been sent.",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func sendPasswordReset(ctx context.Context, email, ip string) error {
+	user, err := repo.Users.GetByEmail(ctx, email)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, hash, err := auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	resetToken := &models.PasswordResetToken{
+		ID:        hash,
+		UserID:    user.ID,
+		RequestIP: ip,
+		CreatedAt: now,
+		ExpiresAt: now.Add(settings.Auth.PasswordResetTTL),
+	}
+	if err := repo.PasswordResets.Create(ctx, resetToken); err != nil {
+		return err
+	}
+
+	link := settings.Server.BaseURL + "/password/reset?token=" + url.QueryEscape(token)
+	return mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Fitness Center password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"Open the link below within %s to choose a new one:\n\n%s\n\n"+
+			"If this wasn't you, you can ignore this email and your password will stay the same.\n",
+			user.Name, settings.Auth.PasswordResetTTL, link),
+	})
+}
+
+// ResetPassword shows the new-password form for a token and, on POST, consumes the token,
+// sets the new password and signs the member out everywhere
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		resetToken, err := repo.PasswordResets.Get(r.Context(), auth.HashToken(token))
+		data := struct {
+			Token string
+			Valid bool
+		}{
+			Token: token,
+			Valid: err == nil && resetToken.IsUsable(time.Now()),
+		}
+		web.Render(w, r, "templates/reset_password.html", data)
+
+	case http.MethodPost:
+		var requestData struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if requestData.Password == "" {
+			http.Error(w, "Password is required", http.StatusBadRequest)
+			return
+		}
+
+		hash := auth.HashToken(requestData.Token)
+		resetToken, err := repo.PasswordResets.Get(r.Context(), hash)
+		if err != nil || !resetToken.IsUsable(time.Now()) {
+			http.Error(w, "This reset link is invalid or has expired", http.StatusBadRequest)
+			return
+		}
+
+		user, err := repo.Users.GetByID(r.Context(), resetToken.UserID)
+		if err != nil {
+			http.Error(w, "This reset link is invalid or has expired", http.StatusBadRequest)
+			return
+		}
+
+		// checked before the token is spent so the member can try again with a better password
+		if err := auth.ValidatePassword(requestData.Password, user.Name, user.Email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := repo.PasswordResets.MarkUsed(r.Context(), hash, time.Now()); err != nil {
+			http.Error(w, "This reset link is invalid or has expired", http.StatusBadRequest)
+			return
+		}
+
+		user.Password = requestData.Password
+		if err := user.HashPassword(); err != nil {
+			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
+		user.UpdatedAt = time.Now()
+		if err := repo.Users.Update(r.Context(), user); err != nil {
+			http.Error(w, "Failed to update password", http.StatusInternalServerError)
+			return
+		}
+
+		if err := repo.PasswordResets.DeleteByUser(r.Context(), user.ID); err != nil {
+			log.Printf("failed to clear reset tokens for %s: %v", user.ID.Hex(), err)
+		}
+		if _, err := sessions.RevokeUserSessions(r.Context(), user.ID, ""); err != nil {
+			log.Printf("failed to revoke sessions for %s: %v", user.ID.Hex(), err)
+		}
+		if err := repo.APITokens.DeleteByUser(r.Context(), user.ID); err != nil {
+			log.Printf("failed to revoke API tokens for %s: %v", user.ID.Hex(), err)
+		}
+		sessions.ClearSession(w, r)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Password updated, please log in with your new password"})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
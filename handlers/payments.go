@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"SSE/billing"
+	"SSE/models"
+	"SSE/payments"
+	"SSE/rbac"
+	"SSE/store"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IdempotencyKeyHeader names the header clients use to make purchases and refunds safe to retry
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+const (
+	maxIdempotencyKeyLength = 255
+	// maxWebhookBytes bounds the webhook body read before its signature is checked
+	maxWebhookBytes = 64 << 10
+)
+
+// idempotencyKey reads the request's Idempotency-Key, writing the error response when it is missing
+func idempotencyKey(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		http.Error(w, "Idempotency-Key header is required", http.StatusBadRequest)
+		return "", false
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		http.Error(w, "Idempotency-Key header is too long", http.StatusBadRequest)
+		return "", false
+	}
+	return key, true
+}
+
+// startCheckout creates the payment for user buying plan, or upgrading to it when change is set,
+// or returns the one already created for the request's idempotency key
+func startCheckout(w http.ResponseWriter, r *http.Request, user *models.User, plan *models.MembershipPlan, change *billing.PlanChangeQuote) {
+	key, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	amount := settings.Invoices.ChargeAmount(plan.PriceMinor())
+	description := fmt.Sprintf("%s membership", plan.Name)
+	var planChange *models.PlanChange
+	if change != nil {
+		amount = change.AmountDue
+		description = fmt.Sprintf("Upgrade to %s membership", plan.Name)
+		planChange = change.PlanChange()
+	}
+	if amount <= 0 {
+		http.Error(w, "Membership plan has no price", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	payment := &models.Payment{
+		UserID:         user.ID,
+		PlanID:         plan.ID,
+		Amount:         amount,
+		Currency:       settings.Payments.Currency,
+		IdempotencyKey: key,
+		Provider:       paymentProvider.Name(),
+		Status:         models.PaymentPending,
+		PlanChange:     planChange,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	// inserting the payment claims the key, a concurrent retry gets the payment created here
+	created := true
+	if err := repo.Payments.Create(r.Context(), payment); errors.Is(err, store.ErrDuplicate) {
+		created = false
+		payment, err = repo.Payments.GetByIdempotencyKey(r.Context(), user.ID, key)
+		if err != nil {
+			http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+			return
+		}
+		if payment.PlanID != plan.ID || payment.Amount != amount || (payment.PlanChange == nil) != (planChange == nil) {
+			http.Error(w, "Idempotency-Key was already used for a different purchase", http.StatusUnprocessableEntity)
+			return
+		}
+	} else if err != nil {
+		http.Error(w, "Failed to create payment", http.StatusInternalServerError)
+		return
+	}
+
+	var clientSecret string
+	if payment.Status == models.PaymentPending {
+		// the payment ID is the provider's idempotency key, so a retry after a lost response gets the same intent
+		intent, err := paymentProvider.CreateIntent(r.Context(), payments.IntentRequest{
+			Amount:         payment.Amount,
+			Currency:       payment.Currency,
+			Description:    description,
+			IdempotencyKey: payment.ID.Hex(),
+			Metadata:       map[string]string{"payment_id": payment.ID.Hex(), "user_id": user.ID.Hex()},
+		})
+		if err != nil {
+			log.Printf("Failed to create payment intent for %s: %v", payment.ID.Hex(), err)
+			http.Error(w, "Payment provider is unavailable, please try again", http.StatusBadGateway)
+			return
+		}
+		if payment.IntentID != intent.ID {
+			if err := repo.Payments.SetIntent(r.Context(), payment.ID, intent.ID); err != nil {
+				http.Error(w, "Failed to update payment", http.StatusInternalServerError)
+				return
+			}
+			payment.IntentID = intent.ID
+		}
+		clientSecret = intent.ClientSecret
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"payment":       payment,
+		"plan_name":     plan.Name,
+		"client_secret": clientSecret,
+	})
+}
+
+// ConfirmPayment charges a pending payment with the member's payment method. Confirming a
+// payment that already went through returns it unchanged.
+func ConfirmPayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		PaymentID     string `json:"payment_id"`
+		PaymentMethod string `json:"payment_method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if requestData.PaymentMethod == "" {
+		http.Error(w, "A payment method is required", http.StatusBadRequest)
+		return
+	}
+
+	payment, ok := paymentForRequest(w, r, requestData.PaymentID, rbac.PermManageMembers)
+	if !ok {
+		return
+	}
+
+	switch payment.Status {
+	case models.PaymentPending:
+		if err := billingService.CheckPlanChange(r.Context(), payment); errors.Is(err, billing.ErrStalePlanChange) {
+			http.Error(w, "Membership changed since this upgrade was priced, please start the change again", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to check payment", http.StatusInternalServerError)
+			return
+		}
+		intent, err := paymentProvider.Confirm(r.Context(), payment.IntentID, requestData.PaymentMethod)
+		switch {
+		case errors.Is(err, payments.ErrUnknownIntent):
+			// left pending it would never settle, the provider has no intent to confirm or report on
+			if err := billingService.Abandon(r.Context(), payment); err != nil {
+				log.Printf("Failed to fail payment %s with an unknown intent: %v", payment.ID.Hex(), err)
+			}
+			http.Error(w, "Payment can't be confirmed, start a new purchase", http.StatusConflict)
+			return
+		case errors.Is(err, payments.ErrInvalidState):
+			http.Error(w, "Payment can't be confirmed, start a new purchase", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to confirm payment %s: %v", payment.ID.Hex(), err)
+			http.Error(w, "Payment provider is unavailable, please try again", http.StatusBadGateway)
+			return
+		}
+
+		switch intent.Status {
+		case payments.IntentSucceeded:
+			err = billingService.Complete(r.Context(), payment.ID)
+		case payments.IntentFailed:
+			err = billingService.Fail(r.Context(), payment, intent.FailureReason)
+		}
+		if err != nil {
+			log.Printf("Failed to record outcome of payment %s: %v", payment.ID.Hex(), err)
+			http.Error(w, "Failed to update payment", http.StatusInternalServerError)
+			return
+		}
+	case models.PaymentSucceeded:
+		// finishes a payment whose plan wasn't applied because an earlier attempt was interrupted
+		if err := billingService.Complete(r.Context(), payment.ID); err != nil {
+			http.Error(w, "Failed to update payment", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	payment, err := repo.Payments.GetByID(r.Context(), payment.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	switch payment.Status {
+	case models.PaymentPending:
+		// the provider reports the outcome by webhook
+		status = http.StatusAccepted
+	case models.PaymentFailed:
+		status = http.StatusPaymentRequired
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(payment)
+}
+
+// PaymentWebhook receives the provider's notifications about payments confirmed asynchronously.
+// Deliveries are retried by the provider until they are answered with 2xx, so every event must
+// be safe to handle more than once.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes))
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	event, err := paymentProvider.VerifyWebhook(body, r.Header)
+	if err != nil {
+		log.Printf("Rejected payment webhook: %v", err)
+		http.Error(w, "Invalid webhook signature", http.StatusBadRequest)
+		return
+	}
+
+	payment, err := repo.Payments.GetByIntent(r.Context(), paymentProvider.Name(), event.IntentID)
+	if errors.Is(err, store.ErrNotFound) {
+		// not one of ours, retrying won't change that
+		log.Printf("Ignoring payment webhook %s for unknown intent %s", event.ID, event.IntentID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		return
+	}
+
+	switch event.Type {
+	case payments.EventPaymentSucceeded:
+		if event.Amount != payment.Amount {
+			log.Printf("Payment webhook %s reports %d for payment %s of %d, not applying it", event.ID, event.Amount, payment.ID.Hex(), payment.Amount)
+			break
+		}
+		err = billingService.Complete(r.Context(), payment.ID)
+	case payments.EventPaymentFailed:
+		err = billingService.Fail(r.Context(), payment, event.FailureReason)
+	}
+	if err != nil {
+		log.Printf("Failed to handle payment webhook %s: %v", event.ID, err)
+		http.Error(w, "Failed to handle webhook", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// RefundPayment returns all or part of a succeeded payment to the member. It needs an
+// Idempotency-Key header; the membership itself is left as it is.
+func RefundPayment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key, ok := idempotencyKey(w, r)
+	if !ok {
+		return
+	}
+
+	var requestData struct {
+		PaymentID string `json:"payment_id"`
+		// Amount is in minor units, 0 refunds whatever hasn't been refunded yet
+		Amount int64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	payment, ok := paymentForRequest(w, r, requestData.PaymentID, rbac.PermRefundPayments)
+	if !ok {
+		return
+	}
+	if payment.Status != models.PaymentSucceeded && payment.Status != models.PaymentRefunded {
+		http.Error(w, "Only succeeded payments can be refunded", http.StatusConflict)
+		return
+	}
+
+	amount := requestData.Amount
+	if amount == 0 {
+		amount = payment.Amount - payment.RefundedAmount
+	}
+	if amount < 0 {
+		http.Error(w, "Refund amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	// scoped to the payment so the same key can be reused for refunds of different payments
+	refund, err := paymentProvider.Refund(r.Context(), payment.IntentID, amount, payment.ID.Hex()+":"+key)
+	switch {
+	case errors.Is(err, payments.ErrRefundTooLarge):
+		http.Error(w, "Refund exceeds the amount left to refund", http.StatusBadRequest)
+		return
+	case errors.Is(err, payments.ErrInvalidState), errors.Is(err, payments.ErrUnknownIntent):
+		http.Error(w, "Payment can't be refunded", http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Failed to refund payment %s: %v", payment.ID.Hex(), err)
+		http.Error(w, "Payment provider is unavailable, please try again", http.StatusBadGateway)
+		return
+	}
+
+	payment, err = repo.Payments.AddRefund(r.Context(), payment.ID, models.PaymentRefund{
+		ID:        refund.ID,
+		Amount:    refund.Amount,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		// the money was returned, retrying with the same key records it without refunding again
+		log.Printf("Failed to record refund %s of payment %s: %v", refund.ID, requestData.PaymentID, err)
+		http.Error(w, "Failed to record refund, retry with the same Idempotency-Key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payment)
+}
+
+// ListPayments returns the payments of the signed-in member, or of user_id for staff
+func ListPayments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := resolveTargetUser(w, r, r.URL.Query().Get("user_id"), rbac.PermViewMembers)
+	if !ok {
+		return
+	}
+
+	list, err := repo.Payments.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// paymentForRequest loads the payment with id, which must belong to the acting user unless their
+// role holds permission. On failure the error response has already been written.
+func paymentForRequest(w http.ResponseWriter, r *http.Request, id string, permission rbac.Permission) (*models.Payment, bool) {
+	paymentID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	payment, err := repo.Payments.GetByID(r.Context(), paymentID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if _, ok := resolveTargetUser(w, r, payment.UserID.Hex(), permission); !ok {
+		return nil, false
+	}
+	return payment, true
+}
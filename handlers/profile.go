@@ -1,15 +1,11 @@
 package handlers
 
 import (
-	"SSE/database"
+	"SSE/invoices"
 	"SSE/models"
 	"SSE/sessions"
-	"bytes"
-	"context"
-	"go.mongodb.org/mongo-driver/bson"
+	"SSE/web"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"html/template"
-	"log"
 	"net/http"
 )
 
@@ -32,14 +28,7 @@ func Profile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
-		return
-	}
-
-	var user models.User
-	err = collection.FindOne(context.TODO(), bson.M{"_id": objID}).Decode(&user)
+	user, err := repo.Users.GetByID(r.Context(), objID)
 	if err != nil {
 		// User not found - clear session and redirect to login
 		sessions.ClearSession(w, r)
@@ -49,22 +38,34 @@ func Profile(w http.ResponseWriter, r *http.Request) {
 
 	var membershipPlan models.MembershipPlan
 	if !user.MembershipPlanID.IsZero() {
-		planCollection, err := database.GetCollection("SSE", "membership_plans")
-		if err == nil {
-			planCollection.FindOne(context.TODO(), bson.M{"_id": user.MembershipPlanID}).Decode(&membershipPlan)
+		if plan, err := repo.MembershipPlans.GetByID(r.Context(), user.MembershipPlanID); err == nil {
+			membershipPlan = *plan
 		}
 	}
 
-	tmpl, err := template.ParseFiles("templates/profile.html")
-	if err != nil {
-		log.Printf("template parse error: %v", err)
-		http.Error(w, "Failed to load template: "+err.Error(), http.StatusInternalServerError)
-		return
+	type invoiceSummary struct {
+		ID       string
+		Number   string
+		IssuedAt string
+		Total    string
+	}
+	var invoiceList []invoiceSummary
+	if issued, err := repo.Invoices.ListByUser(r.Context(), user.ID); err == nil {
+		for _, invoice := range issued {
+			invoiceList = append(invoiceList, invoiceSummary{
+				ID:       invoice.ID.Hex(),
+				Number:   invoice.Number,
+				IssuedAt: invoice.IssuedAt.Format("January 2, 2006"),
+				Total:    invoices.FormatAmount(invoice.Total, invoice.Currency),
+			})
+		}
 	}
 
 	data := struct {
 		Name             string
 		Email            string
+		EmailVerified    bool
+		PendingEmail     string
 		ID               string
 		MemberID         string
 		MembershipStatus string
@@ -76,11 +77,15 @@ func Profile(w http.ResponseWriter, r *http.Request) {
 		DaysUntilExpiry  int
 		IsActiveMember   bool
 		HasMembership    bool
+		CanCancel        bool
 		CreatedAt        string
 		UpdatedAt        string
+		Invoices         []invoiceSummary
 	}{
 		Name:             user.Name,
 		Email:            user.Email,
+		EmailVerified:    user.EmailVerified,
+		PendingEmail:     user.PendingEmail,
 		ID:               userID,
 		MemberID:         user.MemberID,
 		MembershipStatus: string(user.MembershipStatus),
@@ -92,17 +97,11 @@ func Profile(w http.ResponseWriter, r *http.Request) {
 		DaysUntilExpiry:  user.DaysUntilExpiry(),
 		IsActiveMember:   user.IsActiveMember(),
 		HasMembership:    !user.MembershipPlanID.IsZero(),
+		CanCancel:        user.MembershipStatus.CanBecome(models.StatusCancelled),
 		CreatedAt:        user.CreatedAt.Format("January 2, 2006 15:04:05"),
 		UpdatedAt:        user.UpdatedAt.Format("January 2, 2006 15:04:05"),
+		Invoices:         invoiceList,
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		log.Printf("template execute error: %v", err)
-		http.Error(w, "Failed to render page: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = buf.WriteTo(w)
+	web.Render(w, r, "templates/profile.html", data)
 }
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"SSE/sessions"
+	"SSE/store"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	active, err := sessions.ListUserSessions(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+		return
+	}
+
+	currentID := sessions.CurrentSessionID(r)
+	type sessionInfo struct {
+		ID         string    `json:"id"`
+		IP         string    `json:"ip"`
+		UserAgent  string    `json:"user_agent"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastSeenAt time.Time `json:"last_seen_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+		Current    bool      `json:"current"`
+	}
+
+	response := make([]sessionInfo, 0, len(active))
+	for _, s := range active {
+		response = append(response, sessionInfo{
+			ID:         s.ID,
+			IP:         s.IP,
+			UserAgent:  s.UserAgent,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.AbsoluteExpiresAt,
+			Current:    s.ID == currentID,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var requestData struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil || requestData.SessionID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if requestData.SessionID == sessions.CurrentSessionID(r) {
+		sessions.ClearSession(w, r)
+	} else if err := sessions.RevokeSession(r.Context(), user.ID, requestData.SessionID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
+
+// RevokeAllSessions signs the member out on every device, including this one
+func RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := sessions.RevokeUserSessions(r.Context(), user.ID, "")
+	if err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	sessions.ClearSession(w, r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"message": "Signed out of all devices", "revoked": revoked})
+}
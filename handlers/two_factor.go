@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"SSE/auth"
+	"SSE/models"
+	"SSE/sessions"
+	"SSE/store"
+	"SSE/web"
+	"context"
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"time"
+)
+
+// twoFactorSubject returns the user managing their second factor. Besides signed-in users this
+// accepts a login that passed the password check, so staff can enroll before their first sign-in.
+func twoFactorSubject(r *http.Request) (user *models.User, pendingLogin bool, err error) {
+	user, err = actingUser(r)
+	if !errors.Is(err, errNoSessionUser) {
+		return user, false, err
+	}
+
+	userID, ok := sessions.PendingLoginUserID(r)
+	if !ok {
+		return nil, false, errNoSessionUser
+	}
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, false, errNoSessionUser
+	}
+	user, err = repo.Users.GetByID(r.Context(), objID)
+	if err != nil {
+		return nil, false, errNoSessionUser
+	}
+	return user, true, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused recovery code. An accepted
+// TOTP step is stored right away, so a code replayed by a concurrent request is rejected. The
+// caller is responsible for persisting a used recovery code.
+func verifySecondFactor(ctx context.Context, user *models.User, code, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return user.TwoFactor.UseRecoveryCode(auth.HashRecoveryCode(recoveryCode)), nil
+	}
+
+	step, ok := auth.ValidateTOTP(user.TwoFactor.Secret, code, time.Now(), user.TwoFactor.LastStep)
+	if !ok {
+		return false, nil
+	}
+	if err := repo.Users.RecordTOTPStep(ctx, user.ID, step); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+	user.TwoFactor.LastStep = step
+	return true, nil
+}
+
+// LoginSecondFactor completes a login started by LoginCustomer once a valid code is supplied
+func LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, pendingLogin, err := twoFactorSubject(r)
+	if err != nil || !pendingLogin {
+		http.Error(w, "No login is waiting for a second factor, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	if !user.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication must be set up before signing in", http.StatusForbidden)
+		return
+	}
+
+	verified, err := verifySecondFactor(r.Context(), user, requestData.Code, requestData.RecoveryCode)
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		rejectSecondFactor(w, r)
+		return
+	}
+
+	if requestData.RecoveryCode != "" {
+		if err := repo.Users.Update(r.Context(), user); err != nil {
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := sessions.SetUserSession(w, r, user.ID.Hex()); err != nil {
+		http.Error(w, "Failed to set session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":             "Login successful",
+		"recovery_codes_left": user.TwoFactor.RecoveryCodesLeft(),
+	})
+}
+
+// rejectSecondFactor answers a wrong code during login, abandoning the login after too many attempts
+func rejectSecondFactor(w http.ResponseWriter, r *http.Request) {
+	remaining, err := sessions.RecordFailedSecondFactor(w, r)
+	if err != nil {
+		http.Error(w, "Failed to update session", http.StatusInternalServerError)
+		return
+	}
+	if !remaining {
+		http.Error(w, "Too many invalid codes, please sign in again", http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+}
+
+// TwoFactorPage shows the enrollment status and setup form
+func TwoFactorPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, pendingLogin, err := twoFactorSubject(r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	web.Render(w, r, "templates/two_factor.html", struct {
+		Enabled           bool
+		Required          bool
+		PendingLogin      bool
+		RecoveryCodesLeft int
+	}{
+		Enabled:           user.TwoFactor.Enabled,
+		Required:          user.EffectiveRole().RequiresTwoFactor(),
+		PendingLogin:      pendingLogin,
+		RecoveryCodesLeft: user.TwoFactor.RecoveryCodesLeft(),
+	})
+}
+
+// BeginTwoFactorSetup generates a new secret and returns it with its provisioning URI
+func BeginTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, _, err := twoFactorSubject(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+
+	user.TwoFactor.PendingSecret = secret
+	user.UpdatedAt = time.Now()
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":           secret,
+		"provisioning_uri": auth.TOTPProvisioningURI(settings.Auth.TOTPIssuer, user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactorSetup enables two-factor authentication once the member enters a code from
+// their app, and returns the recovery codes. This is the only time the codes are shown.
+func ConfirmTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, pendingLogin, err := twoFactorSubject(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.TwoFactor.Enabled || user.TwoFactor.PendingSecret == "" {
+		http.Error(w, "Start two-factor setup first", http.StatusBadRequest)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(user.TwoFactor.PendingSecret, requestData.Code, time.Now(), 0)
+	if !ok {
+		if pendingLogin {
+			rejectSecondFactor(w, r)
+			return
+		}
+		http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	user.TwoFactor = models.TwoFactor{
+		Enabled:       true,
+		Secret:        user.TwoFactor.PendingSecret,
+		LastStep:      step,
+		RecoveryCodes: hashes,
+		EnabledAt:     now,
+	}
+	user.UpdatedAt = now
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	// enrolling proves both factors, so a login waiting on enrollment is now complete
+	if pendingLogin {
+		if err := sessions.SetUserSession(w, r, user.ID.Hex()); err != nil {
+			http.Error(w, "Failed to set session", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, it requires a current TOTP code
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !user.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	verified, err := verifySecondFactor(r.Context(), user, requestData.Code, "")
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		http.Error(w, "Invalid authentication code", http.StatusBadRequest)
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	user.TwoFactor.RecoveryCodes = hashes
+	user.UpdatedAt = time.Now()
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off for roles that don't require it
+func DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var requestData struct {
+		Password string `json:"password"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := actingUser(r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if user.EffectiveRole().RequiresTwoFactor() {
+		http.Error(w, "Two-factor authentication is mandatory for your role", http.StatusForbidden)
+		return
+	}
+	if !user.TwoFactor.Enabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	if !user.CheckPassword(requestData.Password) {
+		http.Error(w, "Invalid password or authentication code", http.StatusBadRequest)
+		return
+	}
+	verified, err := verifySecondFactor(r.Context(), user, requestData.Code, "")
+	if err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+	if !verified {
+		http.Error(w, "Invalid password or authentication code", http.StatusBadRequest)
+		return
+	}
+
+	user.TwoFactor = models.TwoFactor{}
+	user.UpdatedAt = time.Now()
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"SSE/auth"
+	"SSE/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// currentTOTP computes the code an authenticator app shows for secret right now
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decode secret: %v", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff%1000000)
+}
+
+func TestVerifySecondFactorRejectsReplay(t *testing.T) {
+	ctx := context.Background()
+	env := newTestEnv(t, Dependencies{})
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	user := env.createUser(t, models.User{TwoFactor: models.TwoFactor{Enabled: true, Secret: secret}})
+	code := currentTOTP(t, secret)
+
+	// two requests read the user before either accepted the code
+	first, _ := env.store.Users.GetByID(ctx, user.ID)
+	second, _ := env.store.Users.GetByID(ctx, user.ID)
+
+	if verified, err := verifySecondFactor(ctx, first, code, ""); err != nil || !verified {
+		t.Fatalf("first use = %v, %v, want the code accepted", verified, err)
+	}
+	if verified, err := verifySecondFactor(ctx, second, code, ""); err != nil || verified {
+		t.Fatalf("concurrent replay = %v, %v, want the code rejected", verified, err)
+	}
+	if verified, _ := verifySecondFactor(ctx, first, code, ""); verified {
+		t.Fatal("replay after the first use was accepted")
+	}
+
+	stored, _ := env.store.Users.GetByID(ctx, user.ID)
+	if stored.TwoFactor.LastStep != first.TwoFactor.LastStep || stored.TwoFactor.LastStep == 0 {
+		t.Fatalf("stored last step %d, want the accepted step %d", stored.TwoFactor.LastStep, first.TwoFactor.LastStep)
+	}
+}
@@ -1,10 +1,8 @@
 package handlers
 
 import (
-	"SSE/database"
 	"SSE/models"
 	"encoding/json"
-	"go.mongodb.org/mongo-driver/bson"
 	"net/http"
 )
 
@@ -14,27 +12,8 @@ func UpdateMembershipPlans(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "membership_plans")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = collection.DeleteMany(r.Context(), bson.M{})
-	if err != nil {
-		http.Error(w, "Failed to delete existing plans", http.StatusInternalServerError)
-		return
-	}
-
-	defaultPlans := models.GetDefaultPlans()
-	var interfaces []interface{}
-	for _, plan := range defaultPlans {
-		interfaces = append(interfaces, plan)
-	}
-
-	_, err = collection.InsertMany(r.Context(), interfaces)
-	if err != nil {
-		http.Error(w, "Failed to create new plans", http.StatusInternalServerError)
+	if err := repo.MembershipPlans.Sync(r.Context(), models.GetDefaultPlans()); err != nil {
+		http.Error(w, "Failed to update membership plans", http.StatusInternalServerError)
 		return
 	}
 
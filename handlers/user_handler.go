@@ -1,11 +1,15 @@
 package handlers
 
 import (
-	"SSE/database"
+	"SSE/auth"
 	"SSE/models"
+	"SSE/rbac"
+	"SSE/sessions"
+	"SSE/store"
+	"context"
 	"encoding/json"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"errors"
+	"log"
 	"net/http"
 	"time"
 )
@@ -32,57 +36,64 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := auth.ValidatePassword(userData.Password, userData.Name, userData.Email); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	user := models.User{
 		Name:             userData.Name,
 		Email:            userData.Email,
 		Password:         userData.Password,
-		MembershipStatus: models.StatusActive,
+		EmailVerified:    false,
+		Role:             models.RoleMember,
+		MembershipStatus: models.StatusNone,
 		JoinDate:         time.Now(),
 		TotalVisits:      0,
 		CreatedAt:        time.Now(),
 		UpdatedAt:        time.Now(),
 	}
 
-	user.GenerateMemberID()
-
 	if err := user.HashPassword(); err != nil {
 		http.Error(w, "Failed to hash password: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	collection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Error(w, "Failed to get database collection: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var existingUser models.User
-	err = collection.FindOne(r.Context(), bson.M{"email": user.Email}).Decode(&existingUser)
-	if err == nil {
-		http.Error(w, "User with this email already exists", http.StatusConflict)
+	if err := assignMemberID(r.Context(), &user); err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
 		return
 	}
 
-	result, err := collection.InsertOne(r.Context(), user)
-	if err != nil {
+	if err := repo.Users.Create(r.Context(), &user); err != nil {
+		if errors.Is(err, store.ErrDuplicate) {
+			http.Error(w, "User with this email already exists", http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to create user: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	user.ID = result.InsertedID.(primitive.ObjectID)
+	// the account is usable without the email, it just can't buy a membership until verified
+	if err := sendVerificationEmail(r, &user, user.Email); err != nil {
+		log.Printf("failed to send email verification to user %s: %v", user.ID.Hex(), err)
+	} else if err := repo.Users.Update(r.Context(), &user); err != nil {
+		log.Printf("failed to record verification email for user %s: %v", user.ID.Hex(), err)
+	}
 
 	responseUser := struct {
-		ID        string    `json:"id"`
-		Name      string    `json:"name"`
-		Email     string    `json:"email"`
-		CreatedAt time.Time `json:"created_at"`
-		UpdatedAt time.Time `json:"updated_at"`
+		ID            string    `json:"id"`
+		Name          string    `json:"name"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+		CreatedAt     time.Time `json:"created_at"`
+		UpdatedAt     time.Time `json:"updated_at"`
 	}{
-		ID:        user.ID.Hex(),
-		Name:      user.Name,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+		ID:            user.ID.Hex(),
+		Name:          user.Name,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -90,33 +101,20 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(responseUser)
 }
 
-func GetUser(w http.ResponseWriter, r *http.Request) {
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
-	}
-
-	objectID, err := primitive.ObjectIDFromHex(userID)
+// assignMemberID gives user the next member number, numbers come from a shared counter so no two
+// members ever get the same one
+func assignMemberID(ctx context.Context, user *models.User) error {
+	number, err := repo.Counters.Next(ctx, models.MemberIDCounter)
 	if err != nil {
-		http.Error(w, "Invalid customer ID format", http.StatusBadRequest)
-		return
-	}
-
-	collection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
-		return
+		return err
 	}
+	user.MemberID = models.FormatMemberID(user.JoinDate.Year(), number)
+	return nil
+}
 
-	var user models.User
-	err = collection.FindOne(r.Context(), bson.M{"_id": objectID}).Decode(&user)
-	if err != nil {
-		if err.Error() == "mongo: no documents in result" {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, "Error retrieving customer", http.StatusInternalServerError)
-		}
+func GetUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := resolveTargetUser(w, r, r.URL.Query().Get("user_id"), rbac.PermViewMembers)
+	if !ok {
 		return
 	}
 
@@ -130,18 +128,6 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
-	}
-
-	objectID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
-		return
-	}
-
 	var updateData struct {
 		Name     string `json:"name"`
 		Password string `json:"password"`
@@ -153,87 +139,114 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updateFields := bson.M{}
+	if updateData.Name == "" && updateData.Email == "" && updateData.Password == "" {
+		http.Error(w, "No fields to update", http.StatusBadRequest)
+		return
+	}
 
-	if updateData.Name != "" {
-		updateFields["name"] = updateData.Name
+	user, ok := resolveTargetUser(w, r, r.URL.Query().Get("user_id"), rbac.PermManageMembers)
+	if !ok {
+		return
 	}
 
-	if updateData.Email != "" {
-		updateFields["email"] = updateData.Email
+	if updateData.Name != "" {
+		user.Name = updateData.Name
 	}
 
 	if updateData.Password != "" {
-		tempUser := models.User{Password: updateData.Password}
-		if err := tempUser.HashPassword(); err != nil {
-			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		email := user.Email
+		if updateData.Email != "" {
+			email = updateData.Email
+		}
+		if err := auth.ValidatePassword(updateData.Password, user.Name, email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		updateFields["password"] = tempUser.Password
 	}
 
-	if len(updateFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
-		return
+	if updateData.Email != "" && updateData.Email != user.Email {
+		if err := requestEmailChange(r, user, updateData.Email); err != nil {
+			if errors.Is(err, errEmailTaken) {
+				http.Error(w, "User with this email already exists", http.StatusConflict)
+				return
+			}
+			http.Error(w, "Failed to send confirmation email", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	updateFields["updatedat"] = time.Now()
-
-	collection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
-		return
+	if updateData.Password != "" {
+		user.Password = updateData.Password
+		if err := user.HashPassword(); err != nil {
+			http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	result, err := collection.UpdateOne(r.Context(), bson.M{"_id": objectID}, bson.M{"$set": updateFields})
-	if err != nil {
-		http.Error(w, "Failed to update user", http.StatusInternalServerError)
-		return
-	}
+	user.UpdatedAt = time.Now()
 
-	if result.MatchedCount == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if err := repo.Users.Update(r.Context(), user); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			http.Error(w, "User not found", http.StatusNotFound)
+		case errors.Is(err, store.ErrDuplicate):
+			http.Error(w, "User with this email already exists", http.StatusConflict)
+		default:
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+		}
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "User updated successfully"})
+	response := map[string]string{"message": "User updated successfully"}
+	if user.PendingEmail != "" {
+		response["pending_email"] = user.PendingEmail
+	}
+	json.NewEncoder(w).Encode(response)
 }
 
+// DeleteUser removes an account with its sessions, API tokens, visits and membership history.
+// Only staff who may delete users reach it.
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	userID := r.URL.Query().Get("user_id")
-	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	user, ok := resolveTargetUser(w, r, r.URL.Query().Get("user_id"), rbac.PermDeleteUsers)
+	if !ok {
 		return
 	}
 
-	objectID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		http.Error(w, "Invalid customer ID format", http.StatusBadRequest)
-		return
-	}
+	actor, _ := actingUser(r)
+	deletingSelf := actor != nil && actor.ID == user.ID
 
-	collection, err := database.GetCollection("SSE", "users")
-	if err != nil {
-		http.Error(w, "Failed to get database collection", http.StatusInternalServerError)
+	if err := repo.Users.Delete(r.Context(), user.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, "User not found", http.StatusNotFound)
+		} else {
+			http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		}
 		return
 	}
 
-	result, err := collection.DeleteOne(r.Context(), bson.M{"_id": objectID})
-	if err != nil {
-		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
-		return
+	if _, err := sessions.RevokeUserSessions(r.Context(), user.ID, ""); err != nil {
+		log.Printf("failed to revoke sessions of user %s: %v", user.ID.Hex(), err)
 	}
-
-	if result.DeletedCount == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
+	if err := repo.APITokens.DeleteByUser(r.Context(), user.ID); err != nil {
+		log.Printf("failed to delete API tokens of user %s: %v", user.ID.Hex(), err)
+	}
+	// payments and invoices are kept, they are accounting records
+	if err := repo.Visits.DeleteByUser(r.Context(), user.ID); err != nil {
+		log.Printf("failed to delete visits of user %s: %v", user.ID.Hex(), err)
+	}
+	if err := repo.MembershipHistory.DeleteByUser(r.Context(), user.ID); err != nil {
+		log.Printf("failed to delete membership history of user %s: %v", user.ID.Hex(), err)
+	}
+	tracker.Notify()
+	if deletingSelf {
+		sessions.ClearSession(w, r)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
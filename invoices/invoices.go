@@ -0,0 +1,191 @@
+// Package invoices builds the invoices issued for membership charges and renders them as receipts.
+// Amounts are in minor units of the currency, like everywhere in payments.
+package invoices
+
+import (
+	"SSE/models"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Config describes the seller and how VAT is charged
+type Config struct {
+	// NumberPrefix starts every invoice number, numbering restarts each year
+	NumberPrefix string    `yaml:"number_prefix"`
+	Seller       Seller    `yaml:"seller"`
+	VAT          VATConfig `yaml:"vat"`
+}
+
+type Seller struct {
+	Name string `yaml:"name"`
+	// BIN is the business identification number printed on invoices
+	BIN     string `yaml:"bin"`
+	Address string `yaml:"address"`
+}
+
+// VATConfig is off for sellers that aren't registered for VAT
+type VATConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Rate is in percent
+	Rate float64 `yaml:"rate"`
+	// PricesIncludeVAT is true when plan prices already contain VAT, otherwise it is added on top
+	PricesIncludeVAT bool `yaml:"prices_include_vat"`
+}
+
+// ChargeAmount is what a member pays for a plan priced at price
+func (c Config) ChargeAmount(price int64) int64 {
+	if !c.VAT.Enabled || c.VAT.PricesIncludeVAT {
+		return price
+	}
+	return price + int64(math.Round(float64(price)*c.VAT.Rate/100))
+}
+
+// CounterName names the counter invoice numbers of year are allocated from
+func CounterName(year int) string {
+	return fmt.Sprintf("invoice_%d", year)
+}
+
+// Number formats the sequence number of an invoice issued in year
+func (c Config) Number(year int, sequence int64) string {
+	return fmt.Sprintf("%s-%d-%06d", c.NumberPrefix, year, sequence)
+}
+
+// Period is the membership time an invoice pays for
+type Period struct {
+	Start, End time.Time
+	// Renewal is true when it extends a membership of the same plan
+	Renewal bool
+	// FromPlan is the plan upgraded from when the payment is a prorated upgrade
+	FromPlan *models.MembershipPlan
+}
+
+// Build returns the invoice numbered number for payment, which bought plan for member. The total
+// is always the amount charged; with VAT enabled the VAT included in it is split out.
+func (c Config) Build(number string, payment *models.Payment, plan *models.MembershipPlan, member *models.User, period Period, issuedAt time.Time) *models.Invoice {
+	var rate float64
+	if c.VAT.Enabled {
+		rate = c.VAT.Rate
+	}
+
+	kind := models.InvoicePurchase
+	var lines []models.InvoiceLine
+	if change := payment.PlanChange; change != nil && period.FromPlan != nil {
+		kind = models.InvoiceUpgrade
+		days := fmt.Sprintf("%d of %d days", change.RemainingDays, change.PeriodDays)
+		lines = []models.InvoiceLine{
+			invoiceLine(plan.Name+" membership, "+days, plan.ID, change.Charge, rate),
+			invoiceLine("Unused "+period.FromPlan.Name+" membership, "+days, period.FromPlan.ID, -change.Credit, rate),
+		}
+	} else {
+		if period.Renewal {
+			kind = models.InvoiceRenewal
+		}
+		lines = []models.InvoiceLine{invoiceLine(lineDescription(plan, kind), plan.ID, payment.Amount, rate)}
+	}
+
+	var net, vat int64
+	for _, line := range lines {
+		net += line.NetAmount
+		vat += line.VATAmount
+	}
+
+	return &models.Invoice{
+		Number:    number,
+		UserID:    member.ID,
+		PaymentID: payment.ID,
+		Kind:      kind,
+		Seller: models.InvoiceSeller{
+			Name:    c.Seller.Name,
+			BIN:     c.Seller.BIN,
+			Address: c.Seller.Address,
+		},
+		Customer: models.InvoiceCustomer{
+			Name:     member.Name,
+			Email:    member.Email,
+			MemberID: member.MemberID,
+		},
+		Lines:       lines,
+		Currency:    payment.Currency,
+		VATRate:     rate,
+		Subtotal:    net,
+		VATAmount:   vat,
+		Total:       payment.Amount,
+		PeriodStart: period.Start,
+		PeriodEnd:   period.End,
+		IssuedAt:    issuedAt,
+	}
+}
+
+// invoiceLine is one line totalling total, VAT is worked back from it so the lines always add up
+// to what was charged
+func invoiceLine(description string, planID primitive.ObjectID, total int64, rate float64) models.InvoiceLine {
+	vat := int64(math.Round(float64(total) * rate / (100 + rate)))
+	return models.InvoiceLine{
+		Description: description,
+		PlanID:      planID,
+		Quantity:    1,
+		NetAmount:   total - vat,
+		VATAmount:   vat,
+		Total:       total,
+	}
+}
+
+func lineDescription(plan *models.MembershipPlan, kind models.InvoiceKind) string {
+	months := "months"
+	if plan.Duration == 1 {
+		months = "month"
+	}
+	description := fmt.Sprintf("%s membership, %d %s", plan.Name, plan.Duration, months)
+	if kind == models.InvoiceRenewal {
+		description += " (renewal)"
+	}
+	return description
+}
+
+// currencySymbols are printed after amounts instead of the ISO code
+var currencySymbols = map[string]string{
+	"KZT": "₸",
+}
+
+// FormatAmount formats an amount in minor units the way it is written in Kazakhstan, with spaces
+// between thousands and a decimal comma: 13 499,00 ₸
+func FormatAmount(amount int64, currency string) string {
+	symbol, ok := currencySymbols[currency]
+	if !ok {
+		symbol = currency
+	}
+	return formatNumber(amount) + "\u00a0" + symbol
+}
+
+// FormatAmountCode is FormatAmount with the ISO code, for output without the currency glyphs
+func FormatAmountCode(amount int64, currency string) string {
+	return formatNumber(amount) + "\u00a0" + currency
+}
+
+func formatNumber(amount int64) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	whole := fmt.Sprintf("%d", amount/100)
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			// a non-breaking space keeps the amount on one line
+			grouped.WriteString("\u00a0")
+		}
+		grouped.WriteRune(digit)
+	}
+	return fmt.Sprintf("%s%s,%02d", sign, grouped.String(), amount%100)
+}
+
+// FormatRate formats a VAT rate in percent without trailing zeros, e.g. 12%
+func FormatRate(rate float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", rate), "0"), ".") + "%"
+}
@@ -0,0 +1,149 @@
+package invoices
+
+import (
+	"SSE/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestChargeAmount(t *testing.T) {
+	tests := []struct {
+		name  string
+		vat   VATConfig
+		price int64
+		want  int64
+	}{
+		{"VAT disabled", VATConfig{Rate: 12}, 1500000, 1500000},
+		{"VAT included in prices", VATConfig{Enabled: true, Rate: 12, PricesIncludeVAT: true}, 1500000, 1500000},
+		{"VAT added on top", VATConfig{Enabled: true, Rate: 12}, 1500000, 1680000},
+		{"VAT added on top rounds up", VATConfig{Enabled: true, Rate: 12}, 999, 1119},
+		{"VAT added on top rounds down", VATConfig{Enabled: true, Rate: 12}, 1001, 1121},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Config{VAT: tt.vat}).ChargeAmount(tt.price); got != tt.want {
+				t.Fatalf("ChargeAmount(%d) = %d, want %d", tt.price, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildSplitsVAT(t *testing.T) {
+	basic := &models.MembershipPlan{ID: primitive.NewObjectID(), Name: "Basic", Duration: 1}
+	premium := &models.MembershipPlan{ID: primitive.NewObjectID(), Name: "Premium", Duration: 3}
+	member := &models.User{ID: primitive.NewObjectID(), Name: "Annabel Lee", Email: "annabel@example.com"}
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	upgrade := &models.PlanChange{FromPlanID: basic.ID, RemainingDays: 20, PeriodDays: 30, Charge: 1000000, Credit: 400000}
+
+	tests := []struct {
+		name      string
+		vat       VATConfig
+		plan      *models.MembershipPlan
+		amount    int64
+		change    *models.PlanChange
+		period    Period
+		wantKind  models.InvoiceKind
+		wantNet   []int64
+		wantVAT   []int64
+		wantLine0 string
+	}{
+		{
+			name: "no VAT", vat: VATConfig{Rate: 12}, plan: basic, amount: 1500000,
+			wantKind: models.InvoicePurchase, wantNet: []int64{1500000}, wantVAT: []int64{0},
+			wantLine0: "Basic membership, 1 month",
+		},
+		{
+			name: "VAT included", vat: VATConfig{Enabled: true, Rate: 16, PricesIncludeVAT: true}, plan: premium, amount: 1500000,
+			wantKind: models.InvoicePurchase, wantNet: []int64{1293103}, wantVAT: []int64{206897},
+			wantLine0: "Premium membership, 3 months",
+		},
+		{
+			name: "VAT added on top", vat: VATConfig{Enabled: true, Rate: 12}, plan: basic, amount: 1680000,
+			period:   Period{Renewal: true},
+			wantKind: models.InvoiceRenewal, wantNet: []int64{1500000}, wantVAT: []int64{180000},
+			wantLine0: "Basic membership, 1 month (renewal)",
+		},
+		{
+			name: "upgrade with credit", vat: VATConfig{Enabled: true, Rate: 12, PricesIncludeVAT: true}, plan: premium, amount: 600000,
+			change: upgrade, period: Period{FromPlan: basic},
+			wantKind: models.InvoiceUpgrade, wantNet: []int64{892857, -357143}, wantVAT: []int64{107143, -42857},
+			wantLine0: "Premium membership, 20 of 30 days",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := &models.Payment{ID: primitive.NewObjectID(), Amount: tt.amount, Currency: "KZT", PlanChange: tt.change}
+			invoice := Config{VAT: tt.vat}.Build("INV-2026-000001", payment, tt.plan, member, tt.period, now)
+
+			if invoice.Kind != tt.wantKind {
+				t.Fatalf("kind = %s, want %s", invoice.Kind, tt.wantKind)
+			}
+			if len(invoice.Lines) != len(tt.wantNet) {
+				t.Fatalf("got %d lines, want %d", len(invoice.Lines), len(tt.wantNet))
+			}
+			if invoice.Lines[0].Description != tt.wantLine0 {
+				t.Fatalf("first line = %q, want %q", invoice.Lines[0].Description, tt.wantLine0)
+			}
+
+			var net, vat, total int64
+			for i, line := range invoice.Lines {
+				if line.NetAmount != tt.wantNet[i] || line.VATAmount != tt.wantVAT[i] {
+					t.Fatalf("line %d = net %d VAT %d, want net %d VAT %d", i, line.NetAmount, line.VATAmount, tt.wantNet[i], tt.wantVAT[i])
+				}
+				if line.NetAmount+line.VATAmount != line.Total {
+					t.Fatalf("line %d: net %d + VAT %d != total %d", i, line.NetAmount, line.VATAmount, line.Total)
+				}
+				net += line.NetAmount
+				vat += line.VATAmount
+				total += line.Total
+			}
+			if invoice.Subtotal != net || invoice.VATAmount != vat {
+				t.Fatalf("invoice subtotal %d VAT %d, lines add up to %d and %d", invoice.Subtotal, invoice.VATAmount, net, vat)
+			}
+			if invoice.Total != tt.amount || total != tt.amount {
+				t.Fatalf("invoice total %d and lines total %d, want the charged %d", invoice.Total, total, tt.amount)
+			}
+		})
+	}
+}
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		currency string
+		want     string
+	}{
+		{1349900, "KZT", "13\u00a0499,00\u00a0₸"},
+		{123456789, "KZT", "1\u00a0234\u00a0567,89\u00a0₸"},
+		{5, "KZT", "0,05\u00a0₸"},
+		{-400000, "KZT", "-4\u00a0000,00\u00a0₸"},
+		{1234, "USD", "12,34\u00a0USD"},
+	}
+	for _, tt := range tests {
+		if got := FormatAmount(tt.amount, tt.currency); got != tt.want {
+			t.Errorf("FormatAmount(%d, %s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestFormatRateAndNumber(t *testing.T) {
+	rates := []struct {
+		rate float64
+		want string
+	}{
+		{12, "12%"},
+		{12.5, "12.5%"},
+		{0, "0%"},
+	}
+	for _, tt := range rates {
+		if got := FormatRate(tt.rate); got != tt.want {
+			t.Errorf("FormatRate(%v) = %q, want %q", tt.rate, got, tt.want)
+		}
+	}
+
+	if got := (Config{NumberPrefix: "INV"}).Number(2026, 42); got != "INV-2026-000042" {
+		t.Errorf("Number = %q, want INV-2026-000042", got)
+	}
+}
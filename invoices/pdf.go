@@ -0,0 +1,104 @@
+package invoices
+
+import (
+	"SSE/models"
+	"io"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+const pdfFont = "Go"
+
+// WritePDF renders invoice as an A4 PDF receipt. The embedded Go fonts cover Latin and Cyrillic
+// names but have no tenge sign, so amounts carry the currency code.
+func WritePDF(w io.Writer, invoice *models.Invoice) error {
+	receipt := NewReceipt(invoice, FormatAmountCode)
+
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddUTF8FontFromBytes(pdfFont, "", goregular.TTF)
+	pdf.AddUTF8FontFromBytes(pdfFont, "B", gobold.TTF)
+	pdf.SetTitle("Invoice "+receipt.Number, true)
+	pdf.SetAuthor(receipt.Seller.Name, true)
+	pdf.SetMargins(20, 20, 20)
+	pdf.AddPage()
+
+	pdf.SetFont(pdfFont, "B", 18)
+	pdf.CellFormat(0, 10, "Invoice "+receipt.Number, "", 1, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 10)
+	pdf.CellFormat(0, 6, "Issued "+receipt.IssuedAt, "", 1, "L", false, 0, "")
+	pdf.Ln(6)
+
+	top := pdf.GetY()
+	writeParty(pdf, 20, top, "Seller", receipt.Seller.Name, labelled("BIN", receipt.Seller.BIN), receipt.Seller.Address)
+	writeParty(pdf, 110, top, "Customer", receipt.Customer.Name, receipt.Customer.Email, labelled("Member ID", receipt.Customer.MemberID))
+	pdf.SetXY(20, top+32)
+
+	pdf.SetFont(pdfFont, "", 10)
+	pdf.CellFormat(0, 6, "Membership period "+receipt.PeriodStart+" - "+receipt.PeriodEnd, "", 1, "L", false, 0, "")
+	pdf.Ln(4)
+
+	widths := []float64{80, 12, 26, 26, 26}
+	pdf.SetFont(pdfFont, "B", 10)
+	pdf.SetFillColor(240, 240, 240)
+	for i, heading := range []string{"Description", "Qty", "Net", "VAT", "Total"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 8, heading, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont(pdfFont, "", 10)
+	for _, line := range receipt.Lines {
+		pdf.CellFormat(widths[0], 8, line.Description, "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 8, line.Quantity, "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 8, line.NetAmount, "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 8, line.VATAmount, "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[4], 8, line.Total, "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(4)
+
+	writeTotal(pdf, "Subtotal", receipt.Subtotal, false)
+	if receipt.HasVAT {
+		writeTotal(pdf, "VAT "+receipt.VATRate, receipt.VATAmount, false)
+	} else {
+		writeTotal(pdf, "VAT", "not charged", false)
+	}
+	writeTotal(pdf, "Total paid", receipt.Total, true)
+
+	return pdf.Output(w)
+}
+
+// writeParty writes a heading and the non-empty lines below it in a column starting at x, y
+func writeParty(pdf *fpdf.Fpdf, x, y float64, heading string, lines ...string) {
+	pdf.SetXY(x, y)
+	pdf.SetFont(pdfFont, "B", 10)
+	pdf.CellFormat(80, 6, heading, "", 2, "L", false, 0, "")
+	pdf.SetFont(pdfFont, "", 10)
+	for _, line := range lines {
+		if line != "" {
+			pdf.CellFormat(80, 5, line, "", 2, "L", false, 0, "")
+		}
+	}
+}
+
+func writeTotal(pdf *fpdf.Fpdf, label, amount string, bold bool) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	pdf.SetFont(pdfFont, style, 10)
+	pdf.CellFormat(144, 7, label, "", 0, "R", false, 0, "")
+	pdf.CellFormat(26, 7, amount, "", 1, "R", false, 0, "")
+}
+
+// labelled returns "label: value", or "" when there is no value
+func labelled(label, value string) string {
+	if value == "" {
+		return ""
+	}
+	return label + ": " + value
+}
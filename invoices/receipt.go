@@ -0,0 +1,64 @@
+package invoices
+
+import (
+	"SSE/models"
+	"strconv"
+)
+
+// dateLayout is how dates are written on receipts
+const dateLayout = "02.01.2006"
+
+// Receipt is an invoice with its amounts and dates formatted for display
+type Receipt struct {
+	Number      string
+	Renewal     bool
+	Upgrade     bool
+	IssuedAt    string
+	PeriodStart string
+	PeriodEnd   string
+	Seller      models.InvoiceSeller
+	Customer    models.InvoiceCustomer
+	Lines       []ReceiptLine
+	HasVAT      bool
+	VATRate     string
+	Subtotal    string
+	VATAmount   string
+	Total       string
+}
+
+type ReceiptLine struct {
+	Description string
+	Quantity    string
+	NetAmount   string
+	VATAmount   string
+	Total       string
+}
+
+// NewReceipt formats invoice, amounts are written with format, FormatAmount or FormatAmountCode
+func NewReceipt(invoice *models.Invoice, format func(amount int64, currency string) string) Receipt {
+	receipt := Receipt{
+		Number:      invoice.Number,
+		Renewal:     invoice.Kind == models.InvoiceRenewal,
+		Upgrade:     invoice.Kind == models.InvoiceUpgrade,
+		IssuedAt:    invoice.IssuedAt.Local().Format(dateLayout),
+		PeriodStart: invoice.PeriodStart.Local().Format(dateLayout),
+		PeriodEnd:   invoice.PeriodEnd.Local().Format(dateLayout),
+		Seller:      invoice.Seller,
+		Customer:    invoice.Customer,
+		HasVAT:      invoice.VATRate > 0,
+		VATRate:     FormatRate(invoice.VATRate),
+		Subtotal:    format(invoice.Subtotal, invoice.Currency),
+		VATAmount:   format(invoice.VATAmount, invoice.Currency),
+		Total:       format(invoice.Total, invoice.Currency),
+	}
+	for _, line := range invoice.Lines {
+		receipt.Lines = append(receipt.Lines, ReceiptLine{
+			Description: line.Description,
+			Quantity:    strconv.Itoa(line.Quantity),
+			NetAmount:   format(line.NetAmount, invoice.Currency),
+			VATAmount:   format(line.VATAmount, invoice.Currency),
+			Total:       format(line.Total, invoice.Currency),
+		})
+	}
+	return receipt
+}
@@ -0,0 +1,167 @@
+// Package loginguard slows down password guessing by counting failed credential checks per
+// account and per client IP, delaying further attempts exponentially and eventually locking out.
+package loginguard
+
+import (
+	"SSE/config"
+	"SSE/models"
+	"SSE/store"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// maxShift keeps the exponential delay from overflowing before MaxDelay caps it
+const maxShift = 30
+
+// Attempt describes one credential check
+type Attempt struct {
+	Scope string
+	// Account is the normalised email the check was for, "" when it isn't known
+	Account   string
+	IP        string
+	UserAgent string
+}
+
+// Guard decides whether a credential check may proceed and records its outcome
+type Guard struct {
+	cfg       config.LoginGuardConfig
+	throttles store.LoginThrottleRepository
+	attempts  store.LoginAttemptRepository
+	now       func() time.Time
+}
+
+func New(cfg config.LoginGuardConfig, throttles store.LoginThrottleRepository, attempts store.LoginAttemptRepository) *Guard {
+	return &Guard{cfg: cfg, throttles: throttles, attempts: attempts, now: time.Now}
+}
+
+// NormalizeAccount gives every spelling of an email address the same counter
+func NormalizeAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Check returns how long the attempt must wait before it may be made, 0 if it may proceed now
+func (g *Guard) Check(ctx context.Context, attempt Attempt) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range g.keys(attempt) {
+		throttle, err := g.throttles.Get(ctx, key.ThrottleKey)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if w := g.waitFor(throttle, key.policy); w > wait {
+			wait = w
+		}
+	}
+	return wait, nil
+}
+
+// Failure counts a failed attempt, locks out keys that crossed their threshold and writes the audit record
+func (g *Guard) Failure(ctx context.Context, attempt Attempt, status int) error {
+	now := g.now()
+	record := models.LoginAttempt{
+		Scope:     attempt.Scope,
+		Account:   attempt.Account,
+		IP:        attempt.IP,
+		UserAgent: attempt.UserAgent,
+		Status:    status,
+		CreatedAt: now,
+	}
+
+	for _, key := range g.keys(attempt) {
+		throttle, err := g.throttles.RecordFailure(ctx, key.ThrottleKey, now, now.Add(g.cfg.Window))
+		if err != nil {
+			return err
+		}
+
+		threshold := key.policy.LockoutThreshold
+		if threshold == 0 || throttle.Failures < threshold || now.Before(throttle.LockedUntil) {
+			continue
+		}
+		if err := g.throttles.Lock(ctx, key.ThrottleKey, now.Add(key.policy.LockoutDuration)); err != nil {
+			return err
+		}
+		log.Printf("login guard: locked %s %q for %s after %d failures", key.Kind, key.Subject, key.policy.LockoutDuration, throttle.Failures)
+		if key.Kind == models.ThrottleAccount {
+			record.Locked = true
+		}
+	}
+
+	return g.attempts.Create(ctx, &record)
+}
+
+// Success clears the account's failures in the attempt's scope. IP counters are left alone so
+// signing in to one account can't be used to keep guessing at others.
+func (g *Guard) Success(ctx context.Context, attempt Attempt) error {
+	if attempt.Account == "" {
+		return nil
+	}
+	return g.throttles.Delete(ctx, models.ThrottleKey{Scope: attempt.Scope, Kind: models.ThrottleAccount, Subject: attempt.Account})
+}
+
+// Unlock clears every failure counter and lockout of account, reporting whether there were any
+func (g *Guard) Unlock(ctx context.Context, account string) (bool, error) {
+	deleted, err := g.throttles.DeleteBySubject(ctx, models.ThrottleAccount, NormalizeAccount(account))
+	return deleted > 0, err
+}
+
+// RecentFailures returns the newest failed attempts, for every account when account is ""
+func (g *Guard) RecentFailures(ctx context.Context, account string, limit int) ([]models.LoginAttempt, error) {
+	return g.attempts.ListRecent(ctx, NormalizeAccount(account), limit)
+}
+
+type policyKey struct {
+	models.ThrottleKey
+	policy config.ThrottlePolicy
+}
+
+func (g *Guard) keys(attempt Attempt) []policyKey {
+	var keys []policyKey
+	if attempt.Account != "" {
+		keys = append(keys, policyKey{
+			ThrottleKey: models.ThrottleKey{Scope: attempt.Scope, Kind: models.ThrottleAccount, Subject: attempt.Account},
+			policy:      g.cfg.Account,
+		})
+	}
+	if attempt.IP != "" {
+		keys = append(keys, policyKey{
+			ThrottleKey: models.ThrottleKey{Scope: attempt.Scope, Kind: models.ThrottleIP, Subject: attempt.IP},
+			policy:      g.cfg.IP,
+		})
+	}
+	return keys
+}
+
+func (g *Guard) waitFor(throttle *models.LoginThrottle, policy config.ThrottlePolicy) time.Duration {
+	now := g.now()
+	if now.Before(throttle.LockedUntil) {
+		return throttle.LockedUntil.Sub(now)
+	}
+
+	ready := throttle.LastFailureAt.Add(backoff(policy, throttle.Failures))
+	if now.Before(ready) {
+		return ready.Sub(now)
+	}
+	return 0
+}
+
+// backoff is the wait required after failures failed attempts: nothing for the free attempts,
+// then BaseDelay doubling with every further failure up to MaxDelay
+func backoff(policy config.ThrottlePolicy, failures int) time.Duration {
+	over := failures - policy.FreeAttempts
+	if over <= 0 || policy.BaseDelay <= 0 {
+		return 0
+	}
+	if over > maxShift {
+		return policy.MaxDelay
+	}
+	delay := policy.BaseDelay << (over - 1)
+	if delay > policy.MaxDelay || delay <= 0 {
+		return policy.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,258 @@
+package loginguard
+
+import (
+	"SSE/config"
+	"SSE/store"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testPolicy allows 3 free failures, then waits 1s, 2s and 4s, and locks out at the 6th failure
+var testPolicy = config.ThrottlePolicy{
+	FreeAttempts:     3,
+	BaseDelay:        time.Second,
+	MaxDelay:         4 * time.Second,
+	LockoutThreshold: 6,
+	LockoutDuration:  30 * time.Minute,
+}
+
+// newTestGuard is a guard on the memory store whose clock reads *now. The memory store expires
+// counters against the wall clock, so tests start their clock at it.
+func newTestGuard(now *time.Time) *Guard {
+	appStore := store.NewMemoryStore()
+	ipPolicy := testPolicy
+	ipPolicy.FreeAttempts = 5
+	ipPolicy.LockoutThreshold = 0
+	guard := New(config.LoginGuardConfig{Window: time.Hour, Account: testPolicy, IP: ipPolicy}, appStore.LoginThrottles, appStore.LoginAttempts)
+	guard.now = func() time.Time { return *now }
+	return guard
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{6, 4 * time.Second},
+		{7, 4 * time.Second},
+		{100, 4 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := backoff(testPolicy, tt.failures); got != tt.want {
+			t.Errorf("backoff after %d failures = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+
+	if got := backoff(config.ThrottlePolicy{FreeAttempts: 1, MaxDelay: time.Minute}, 5); got != 0 {
+		t.Errorf("backoff without a base delay = %v, want 0", got)
+	}
+}
+
+func TestGuardBacksOffAndLocksOut(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guard := newTestGuard(&now)
+	attempt := Attempt{Scope: "password", Account: "annabel@example.com", IP: "203.0.113.7"}
+
+	// each failure is made once the previous wait is over
+	steps := []struct {
+		wantWait   time.Duration
+		wantLocked bool
+	}{
+		{0, false},
+		{0, false},
+		{0, false},
+		{time.Second, false},
+		{2 * time.Second, false},
+		{30 * time.Minute, true},
+	}
+	for i, step := range steps {
+		if err := guard.Failure(ctx, attempt, 401); err != nil {
+			t.Fatalf("Failure #%d: %v", i+1, err)
+		}
+		wait, err := guard.Check(ctx, attempt)
+		if err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+		if wait != step.wantWait {
+			t.Fatalf("after %d failures: wait %v, want %v", i+1, wait, step.wantWait)
+		}
+		failures, _ := guard.RecentFailures(ctx, attempt.Account, 1)
+		if failures[0].Locked != step.wantLocked {
+			t.Fatalf("after %d failures: audit record locked = %v, want %v", i+1, failures[0].Locked, step.wantLocked)
+		}
+		now = now.Add(wait)
+	}
+
+	now = now.Add(time.Second)
+	if wait, _ := guard.Check(ctx, attempt); wait != 0 {
+		t.Fatalf("after the lockout: wait %v, want 0", wait)
+	}
+}
+
+func TestGuardCountsPerAccountAndPerIP(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		failures []Attempt
+		next     Attempt
+		wantWait time.Duration
+	}{
+		{
+			name:     "one account guessed from many addresses",
+			failures: spread(4, func(i int) Attempt { return Attempt{Scope: "password", Account: "annabel@example.com", IP: ip(i)} }),
+			next:     Attempt{Scope: "password", Account: "annabel@example.com", IP: ip(99)},
+			wantWait: time.Second,
+		},
+		{
+			name:     "many accounts guessed from one address",
+			failures: spread(6, func(i int) Attempt { return Attempt{Scope: "password", Account: account(i), IP: "203.0.113.7"} }),
+			next:     Attempt{Scope: "password", Account: account(99), IP: "203.0.113.7"},
+			wantWait: time.Second,
+		},
+		{
+			name: "other accounts on other addresses are unaffected",
+			failures: spread(6, func(i int) Attempt {
+				return Attempt{Scope: "password", Account: "annabel@example.com", IP: "203.0.113.7"}
+			}),
+			next:     Attempt{Scope: "password", Account: account(99), IP: ip(99)},
+			wantWait: 0,
+		},
+		{
+			name:     "scopes are counted apart",
+			failures: spread(6, func(i int) Attempt { return Attempt{Scope: "2fa", Account: "annabel@example.com", IP: "203.0.113.7"} }),
+			next:     Attempt{Scope: "password", Account: "annabel@example.com", IP: "203.0.113.7"},
+			wantWait: 0,
+		},
+		{
+			name:     "unknown account is still limited by address",
+			failures: spread(6, func(i int) Attempt { return Attempt{Scope: "password", IP: "203.0.113.7"} }),
+			next:     Attempt{Scope: "password", IP: "203.0.113.7"},
+			wantWait: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			guard := newTestGuard(&now)
+			for _, attempt := range tt.failures {
+				if err := guard.Failure(ctx, attempt, 401); err != nil {
+					t.Fatalf("Failure: %v", err)
+				}
+			}
+			if wait, _ := guard.Check(ctx, tt.next); wait != tt.wantWait {
+				t.Fatalf("wait %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestGuardForgetsAfterWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guard := newTestGuard(&now)
+	attempt := Attempt{Scope: "password", Account: "annabel@example.com"}
+
+	for i := 0; i < 5; i++ {
+		guard.Failure(ctx, attempt, 401)
+	}
+	now = now.Add(time.Hour)
+	guard.Failure(ctx, attempt, 401)
+	if wait, _ := guard.Check(ctx, attempt); wait != 0 {
+		t.Fatalf("first failure after the window: wait %v, want 0", wait)
+	}
+}
+
+func TestGuardSuccessAndUnlock(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guard := newTestGuard(&now)
+	login := Attempt{Scope: "password", Account: "annabel@example.com", IP: "203.0.113.7"}
+	secondFactor := Attempt{Scope: "2fa", Account: "annabel@example.com", IP: ip(2)}
+
+	for i := 0; i < 6; i++ {
+		guard.Failure(ctx, login, 401)
+	}
+	if err := guard.Success(ctx, login); err != nil {
+		t.Fatalf("Success: %v", err)
+	}
+	if wait, _ := guard.Check(ctx, Attempt{Scope: "password", Account: "annabel@example.com"}); wait != 0 {
+		t.Fatalf("account waits %v after signing in, want 0", wait)
+	}
+	if wait, _ := guard.Check(ctx, Attempt{Scope: "password", Account: account(1), IP: login.IP}); wait != time.Second {
+		t.Fatalf("address waits %v after signing in, want the 1s it owed", wait)
+	}
+
+	for i := 0; i < 6; i++ {
+		guard.Failure(ctx, login, 401)
+		guard.Failure(ctx, secondFactor, 401)
+	}
+	unlocked, err := guard.Unlock(ctx, " Annabel@Example.com ")
+	if err != nil || !unlocked {
+		t.Fatalf("Unlock = %v, %v, want the account unlocked", unlocked, err)
+	}
+	for _, attempt := range []Attempt{{Scope: "password", Account: login.Account}, {Scope: "2fa", Account: login.Account}} {
+		if wait, _ := guard.Check(ctx, attempt); wait != 0 {
+			t.Fatalf("%s waits %v after the unlock, want 0", attempt.Scope, wait)
+		}
+	}
+	if unlocked, _ := guard.Unlock(ctx, login.Account); unlocked {
+		t.Fatal("second Unlock reported counters to clear")
+	}
+}
+
+func TestRecentFailures(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	guard := newTestGuard(&now)
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Minute)
+		guard.Failure(ctx, Attempt{Scope: "password", Account: "annabel@example.com", IP: ip(i)}, 401)
+		guard.Failure(ctx, Attempt{Scope: "password", Account: account(i), IP: ip(i)}, 401)
+	}
+
+	tests := []struct {
+		name    string
+		account string
+		limit   int
+		wantIPs []string
+	}{
+		{"one account newest first", "annabel@example.com", 0, []string{ip(2), ip(1), ip(0)}},
+		{"account spelled differently", " ANNABEL@example.com", 2, []string{ip(2), ip(1)}},
+		{"every account", "", 3, []string{ip(2), ip(2), ip(1)}},
+		{"account without failures", "nobody@example.com", 0, nil},
+	}
+	for _, tt := range tests {
+		failures, err := guard.RecentFailures(ctx, tt.account, tt.limit)
+		if err != nil {
+			t.Fatalf("%s: RecentFailures: %v", tt.name, err)
+		}
+		if len(failures) != len(tt.wantIPs) {
+			t.Fatalf("%s: %d failures, want %d", tt.name, len(failures), len(tt.wantIPs))
+		}
+		for i, failure := range failures {
+			if failure.IP != tt.wantIPs[i] || failure.Status != 401 {
+				t.Fatalf("%s: failure %d from %s with %d, want %s with 401", tt.name, i, failure.IP, failure.Status, tt.wantIPs[i])
+			}
+		}
+	}
+}
+
+func spread(n int, attempt func(i int) Attempt) []Attempt {
+	attempts := make([]Attempt, n)
+	for i := range attempts {
+		attempts[i] = attempt(i)
+	}
+	return attempts
+}
+
+func ip(i int) string { return fmt.Sprintf("198.51.100.%d", i) }
+
+func account(i int) string { return fmt.Sprintf("member%d@example.com", i) }
@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers email; swap implementations through configuration
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config selects and configures the Sender built by New
+type Config struct {
+	// Driver is one of "log", "file" or "smtp"
+	Driver string `yaml:"driver"`
+	From   string `yaml:"from"`
+	// Dir is where the file driver writes .eml files
+	Dir  string     `yaml:"dir"`
+	SMTP SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host         string `yaml:"host"`
+	Port         int    `yaml:"port"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+const (
+	DriverLog  = "log"
+	DriverFile = "file"
+	DriverSMTP = "smtp"
+)
+
+// New builds the Sender selected by cfg.Driver
+func New(cfg Config) (Sender, error) {
+	switch cfg.Driver {
+	case DriverLog, "":
+		return &LogSender{From: cfg.From}, nil
+	case DriverFile:
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("mail.dir is required for the file driver")
+		}
+		return &FileSender{From: cfg.From, Dir: cfg.Dir}, nil
+	case DriverSMTP:
+		if cfg.SMTP.Host == "" {
+			return nil, fmt.Errorf("mail.smtp.host is required for the smtp driver")
+		}
+		return &SMTPSender{From: cfg.From, Config: cfg.SMTP}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// format renders msg as an RFC 5322 message
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so user supplied values cannot inject headers
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
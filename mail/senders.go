@@ -0,0 +1,60 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// LogSender writes messages to the application log, for local development
+type LogSender struct {
+	From string
+}
+
+func (s *LogSender) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileSender writes each message as an .eml file in Dir, for local development
+type FileSender struct {
+	From string
+	Dir  string
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func (s *FileSender) Send(ctx context.Context, msg Message) error {
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(s.Dir, name), format(s.From, msg), 0o600)
+}
+
+// SMTPSender delivers through an SMTP relay using STARTTLS when offered
+type SMTPSender struct {
+	From   string
+	Config SMTPConfig
+}
+
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	port := s.Config.Port
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(s.Config.Host, strconv.Itoa(port))
+
+	var auth smtp.Auth
+	if s.Config.Username != "" {
+		auth = smtp.PlainAuth("", s.Config.Username, s.Config.Password, s.Config.Host)
+	}
+	return smtp.SendMail(addr, auth, s.From, []string{msg.To}, format(s.From, msg))
+}
@@ -1,32 +1,141 @@
 package main
 
 import (
+	"SSE/auth"
+	"SSE/billing"
+	"SSE/config"
+	"SSE/csrf"
 	"SSE/database"
+	"SSE/handlers"
+	"SSE/loginguard"
+	"SSE/mail"
+	"SSE/membership"
+	"SSE/middleware"
+	"SSE/migrations"
+	"SSE/occupancy"
+	"SSE/oidc"
+	"SSE/payments"
 	"SSE/routes"
 	"SSE/sessions"
+	"SSE/store"
 	"SSE/web"
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	sessionKey := []byte("your-32-byte-secret-key-here")
-	sessions.Initialize(sessionKey)
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
-	if err := database.ConnectDB(); err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	auth.SetHashParams(cfg.Auth.PasswordHashing)
+	if err := auth.SetPasswordPolicy(cfg.Auth.PasswordPolicy); err != nil {
+		log.Fatalf("Failed to load password policy: %v", err)
 	}
-	defer func() {
-		if err := database.DisconnectDB(); err != nil {
-			log.Printf("Error disconnecting from database: %v", err)
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrateCommand(cfg, os.Args[2:])
+			return
+		case "set-role":
+			runSetRoleCommand(cfg, os.Args[2:])
+			return
 		}
-	}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var appStore *store.Store
+	var dbManager *database.Manager
+	if cfg.Store.Backend == config.BackendMemory {
+		log.Println("Using in-memory store, data will not survive a restart")
+		appStore = store.NewMemoryStore()
+	} else {
+		dbManager, err = database.Connect(ctx, cfg.MongoDB)
+		if err != nil {
+			log.Fatalf("Failed to connect to MongoDB: %v", err)
+		}
+		if cfg.MongoDB.AutoMigrate {
+			applied, err := migrations.NewRunner(dbManager.Database()).Up(ctx)
+			if err != nil {
+				log.Fatalf("Failed to apply migrations: %v", err)
+			}
+			log.Printf("Applied %d migration(s)", applied)
+		}
+		appStore = store.NewMongoStore(dbManager.Database())
+	}
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+
+	paymentProvider, err := payments.New(cfg.Payments)
+	if err != nil {
+		log.Fatalf("Failed to configure payments: %v", err)
+	}
 
-	database.Connect_DB()
+	lifecycle := membership.New(cfg.Memberships, appStore.Users, appStore.MembershipHistory)
+	lifecycle.OnTransition(membership.LogHook)
+	lifecycle.OnTransition(membership.MailHook(mailer, cfg.Server.BaseURL))
+	go lifecycle.Run(ctx)
+
+	billingService := billing.New(cfg, appStore, paymentProvider, mailer, lifecycle)
+	go billingService.Run(ctx)
+
+	loginGuard := loginguard.New(cfg.LoginGuard, appStore.LoginThrottles, appStore.LoginAttempts)
+	occupancyTracker := occupancy.New(cfg.Occupancy, appStore.Visits)
+	go occupancyTracker.Run(ctx)
+
+	sessions.Initialize(cfg.Session, appStore.Sessions)
+	csrf.Initialize(cfg.Auth.SigningKey, cfg.Session)
+	handlers.Initialize(handlers.Dependencies{
+		Store:            appStore,
+		Config:           cfg,
+		Mailer:           mailer,
+		LoginGuard:       loginGuard,
+		IdentityProvider: oidc.New(cfg.OIDC),
+		Occupancy:        occupancyTracker,
+		Payments:         paymentProvider,
+		Billing:          billingService,
+		Memberships:      lifecycle,
+	})
+	middleware.Initialize(appStore, loginGuard)
 	routes.RegisterRoutes()
 	routes.RegisterAuthRoutes()
 	web.SetupTemplates()
 
-	log.Println("Server started on :3000")
-	log.Fatal(http.ListenAndServe(":3000", nil))
+	server := &http.Server{Addr: cfg.Server.Addr, Handler: csrf.Protect(http.DefaultServeMux)}
+	// end the occupancy event streams, Shutdown would otherwise wait for them until it times out
+	server.RegisterOnShutdown(occupancyTracker.Close)
+
+	go func() {
+		log.Printf("Server started on %s", cfg.Server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down server...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	if dbManager != nil {
+		if err := dbManager.Close(shutdownCtx); err != nil {
+			log.Printf("Error disconnecting from database: %v", err)
+		}
+	}
 }
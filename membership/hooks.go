@@ -0,0 +1,41 @@
+package membership
+
+import (
+	"SSE/mail"
+	"SSE/models"
+	"context"
+	"fmt"
+	"log"
+)
+
+// LogHook logs every transition
+func LogHook(ctx context.Context, user *models.User, change *models.MembershipStatusChange) {
+	log.Printf("membership: %s went from %s to %s (%s)", user.ID.Hex(), change.From, change.To, change.Reason)
+}
+
+// MailHook emails members whose membership expired or was cancelled. Purchases, renewals and
+// suspensions are emailed by billing, which knows the amounts involved.
+func MailHook(mailer mail.Sender, baseURL string) Hook {
+	return func(ctx context.Context, user *models.User, change *models.MembershipStatusChange) {
+		var subject, body string
+		switch change.To {
+		case models.StatusExpired:
+			if user.AutoRenew {
+				// the renewal scheduler is still trying to charge it and emails about that
+				return
+			}
+			subject = "Your Fitness Center membership has expired"
+			body = fmt.Sprintf("Hi %s,\n\nYour membership expired on %s. You can renew it any time at %s/membership.\n",
+				user.Name, user.MembershipExpiry.Format("January 2, 2006"), baseURL)
+		case models.StatusCancelled:
+			subject = "Your Fitness Center membership was cancelled"
+			body = fmt.Sprintf("Hi %s,\n\nYour membership has been cancelled and won't be renewed. "+
+				"You are welcome back any time at %s/membership.\n", user.Name, baseURL)
+		default:
+			return
+		}
+		if err := mailer.Send(ctx, mail.Message{To: user.Email, Subject: subject, Body: body}); err != nil {
+			log.Printf("membership: failed to email %s: %v", user.Email, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package membership moves members' memberships between statuses. Every change goes through
+// Lifecycle, which enforces the allowed transitions, records them in the status history and
+// tells the registered hooks about them.
+package membership
+
+import (
+	"SSE/config"
+	"SSE/models"
+	"SSE/store"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reasons recorded with automatic status changes
+const (
+	ReasonPurchase  = "purchase"
+	ReasonRenewal   = "renewal"
+	ReasonExpired   = "expired"
+	ReasonUnpaid    = "renewal_unpaid"
+	ReasonCancelled = "cancelled_by_member"
+	// ReasonStaff is recorded for changes staff made without giving a reason
+	ReasonStaff = "changed_by_staff"
+)
+
+// ErrInvalidTransition is returned for a change the membership's current status doesn't allow
+var ErrInvalidTransition = errors.New("membership status change is not allowed")
+
+// Hook is called after every transition has been saved. It runs on the goroutine making the
+// change, so hooks doing slow work should hand it off.
+type Hook func(ctx context.Context, user *models.User, change *models.MembershipStatusChange)
+
+// Lifecycle changes membership statuses and expires lapsed memberships
+type Lifecycle struct {
+	cfg     config.MembershipConfig
+	users   store.UserRepository
+	history store.MembershipHistoryRepository
+	now     func() time.Time
+
+	mu    sync.RWMutex
+	hooks []Hook
+}
+
+func New(cfg config.MembershipConfig, users store.UserRepository, history store.MembershipHistoryRepository) *Lifecycle {
+	return &Lifecycle{
+		cfg:     cfg,
+		users:   users,
+		history: history,
+		now:     time.Now,
+	}
+}
+
+// OnTransition registers hook to be called after every status change
+func (l *Lifecycle) OnTransition(hook Hook) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.hooks = append(l.hooks, hook)
+}
+
+// Change saves user with its membership status set to, along with any other changes the caller
+// made to it. user must hold the status as it was read from the store; when the stored status
+// has changed since, nothing is saved and store.ErrConflict is returned. Keeping the current
+// status saves the other changes without recording a transition.
+func (l *Lifecycle) Change(ctx context.Context, user *models.User, to models.MembershipStatus, reason string, actorID primitive.ObjectID) error {
+	from := user.MembershipStatus
+	if from == "" {
+		from = models.StatusNone
+	}
+	if from != to && !from.CanBecome(to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	now := l.now()
+	user.MembershipStatus = to
+	user.UpdatedAt = now
+	if err := l.users.UpdateMembership(ctx, user, from); err != nil {
+		user.MembershipStatus = from
+		return err
+	}
+	if from == to {
+		return nil
+	}
+
+	change := &models.MembershipStatusChange{
+		UserID: user.ID,
+		From:   from,
+		To:     to,
+		Reason: reason,
+		At:     now,
+	}
+	if !actorID.IsZero() {
+		change.ActorID = &actorID
+	}
+	// the status is already changed, a missing history entry must not undo it
+	if err := l.history.Create(ctx, change); err != nil {
+		log.Printf("membership: failed to record %s going from %s to %s: %v", user.ID.Hex(), from, to, err)
+	}
+
+	l.mu.RLock()
+	hooks := l.hooks
+	l.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, user, change)
+	}
+	return nil
+}
+
+// Run expires lapsed memberships every expiry interval until ctx is done
+func (l *Lifecycle) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.cfg.ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		l.ExpireLapsed(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ExpireLapsed moves active memberships whose expiry has passed to expired
+func (l *Lifecycle) ExpireLapsed(ctx context.Context) {
+	users, err := l.users.ListLapsed(ctx, l.now())
+	if err != nil {
+		log.Printf("membership: failed to list lapsed memberships: %v", err)
+		return
+	}
+
+	expired := 0
+	for i := range users {
+		if ctx.Err() != nil {
+			return
+		}
+		user := &users[i]
+		if !user.ScheduledPlanID.IsZero() {
+			// a downgrade takes effect at the end of the period whether or not it is renewed
+			user.MembershipPlanID = user.ScheduledPlanID
+			user.ScheduledPlanID = primitive.NilObjectID
+			user.ScheduledPlanStart = time.Time{}
+		}
+		err := l.Change(ctx, user, models.StatusExpired, ReasonExpired, primitive.NilObjectID)
+		if errors.Is(err, store.ErrConflict) {
+			// renewed, suspended or cancelled since it was listed
+			continue
+		}
+		if err != nil {
+			log.Printf("membership: failed to expire %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		expired++
+	}
+	if expired > 0 {
+		log.Printf("membership: expired %d lapsed membership(s)", expired)
+	}
+}
@@ -0,0 +1,148 @@
+package membership
+
+import (
+	"SSE/config"
+	"SSE/models"
+	"SSE/store"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testNow = time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+func newTestLifecycle(t *testing.T) (*Lifecycle, *store.Store) {
+	t.Helper()
+	appStore := store.NewMemoryStore()
+	lifecycle := New(config.MembershipConfig{ExpiryInterval: time.Minute}, appStore.Users, appStore.MembershipHistory)
+	lifecycle.now = func() time.Time { return testNow }
+	return lifecycle, appStore
+}
+
+func TestChange(t *testing.T) {
+	ctx := context.Background()
+	staff := primitive.NewObjectID()
+
+	tests := []struct {
+		name        string
+		stored      models.MembershipStatus
+		read        models.MembershipStatus
+		to          models.MembershipStatus
+		actor       primitive.ObjectID
+		wantErr     error
+		wantStatus  models.MembershipStatus
+		wantHistory bool
+	}{
+		{"first purchase", models.StatusNone, models.StatusNone, models.StatusActive, primitive.NilObjectID, nil, models.StatusActive, true},
+		{"cancel by staff", models.StatusActive, models.StatusActive, models.StatusCancelled, staff, nil, models.StatusCancelled, true},
+		{"suspended member pays", models.StatusSuspended, models.StatusSuspended, models.StatusActive, primitive.NilObjectID, nil, models.StatusActive, true},
+		{"keeping the status saves without history", models.StatusActive, models.StatusActive, models.StatusActive, primitive.NilObjectID, nil, models.StatusActive, false},
+		{"cancelled can't expire", models.StatusCancelled, models.StatusCancelled, models.StatusExpired, primitive.NilObjectID, ErrInvalidTransition, models.StatusCancelled, false},
+		{"never a member can't be suspended", models.StatusNone, models.StatusNone, models.StatusSuspended, primitive.NilObjectID, ErrInvalidTransition, models.StatusNone, false},
+		{"status changed since it was read", models.StatusSuspended, models.StatusActive, models.StatusExpired, primitive.NilObjectID, store.ErrConflict, models.StatusSuspended, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lifecycle, appStore := newTestLifecycle(t)
+			var hooked []*models.MembershipStatusChange
+			lifecycle.OnTransition(func(ctx context.Context, user *models.User, change *models.MembershipStatusChange) {
+				hooked = append(hooked, change)
+			})
+
+			user := &models.User{Email: "member@example.com", MembershipStatus: tt.stored}
+			if err := appStore.Users.Create(ctx, user); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			user.MembershipStatus = tt.read
+			user.Name = "Renamed"
+
+			err := lifecycle.Change(ctx, user, tt.to, ReasonStaff, tt.actor)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Change = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && user.MembershipStatus != tt.read {
+				t.Fatalf("failed Change left the user at %s, want the status it was read with, %s", user.MembershipStatus, tt.read)
+			}
+
+			stored, _ := appStore.Users.GetByID(ctx, user.ID)
+			if stored.MembershipStatus != tt.wantStatus {
+				t.Fatalf("stored status = %s, want %s", stored.MembershipStatus, tt.wantStatus)
+			}
+			if saved := stored.Name == "Renamed"; saved != (tt.wantErr == nil) {
+				t.Fatalf("other changes saved = %v, want %v", saved, tt.wantErr == nil)
+			}
+
+			history, _ := appStore.MembershipHistory.ListByUser(ctx, user.ID)
+			if (len(history) == 1) != tt.wantHistory || len(hooked) != len(history) {
+				t.Fatalf("%d history entries and %d hook calls, want history %v and a hook call for each", len(history), len(hooked), tt.wantHistory)
+			}
+			if !tt.wantHistory {
+				return
+			}
+			change := history[0]
+			if change.From != tt.read || change.To != tt.to || change.Reason != ReasonStaff || !change.At.Equal(testNow) {
+				t.Fatalf("history entry %+v, want %s to %s at %v", change, tt.read, tt.to, testNow)
+			}
+			if (change.ActorID != nil) != !tt.actor.IsZero() || (change.ActorID != nil && *change.ActorID != tt.actor) {
+				t.Fatalf("actor = %v, want %s", change.ActorID, tt.actor.Hex())
+			}
+		})
+	}
+}
+
+func TestExpireLapsed(t *testing.T) {
+	ctx := context.Background()
+	lifecycle, appStore := newTestLifecycle(t)
+	basic, premium := primitive.NewObjectID(), primitive.NewObjectID()
+
+	users := []struct {
+		name       string
+		user       models.User
+		wantStatus models.MembershipStatus
+		wantPlan   primitive.ObjectID
+	}{
+		{"lapsed", models.User{MembershipStatus: models.StatusActive, MembershipPlanID: basic, MembershipExpiry: testNow.Add(-time.Minute)},
+			models.StatusExpired, basic},
+		{"lapsed with a downgrade scheduled", models.User{MembershipStatus: models.StatusActive, MembershipPlanID: premium, ScheduledPlanID: basic, MembershipExpiry: testNow.Add(-time.Hour)},
+			models.StatusExpired, basic},
+		{"still current", models.User{MembershipStatus: models.StatusActive, MembershipPlanID: basic, MembershipExpiry: testNow.Add(time.Minute)},
+			models.StatusActive, basic},
+		{"cancelled", models.User{MembershipStatus: models.StatusCancelled, MembershipPlanID: basic, MembershipExpiry: testNow.Add(-time.Hour)},
+			models.StatusCancelled, basic},
+	}
+	for i := range users {
+		users[i].user.Email = users[i].name + "@example.com"
+		if err := appStore.Users.Create(ctx, &users[i].user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	// running twice must not record a second expiry
+	lifecycle.ExpireLapsed(ctx)
+	lifecycle.ExpireLapsed(ctx)
+
+	for _, tt := range users {
+		stored, _ := appStore.Users.GetByID(ctx, tt.user.ID)
+		if stored.MembershipStatus != tt.wantStatus || stored.MembershipPlanID != tt.wantPlan {
+			t.Errorf("%s: %s on %s, want %s on %s", tt.name, stored.MembershipStatus, stored.MembershipPlanID.Hex(), tt.wantStatus, tt.wantPlan.Hex())
+		}
+		if !stored.ScheduledPlanID.IsZero() && tt.wantStatus == models.StatusExpired {
+			t.Errorf("%s: scheduled plan kept after it took effect", tt.name)
+		}
+
+		history, _ := appStore.MembershipHistory.ListByUser(ctx, tt.user.ID)
+		wantEntries := 0
+		if tt.wantStatus != tt.user.MembershipStatus {
+			wantEntries = 1
+		}
+		if len(history) != wantEntries {
+			t.Errorf("%s: %d history entries, want %d", tt.name, len(history), wantEntries)
+		}
+		if wantEntries == 1 && history[0].Reason != ReasonExpired {
+			t.Errorf("%s: reason %q, want %q", tt.name, history[0].Reason, ReasonExpired)
+		}
+	}
+}
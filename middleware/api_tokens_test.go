@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"SSE/auth"
+	"SSE/models"
+	"SSE/sessions"
+	"SSE/store"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createToken stores a token for user with scopes and returns its raw value
+func createToken(t *testing.T, appStore *store.Store, user *models.User, raw string, expiresAt *time.Time, scopes ...models.TokenScope) string {
+	t.Helper()
+	token := models.APIToken{
+		UserID:    user.ID,
+		Name:      raw,
+		TokenHash: auth.HashToken(raw),
+		Prefix:    raw[:8],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := appStore.APITokens.Create(context.Background(), &token); err != nil {
+		t.Fatalf("Create token: %v", err)
+	}
+	return raw
+}
+
+func TestAPITokenAuthentication(t *testing.T) {
+	appStore := newTestStore(t)
+	member := createUser(t, appStore, models.User{Role: models.RoleMember})
+	deleted := createUser(t, appStore, models.User{Role: models.RoleTrainer})
+	expired := time.Now().Add(-time.Minute)
+	later := time.Now().Add(time.Hour)
+
+	reader := createToken(t, appStore, member, "sse_reader_token", nil, models.ScopeFitnessRead)
+	writer := createToken(t, appStore, member, "sse_writer_token", &later, models.ScopeFitnessRead, models.ScopeFitnessWrite)
+	stale := createToken(t, appStore, member, "sse_expired_token", &expired, models.ScopeFitnessRead, models.ScopeFitnessWrite)
+	orphan := createToken(t, appStore, deleted, "sse_orphan_token", nil, models.ScopeFitnessRead)
+	appStore.Users.Delete(context.Background(), deleted.ID)
+
+	read := TokenScope(models.ScopeFitnessRead, AuthRequired(ok))
+	write := TokenScope(models.ScopeFitnessWrite, AuthRequired(ok))
+	unscoped := AuthRequired(ok)
+
+	tests := []struct {
+		name          string
+		handler       http.HandlerFunc
+		authorization string
+		want          int
+		wantChallenge string
+	}{
+		{"read token on a read route", read, "Bearer " + reader, http.StatusNoContent, ""},
+		{"scheme in another case", read, "bearer " + reader, http.StatusNoContent, ""},
+		{"read token on a write route", write, "Bearer " + reader, http.StatusForbidden, "insufficient_scope"},
+		{"write token on a write route", write, "Bearer " + writer, http.StatusNoContent, ""},
+		{"expired token", read, "Bearer " + stale, http.StatusUnauthorized, "invalid_token"},
+		{"unknown token", read, "Bearer sse_unknown_token", http.StatusUnauthorized, "invalid_token"},
+		{"token of a deleted user", read, "Bearer " + orphan, http.StatusUnauthorized, "invalid_token"},
+		{"route closed to tokens", unscoped, "Bearer " + writer, http.StatusForbidden, ""},
+		{"basic credentials", read, "Basic " + reader, http.StatusUnauthorized, "invalid_request"},
+		{"bearer without a token", read, "Bearer  ", http.StatusUnauthorized, "invalid_request"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.handler, http.MethodGet, nil, tt.authorization)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, tt.wantChallenge) || (tt.wantChallenge == "") != (challenge == "") {
+				t.Fatalf("WWW-Authenticate %q, want %q", challenge, tt.wantChallenge)
+			}
+			if len(w.Result().Cookies()) != 0 {
+				t.Fatal("token request was given a session cookie")
+			}
+		})
+	}
+}
+
+func TestAPITokenSignsInItsUser(t *testing.T) {
+	appStore := newTestStore(t)
+	member := createUser(t, appStore, models.User{Role: models.RoleMember})
+	raw := createToken(t, appStore, member, "sse_member_token", nil, models.ScopeProfileRead)
+
+	var userID, tokenID string
+	handler := TokenScope(models.ScopeProfileRead, AuthRequired(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := sessions.Get(r)
+		userID, _ = session.Values["user_id"].(string)
+		tokenID, _ = sessions.APITokenID(r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	if w := serve(handler, http.MethodGet, nil, "Bearer "+raw); w.Code != http.StatusNoContent {
+		t.Fatalf("status %d, want 204", w.Code)
+	}
+	if userID != member.ID.Hex() {
+		t.Fatalf("handler saw user %q, want the token's owner", userID)
+	}
+
+	token, _ := appStore.APITokens.GetByHash(context.Background(), auth.HashToken(raw))
+	if tokenID != token.ID.Hex() {
+		t.Fatalf("request token %q, want %s", tokenID, token.ID.Hex())
+	}
+	if token.LastUsedAt == nil {
+		t.Fatal("use of the token wasn't recorded")
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"SSE/loginguard"
+	"SSE/sessions"
+	"SSE/web"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxPeekedBody bounds how much of a request body AccountFromJSONEmail will buffer
+const maxPeekedBody = 64 << 10
+
+// AccountResolver names the account a credential check is for, "" when it can't tell
+type AccountResolver func(r *http.Request) string
+
+// LoginThrottle protects a credential check against guessing. Requests that are still backing off
+// or locked out get 429 with Retry-After; otherwise next runs and its response decides the outcome:
+// 401 counts as a failure and 2xx as a success, so next needs no knowledge of the throttle.
+func LoginThrottle(scope string, account AccountResolver, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+
+		attempt := loginguard.Attempt{
+			Scope:     scope,
+			Account:   account(r),
+			IP:        web.ClientIP(r),
+			UserAgent: r.UserAgent(),
+		}
+
+		wait, err := guard.Check(r.Context(), attempt)
+		if err != nil {
+			log.Printf("login guard check failed: %v", err)
+			writeJSONError(w, http.StatusServiceUnavailable, "Sign in is temporarily unavailable")
+			return
+		}
+		if wait > 0 {
+			seconds := int(wait.Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeJSONError(w, http.StatusTooManyRequests, "Too many failed attempts, try again in "+strconv.Itoa(seconds)+" seconds")
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		switch {
+		case recorder.status == http.StatusUnauthorized:
+			err = guard.Failure(r.Context(), attempt, recorder.status)
+		case recorder.status >= 200 && recorder.status < 300:
+			err = guard.Success(r.Context(), attempt)
+		}
+		if err != nil {
+			log.Printf("login guard failed to record attempt: %v", err)
+		}
+	}
+}
+
+// AccountFromJSONEmail reads the "email" field of a JSON body and restores the body for the handler
+func AccountFromJSONEmail(r *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekedBody))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var credentials struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &credentials); err != nil {
+		return ""
+	}
+	return loginguard.NormalizeAccount(credentials.Email)
+}
+
+// AccountFromPendingLogin names the account whose login is waiting for a second factor
+func AccountFromPendingLogin(r *http.Request) string {
+	userID, ok := sessions.PendingLoginUserID(r)
+	if !ok {
+		return ""
+	}
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return ""
+	}
+	user, err := users.GetByID(r.Context(), objID)
+	if err != nil {
+		return ""
+	}
+	return loginguard.NormalizeAccount(user.Email)
+}
+
+// statusRecorder remembers the status code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
@@ -5,8 +5,16 @@ import (
 	"net/http"
 )
 
+// AuthRequired lets signed-in users through, as well as API tokens on routes wrapped in TokenScope
 func AuthRequired(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Authorization"); header != "" {
+			if authenticateBearer(w, r, header) {
+				next(w, r)
+			}
+			return
+		}
+
 		session, err := sessions.Get(r)
 		if err != nil {
 			http.Error(w, "Session error", http.StatusInternalServerError)
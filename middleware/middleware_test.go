@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"SSE/config"
+	"SSE/models"
+	"SSE/sessions"
+	"SSE/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestStore initializes the middleware and server-side sessions on a memory store
+func newTestStore(t *testing.T) *store.Store {
+	t.Helper()
+	appStore := store.NewMemoryStore()
+	cfg := config.Default()
+	cfg.Session.Key = strings.Repeat("session-key-", 4)
+	cfg.Session.SecureCookies = false
+	sessions.Initialize(cfg.Session, appStore.Sessions)
+	Initialize(appStore, nil)
+	return appStore
+}
+
+func createUser(t *testing.T, appStore *store.Store, user models.User) *models.User {
+	t.Helper()
+	if user.Email == "" {
+		user.Email = string(user.Role) + "@example.com"
+	}
+	if err := appStore.Users.Create(context.Background(), &user); err != nil {
+		t.Fatalf("Create user: %v", err)
+	}
+	return &user
+}
+
+// signIn returns the cookies of a session signed in as user
+func signIn(t *testing.T, user *models.User) []*http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := sessions.SetUserSession(w, httptest.NewRequest(http.MethodGet, "/", nil), user.ID.Hex()); err != nil {
+		t.Fatalf("SetUserSession: %v", err)
+	}
+	return w.Result().Cookies()
+}
+
+// serve runs handler for a request carrying cookies and the Authorization header, if any
+func serve(handler http.HandlerFunc, method string, cookies []*http.Cookie, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestAuthRequired(t *testing.T) {
+	appStore := newTestStore(t)
+	member := createUser(t, appStore, models.User{Role: models.RoleMember})
+
+	if w := serve(AuthRequired(ok), http.MethodGet, nil, ""); w.Code != http.StatusUnauthorized {
+		t.Fatalf("without a session: %d, want 401", w.Code)
+	}
+	if w := serve(AuthRequired(ok), http.MethodGet, signIn(t, member), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("signed in: %d, want 204", w.Code)
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"SSE/loginguard"
+	"SSE/models"
+	"SSE/rbac"
+	"SSE/sessions"
+	"SSE/store"
+	"context"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+var (
+	users     store.UserRepository
+	apiTokens store.APITokenRepository
+	guard     *loginguard.Guard
+)
+
+// Initialize gives the middleware access to user accounts and API tokens so it can resolve
+// roles and bearer tokens, and to the login guard used by LoginThrottle
+func Initialize(s *store.Store, g *loginguard.Guard) {
+	users = s.Users
+	apiTokens = s.APITokens
+	guard = g
+}
+
+// RequirePermission only lets the request through when the signed-in user's role grants permission.
+// The resolved user is available to the handler through CurrentUser.
+func RequirePermission(permission rbac.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return AuthRequired(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := loadSessionUser(w, r)
+		if !ok {
+			return
+		}
+
+		if !rbac.Can(user.EffectiveRole(), permission) {
+			writeJSONError(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+
+		// sessions opened before the role required a second factor can't use it until enrolled
+		if user.EffectiveRole().RequiresTwoFactor() && !user.TwoFactor.Enabled {
+			writeJSONError(w, http.StatusForbidden, "Two-factor authentication must be enabled for your role")
+			return
+		}
+
+		next(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	})
+}
+
+// CurrentUser returns the user resolved by RequirePermission, if any
+func CurrentUser(r *http.Request) (*models.User, bool) {
+	user, ok := r.Context().Value(userContextKey).(*models.User)
+	return user, ok
+}
+
+func loadSessionUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	session, err := sessions.Get(r)
+	if err != nil {
+		http.Error(w, "Session error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	userID, _ := session.Values["user_id"].(string)
+	objID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return nil, false
+	}
+
+	user, err := users.GetByID(r.Context(), objID)
+	if err != nil {
+		writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+		return nil, false
+	}
+	return user, true
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"error": "` + message + `"}`))
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"SSE/models"
+	"SSE/rbac"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequirePermission(t *testing.T) {
+	appStore := newTestStore(t)
+	enrolled := models.TwoFactor{Enabled: true}
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		permission rbac.Permission
+		want       int
+	}{
+		{"not signed in", nil, rbac.PermViewMembers, http.StatusUnauthorized},
+		{"member", &models.User{Role: models.RoleMember}, rbac.PermViewMembers, http.StatusForbidden},
+		{"account from before roles", &models.User{}, rbac.PermViewMembers, http.StatusForbidden},
+		{"trainer viewing members", &models.User{Role: models.RoleTrainer}, rbac.PermViewMembers, http.StatusNoContent},
+		{"trainer managing members", &models.User{Role: models.RoleTrainer}, rbac.PermManageMembers, http.StatusForbidden},
+		{"front desk without a second factor", &models.User{Role: models.RoleFrontDesk}, rbac.PermCheckInMembers, http.StatusForbidden},
+		{"front desk with a second factor", &models.User{Role: models.RoleFrontDesk, TwoFactor: enrolled}, rbac.PermCheckInMembers, http.StatusNoContent},
+		{"front desk deleting users", &models.User{Role: models.RoleFrontDesk, TwoFactor: enrolled}, rbac.PermDeleteUsers, http.StatusForbidden},
+		{"admin without a second factor", &models.User{Role: models.RoleAdmin}, rbac.PermDeleteUsers, http.StatusForbidden},
+		{"admin with a second factor", &models.User{Role: models.RoleAdmin, TwoFactor: enrolled}, rbac.PermDeleteUsers, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var cookies []*http.Cookie
+			var user *models.User
+			if tt.user != nil {
+				account := *tt.user
+				account.Email = strings.ReplaceAll(tt.name, " ", ".") + "@example.com"
+				user = createUser(t, appStore, account)
+				cookies = signIn(t, user)
+			}
+
+			var resolved *models.User
+			handler := RequirePermission(tt.permission, func(w http.ResponseWriter, r *http.Request) {
+				resolved, _ = CurrentUser(r)
+				w.WriteHeader(http.StatusNoContent)
+			})
+			if w := serve(handler, http.MethodGet, cookies, ""); w.Code != tt.want {
+				t.Fatalf("status %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusNoContent && (resolved == nil || resolved.ID != user.ID) {
+				t.Fatalf("handler saw user %v, want the signed-in one", resolved)
+			}
+		})
+	}
+}
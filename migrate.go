@@ -0,0 +1,59 @@
+package main
+
+import (
+	"SSE/config"
+	"SSE/database"
+	"SSE/migrations"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// runMigrateCommand handles `migrate [up|status]` from the command line
+func runMigrateCommand(cfg *config.Config, args []string) {
+	action := "up"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	if cfg.Store.Backend != config.BackendMongo {
+		log.Fatalf("Migrations only apply to the %q store backend", config.BackendMongo)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	dbManager, err := database.Connect(ctx, cfg.MongoDB)
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer dbManager.Close(context.Background())
+
+	runner := migrations.NewRunner(dbManager.Database())
+
+	switch action {
+	case "up":
+		applied, err := runner.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		log.Printf("Applied %d migration(s)", applied)
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%4d  %-55s %s\n", s.Version, s.Description, state)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q, expected up or status\n", action)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,129 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const collectionName = "schema_migrations"
+
+// Migration is a single, forward-only schema change
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is what gets stored in schema_migrations once a migration has been applied
+type Record struct {
+	Version     int       `json:"version" bson:"_id"`
+	Description string    `json:"description" bson:"description"`
+	AppliedAt   time.Time `json:"applied_at" bson:"applied_at"`
+	DurationMS  int64     `json:"duration_ms" bson:"duration_ms"`
+}
+
+// Status describes whether a known migration has been applied
+type Status struct {
+	Version     int
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+// Runner applies migrations in version order and tracks them in schema_migrations
+type Runner struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+// NewRunner creates a runner for the given migrations, defaulting to All()
+func NewRunner(db *mongo.Database, migrations ...Migration) *Runner {
+	if len(migrations) == 0 {
+		migrations = All()
+	}
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return &Runner{db: db, migrations: sorted}
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]Record, error) {
+	cursor, err := r.db.Collection(collectionName).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema migrations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, fmt.Errorf("failed to decode schema migrations: %w", err)
+	}
+
+	applied := make(map[int]Record, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// Status lists every known migration and whether it has run
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		record, ok := applied[m.Version]
+		statuses = append(statuses, Status{
+			Version:     m.Version,
+			Description: m.Description,
+			Applied:     ok,
+			AppliedAt:   record.AppliedAt,
+		})
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration and returns how many ran
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		started := time.Now()
+		if err := m.Up(ctx, r.db); err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+
+		record := Record{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now(),
+			DurationMS:  time.Since(started).Milliseconds(),
+		}
+		if _, err := r.db.Collection(collectionName).InsertOne(ctx, record); err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				// another instance applied it concurrently, which is fine since migrations are idempotent
+				continue
+			}
+			return count, fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+		}
+		count++
+	}
+	return count, nil
+}
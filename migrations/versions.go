@@ -0,0 +1,455 @@
+package migrations
+
+import (
+	"SSE/models"
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All returns every migration known to the application. New migrations must be
+// appended with a higher version and must be safe to run more than once.
+func All() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Description: "unique index on users.email",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				if err := parkDuplicateEmails(ctx, db.Collection("users")); err != nil {
+					return err
+				}
+				return createIndexes(ctx, db.Collection("users"), mongo.IndexModel{
+					Keys:    bson.D{{Key: "email", Value: 1}},
+					Options: options.Index().SetName("email_unique").SetUnique(true),
+				})
+			},
+		},
+		{
+			Version:     2,
+			Description: "user_id indexes on fitness_profiles and activities",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				err := createIndexes(ctx, db.Collection("fitness_profiles"), mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}},
+					Options: options.Index().SetName("user_id_unique").SetUnique(true),
+				})
+				if err != nil {
+					return err
+				}
+				return createIndexes(ctx, db.Collection("activities"), mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "date", Value: -1}},
+					Options: options.Index().SetName("user_id_date"),
+				})
+			},
+		},
+		{
+			Version:     3,
+			Description: "rename legacy users.updatedat to updated_at",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				// UpdateUser used to write "updatedat", keep whichever timestamp is newer
+				_, err := db.Collection("users").UpdateMany(ctx,
+					bson.M{"updatedat": bson.M{"$exists": true}},
+					mongo.Pipeline{
+						{{Key: "$set", Value: bson.M{"updated_at": bson.M{"$max": bson.A{"$updated_at", "$updatedat"}}}}},
+						{{Key: "$unset", Value: "updatedat"}},
+					},
+				)
+				return err
+			},
+		},
+		{
+			Version:     4,
+			Description: "backfill missing users.total_visits and membership_status",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				users := db.Collection("users")
+				if _, err := backfillMissing(ctx, users, "total_visits", 0); err != nil {
+					return err
+				}
+				_, err := backfillMissing(ctx, users, "membership_status", "active")
+				return err
+			},
+		},
+		{
+			Version:     5,
+			Description: "backfill users.role as member",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				_, err := backfillMissing(ctx, db.Collection("users"), "role", "member")
+				return err
+			},
+		},
+		{
+			Version:     6,
+			Description: "sessions expiry TTL and user_id indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("sessions"),
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "absolute_expires_at", Value: 1}},
+						Options: options.Index().SetName("absolute_expires_at_ttl").SetExpireAfterSeconds(0),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "user_id", Value: 1}},
+						Options: options.Index().SetName("user_id"),
+					},
+				)
+			},
+		},
+		{
+			Version:     7,
+			Description: "password_resets expiry TTL and user_id indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("password_resets"),
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "expires_at", Value: 1}},
+						Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "user_id", Value: 1}},
+						Options: options.Index().SetName("user_id"),
+					},
+				)
+			},
+		},
+		{
+			Version:     8,
+			Description: "treat emails of existing users as verified",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				// accounts created before verification existed keep working as before
+				_, err := backfillMissing(ctx, db.Collection("users"), "email_verified", true)
+				return err
+			},
+		},
+		{
+			Version:     9,
+			Description: "login_throttles expiry TTL and login_attempts audit indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				err := createIndexes(ctx, db.Collection("login_throttles"),
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "expires_at", Value: 1}},
+						Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "subject", Value: 1}},
+						Options: options.Index().SetName("kind_subject"),
+					},
+				)
+				if err != nil {
+					return err
+				}
+				// failed attempts are kept for 90 days
+				return createIndexes(ctx, db.Collection("login_attempts"),
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "created_at", Value: 1}},
+						Options: options.Index().SetName("created_at_ttl").SetExpireAfterSeconds(90 * 24 * 60 * 60),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "account", Value: 1}, {Key: "created_at", Value: -1}},
+						Options: options.Index().SetName("account_created_at"),
+					},
+				)
+			},
+		},
+		{
+			Version:     10,
+			Description: "api_tokens hash, user_id and expiry TTL indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("api_tokens"),
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "token_hash", Value: 1}},
+						Options: options.Index().SetName("token_hash_unique").SetUnique(true),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "user_id", Value: 1}},
+						Options: options.Index().SetName("user_id"),
+					},
+					// tokens without expires_at never expire, the TTL monitor skips them
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "expires_at", Value: 1}},
+						Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+					},
+				)
+			},
+		},
+		{
+			Version:     11,
+			Description: "users unique external identity index",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				// an external account may be linked to one user only, users without any are left out
+				return createIndexes(ctx, db.Collection("users"),
+					mongo.IndexModel{
+						Keys: bson.D{{Key: "identities.issuer", Value: 1}, {Key: "identities.subject", Value: 1}},
+						Options: options.Index().SetName("identities_unique").SetUnique(true).
+							SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+					},
+				)
+			},
+		},
+		{
+			Version:     12,
+			Description: "visits history index",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("visits"),
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "checked_in_at", Value: -1}},
+						Options: options.Index().SetName("user_id_checked_in_at"),
+					},
+				)
+			},
+		},
+		{
+			Version:     13,
+			Description: "visits occupancy indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("visits"),
+					// open visits have no checked_out_at and sort first, for counting and the auto check-out sweep
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "checked_out_at", Value: 1}, {Key: "checked_in_at", Value: 1}},
+						Options: options.Index().SetName("checked_out_at_checked_in_at"),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "checked_in_at", Value: 1}, {Key: "location", Value: 1}},
+						Options: options.Index().SetName("checked_in_at_location"),
+					},
+				)
+			},
+		},
+		{
+			Version:     14,
+			Description: "reassign duplicate and missing users.member_id and make it unique",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				users := db.Collection("users")
+				if err := reassignMemberIDs(ctx, db); err != nil {
+					return err
+				}
+				return createIndexes(ctx, users, mongo.IndexModel{
+					Keys:    bson.D{{Key: "member_id", Value: 1}},
+					Options: options.Index().SetName("member_id_unique").SetUnique(true),
+				})
+			},
+		},
+		{
+			Version:     15,
+			Description: "payments indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("payments"),
+					// claiming an idempotency key is an insert that fails on this index
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "idempotency_key", Value: 1}},
+						Options: options.Index().SetName("user_id_idempotency_key_unique").SetUnique(true),
+					},
+					mongo.IndexModel{
+						Keys: bson.D{{Key: "provider", Value: 1}, {Key: "intent_id", Value: 1}},
+						Options: options.Index().SetName("provider_intent_id_unique").SetUnique(true).
+							SetPartialFilterExpression(bson.M{"intent_id": bson.M{"$exists": true}}),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+						Options: options.Index().SetName("user_id_created_at"),
+					},
+				)
+			},
+		},
+		{
+			Version:     16,
+			Description: "invoices indexes",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("invoices"),
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "number", Value: 1}},
+						Options: options.Index().SetName("number_unique").SetUnique(true),
+					},
+					// a payment is invoiced once, however many times its success is reported
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "payment_id", Value: 1}},
+						Options: options.Index().SetName("payment_id_unique").SetUnique(true),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "issued_at", Value: -1}},
+						Options: options.Index().SetName("user_id_issued_at"),
+					},
+					mongo.IndexModel{
+						Keys:    bson.D{{Key: "issued_at", Value: 1}},
+						Options: options.Index().SetName("issued_at"),
+					},
+				)
+			},
+		},
+		{
+			Version:     17,
+			Description: "users auto-renew index",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return createIndexes(ctx, db.Collection("users"), mongo.IndexModel{
+					Keys: bson.D{{Key: "membership_status", Value: 1}, {Key: "membership_expiry", Value: 1}},
+					// only the few members who opted in are scanned by the renewal scheduler
+					Options: options.Index().SetName("auto_renew_membership_expiry").
+						SetPartialFilterExpression(bson.M{"auto_renew": true}),
+				})
+			},
+		},
+		{
+			Version:     18,
+			Description: "membership statuses none and expired, status history and lapsed index",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				users := db.Collection("users")
+				// every user used to be created active, whether or not they ever bought a plan
+				_, err := users.UpdateMany(ctx, bson.M{
+					"membership_status":  "active",
+					"membership_plan_id": bson.M{"$exists": false},
+				}, bson.M{"$set": bson.M{"membership_status": "none"}})
+				if err != nil {
+					return err
+				}
+				// expired here rather than by the lifecycle job, which would email every one of them
+				_, err = users.UpdateMany(ctx, bson.M{
+					"membership_status": "active",
+					"membership_expiry": bson.M{"$lt": time.Now()},
+				}, bson.M{"$set": bson.M{"membership_status": "expired"}})
+				if err != nil {
+					return err
+				}
+
+				err = createIndexes(ctx, users, mongo.IndexModel{
+					Keys: bson.D{{Key: "membership_expiry", Value: 1}},
+					Options: options.Index().SetName("active_membership_expiry").
+						SetPartialFilterExpression(bson.M{"membership_status": "active"}),
+				})
+				if err != nil {
+					return err
+				}
+				return createIndexes(ctx, db.Collection("membership_status_history"), mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "at", Value: -1}},
+					Options: options.Index().SetName("user_id_at"),
+				})
+			},
+		},
+	}
+}
+
+func createIndexes(ctx context.Context, collection *mongo.Collection, models ...mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateMany(ctx, models)
+	return err
+}
+
+// reassignMemberIDs gives a fresh member ID from the member number counter to every user without
+// one and to all but the earliest registered holder of a duplicated one. Member IDs used to be
+// derived from the registration time, so members who signed up in the same second shared one.
+func reassignMemberIDs(ctx context.Context, db *mongo.Database) error {
+	users := db.Collection("users")
+	type holder struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		MemberID string             `bson:"member_id"`
+		JoinDate time.Time          `bson:"join_date"`
+	}
+
+	var reassign []holder
+	missing, err := users.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"member_id": bson.M{"$exists": false}},
+		bson.M{"member_id": nil},
+		bson.M{"member_id": ""},
+	}})
+	if err != nil {
+		return err
+	}
+	if err := missing.All(ctx, &reassign); err != nil {
+		return err
+	}
+
+	duplicates, err := users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"member_id": bson.M{"$type": "string", "$ne": ""}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$member_id",
+			"holders": bson.M{"$push": bson.M{"_id": "$_id", "member_id": "$member_id", "join_date": "$join_date"}},
+		}}},
+		{{Key: "$match", Value: bson.M{"holders.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var groups []struct {
+		Holders []holder `bson:"holders"`
+	}
+	if err := duplicates.All(ctx, &groups); err != nil {
+		return err
+	}
+	for _, group := range groups {
+		// the earliest member keeps the ID printed on their card
+		reassign = append(reassign, group.Holders[1:]...)
+	}
+
+	counters := db.Collection("counters")
+	for _, user := range reassign {
+		var counter struct {
+			Value int64 `bson:"value"`
+		}
+		err := counters.FindOneAndUpdate(ctx,
+			bson.M{"_id": models.MemberIDCounter},
+			bson.M{"$inc": bson.M{"value": int64(1)}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&counter)
+		if err != nil {
+			return err
+		}
+
+		joined := user.JoinDate
+		if joined.IsZero() {
+			joined = user.ID.Timestamp()
+		}
+		memberID := models.FormatMemberID(joined.Year(), counter.Value)
+		if _, err := users.UpdateByID(ctx, user.ID, bson.M{"$set": bson.M{"member_id": memberID}}); err != nil {
+			return err
+		}
+		log.Printf("Reassigned member ID of user %s from %q to %s", user.ID.Hex(), user.MemberID, memberID)
+	}
+	return nil
+}
+
+// parkDuplicateEmails lets the earliest created account keep an email address several users
+// share and moves the others to a unique address on the reserved .invalid domain, keeping the
+// original in duplicate_email so staff can sort them out. Emails were never checked for
+// uniqueness atomically, so concurrent sign-ups could create duplicates.
+func parkDuplicateEmails(ctx context.Context, users *mongo.Collection) error {
+	duplicates, err := users.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"email": bson.M{"$type": "string"}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$email", "ids": bson.M{"$push": "$_id"}}}},
+		{{Key: "$match", Value: bson.M{"ids.1": bson.M{"$exists": true}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var groups []struct {
+		Email string               `bson:"_id"`
+		IDs   []primitive.ObjectID `bson:"ids"`
+	}
+	if err := duplicates.All(ctx, &groups); err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		for _, id := range group.IDs[1:] {
+			parked := id.Hex() + ".duplicate@invalid"
+			update := bson.M{"$set": bson.M{"email": parked, "duplicate_email": group.Email}}
+			if _, err := users.UpdateByID(ctx, id, update); err != nil {
+				return err
+			}
+			log.Printf("User %s shares email %q with an earlier account, moved it to %s", id.Hex(), group.Email, parked)
+		}
+	}
+	return nil
+}
+
+// backfillMissing sets field to value on every document that does not have it yet
+func backfillMissing(ctx context.Context, collection *mongo.Collection, field string, value interface{}) (int64, error) {
+	result, err := collection.UpdateMany(ctx,
+		bson.M{field: bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{field: value}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// TokenScope limits what a personal API token may be used for
+type TokenScope string
+
+const (
+	ScopeProfileRead    TokenScope = "profile:read"
+	ScopeMembershipRead TokenScope = "membership:read"
+	ScopeFitnessRead    TokenScope = "fitness:read"
+	ScopeFitnessWrite   TokenScope = "fitness:write"
+)
+
+// TokenScopes lists every scope a token can be granted
+func TokenScopes() []TokenScope {
+	return []TokenScope{ScopeProfileRead, ScopeMembershipRead, ScopeFitnessRead, ScopeFitnessWrite}
+}
+
+func (s TokenScope) IsValid() bool {
+	for _, scope := range TokenScopes() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APIToken is a personal access token for scripts and mobile clients. Only the SHA-256 of the
+// token is stored; Prefix keeps enough of it for members to tell their tokens apart.
+type APIToken struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID     primitive.ObjectID `json:"-" bson:"user_id"`
+	Name       string             `json:"name" bson:"name"`
+	TokenHash  string             `json:"-" bson:"token_hash"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	Scopes     []TokenScope       `json:"scopes" bson:"scopes"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+func (t *APIToken) HasScope(scope TokenScope) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) IsExpired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// ExternalIdentity links a user to an account at an external OpenID Connect provider.
+// Issuer and Subject together identify the account, the email is only what it had when linked.
+type ExternalIdentity struct {
+	Issuer   string    `json:"issuer" bson:"issuer"`
+	Subject  string    `json:"subject" bson:"subject"`
+	Email    string    `json:"email,omitempty" bson:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// InvoiceKind tells first purchases from renewals of the same plan and mid-period upgrades
+type InvoiceKind string
+
+const (
+	InvoicePurchase InvoiceKind = "purchase"
+	InvoiceRenewal  InvoiceKind = "renewal"
+	InvoiceUpgrade  InvoiceKind = "upgrade"
+)
+
+// Invoice records a membership charge for the member and for accounting. Seller and customer
+// details are copied in when it is issued, later profile changes don't alter issued invoices.
+type Invoice struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// Number is sequential within a year, e.g. INV-2026-000042
+	Number    string             `json:"number" bson:"number"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	PaymentID primitive.ObjectID `json:"payment_id" bson:"payment_id"`
+	Kind      InvoiceKind        `json:"kind" bson:"kind"`
+	Seller    InvoiceSeller      `json:"seller" bson:"seller"`
+	Customer  InvoiceCustomer    `json:"customer" bson:"customer"`
+	Lines     []InvoiceLine      `json:"lines" bson:"lines"`
+	Currency  string             `json:"currency" bson:"currency"`
+	// VATRate is in percent, 0 when the seller doesn't charge VAT
+	VATRate float64 `json:"vat_rate" bson:"vat_rate"`
+	// Subtotal, VATAmount and Total are in minor units, Total is what was charged
+	Subtotal    int64     `json:"subtotal" bson:"subtotal"`
+	VATAmount   int64     `json:"vat_amount" bson:"vat_amount"`
+	Total       int64     `json:"total" bson:"total"`
+	PeriodStart time.Time `json:"period_start" bson:"period_start"`
+	PeriodEnd   time.Time `json:"period_end" bson:"period_end"`
+	IssuedAt    time.Time `json:"issued_at" bson:"issued_at"`
+}
+
+type InvoiceSeller struct {
+	Name string `json:"name" bson:"name"`
+	// BIN is the seller's business identification number
+	BIN     string `json:"bin,omitempty" bson:"bin,omitempty"`
+	Address string `json:"address,omitempty" bson:"address,omitempty"`
+}
+
+type InvoiceCustomer struct {
+	Name     string `json:"name" bson:"name"`
+	Email    string `json:"email" bson:"email"`
+	MemberID string `json:"member_id,omitempty" bson:"member_id,omitempty"`
+}
+
+// InvoiceLine is one item charged, amounts are in minor units
+type InvoiceLine struct {
+	Description string             `json:"description" bson:"description"`
+	PlanID      primitive.ObjectID `json:"plan_id,omitempty" bson:"plan_id,omitempty"`
+	Quantity    int                `json:"quantity" bson:"quantity"`
+	NetAmount   int64              `json:"net_amount" bson:"net_amount"`
+	VATAmount   int64              `json:"vat_amount" bson:"vat_amount"`
+	Total       int64              `json:"total" bson:"total"`
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// ThrottleKind says what a LoginThrottle counts failures against
+type ThrottleKind string
+
+const (
+	ThrottleAccount ThrottleKind = "account"
+	ThrottleIP      ThrottleKind = "ip"
+)
+
+// ThrottleKey identifies one failure counter, e.g. password logins for one email address
+type ThrottleKey struct {
+	// Scope separates credential checks, so a correct password doesn't reset second factor failures
+	Scope   string       `json:"scope" bson:"scope"`
+	Kind    ThrottleKind `json:"kind" bson:"kind"`
+	Subject string       `json:"subject" bson:"subject"`
+}
+
+func (k ThrottleKey) ID() string {
+	return k.Scope + ":" + string(k.Kind) + ":" + k.Subject
+}
+
+// LoginThrottle counts recent failed credential checks for one ThrottleKey
+type LoginThrottle struct {
+	ID            string `json:"-" bson:"_id"`
+	ThrottleKey   `bson:",inline"`
+	Failures      int       `json:"failures" bson:"failures"`
+	LastFailureAt time.Time `json:"last_failure_at" bson:"last_failure_at"`
+	LockedUntil   time.Time `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+	// ExpiresAt is when the counter is forgotten if no further failures happen
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+// LoginAttempt is the audit record of a failed credential check
+type LoginAttempt struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Scope     string             `json:"scope" bson:"scope"`
+	Account   string             `json:"account" bson:"account"`
+	IP        string             `json:"ip" bson:"ip"`
+	UserAgent string             `json:"user_agent" bson:"user_agent"`
+	Status    int                `json:"status" bson:"status"`
+	// Locked is set when this failure locked the account
+	Locked    bool      `json:"locked" bson:"locked"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MemberIDCounter names the counter member numbers are allocated from
+const MemberIDCounter = "member_id"
+
+// legacyMemberNumberLength is the width of member numbers issued before they were allocated from
+// a counter. Those carry no check digit, allocated numbers are always longer.
+const legacyMemberNumberLength = 6
+
+// FormatMemberID builds the member ID for the allocated number of a member who joined in year,
+// e.g. GYM-2026-0001233. The last digit is a Luhn check digit over the year and the number, so
+// most typos made at the front desk are caught before any lookup.
+func FormatMemberID(year int, number int64) string {
+	digits := fmt.Sprintf("%04d%06d", year, number)
+	return fmt.Sprintf("GYM-%04d-%06d%d", year, number, luhnCheckDigit(digits))
+}
+
+// ValidMemberID reports whether id is well formed and, unless it is a legacy ID, whether its
+// check digit matches
+func ValidMemberID(id string) bool {
+	parts := strings.Split(id, "-")
+	if len(parts) != 3 || parts[0] != "GYM" || len(parts[1]) != 4 || !allDigits(parts[1]) || !allDigits(parts[2]) {
+		return false
+	}
+
+	number := parts[2]
+	if len(number) == legacyMemberNumberLength {
+		return true
+	}
+	if len(number) <= legacyMemberNumberLength {
+		return false
+	}
+	body, check := number[:len(number)-1], number[len(number)-1]
+	return luhnCheckDigit(parts[1]+body) == int(check-'0')
+}
+
+// luhnCheckDigit returns the digit that makes digits followed by it pass the Luhn check
+func luhnCheckDigit(digits string) int {
+	sum := 0
+	// walking from the right, every other digit starting with the rightmost one is doubled
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return (10 - sum%10) % 10
+}
+
+func allDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package models
+
+import "testing"
+
+func TestLuhnCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   int
+	}{
+		{"7992739871", 3},
+		{"0", 0},
+		{"1", 8},
+		{"2026000123", 3},
+		{"2026999999", 9},
+	}
+	for _, tt := range tests {
+		if got := luhnCheckDigit(tt.digits); got != tt.want {
+			t.Errorf("luhnCheckDigit(%q) = %d, want %d", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMemberID(t *testing.T) {
+	tests := []struct {
+		year   int
+		number int64
+		want   string
+	}{
+		{2026, 123, "GYM-2026-0001233"},
+		{2026, 1, "GYM-2026-0000011"},
+		{2025, 999999, "GYM-2025-9999991"},
+	}
+	for _, tt := range tests {
+		got := FormatMemberID(tt.year, tt.number)
+		if got != tt.want {
+			t.Errorf("FormatMemberID(%d, %d) = %q, want %q", tt.year, tt.number, got, tt.want)
+		}
+		if !ValidMemberID(got) {
+			t.Errorf("ValidMemberID(%q) = false for a formatted ID", got)
+		}
+	}
+}
+
+func TestValidMemberID(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{"allocated", "GYM-2026-0001233", true},
+		{"legacy without check digit", "GYM-2019-004211", true},
+		{"wrong check digit", "GYM-2026-0001234", false},
+		{"swapped digits", "GYM-2026-0002133", false},
+		{"typo in year", "GYM-2025-0001233", false},
+		{"too short", "GYM-2026-00012", false},
+		{"lowercase prefix", "gym-2026-0001233", false},
+		{"short year", "GYM-26-0001233", false},
+		{"letters in number", "GYM-2026-00012A7", false},
+		{"missing part", "GYM-0001233", false},
+		{"empty number", "GYM-2026-", false},
+		{"empty", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidMemberID(tt.id); got != tt.want {
+				t.Fatalf("ValidMemberID(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
 	"time"
 )
 
@@ -17,15 +18,64 @@ type MembershipPlan struct {
 	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
+// PriceMinor is the plan's price in minor currency units
+func (p *MembershipPlan) PriceMinor() int64 {
+	return int64(math.Round(p.Price * 100))
+}
+
 type MembershipStatus string
 
 const (
+	// StatusNone is a member who has never had a membership
+	StatusNone      MembershipStatus = "none"
 	StatusActive    MembershipStatus = "active"
 	StatusExpired   MembershipStatus = "expired"
 	StatusSuspended MembershipStatus = "suspended"
 	StatusCancelled MembershipStatus = "cancelled"
 )
 
+// membershipTransitions lists the statuses each status may change to. A membership is
+// (re)activated by paying for it from any status; only active and expired ones lapse further.
+var membershipTransitions = map[MembershipStatus][]MembershipStatus{
+	StatusNone:      {StatusActive},
+	StatusActive:    {StatusExpired, StatusSuspended, StatusCancelled},
+	StatusExpired:   {StatusActive, StatusSuspended, StatusCancelled},
+	StatusSuspended: {StatusActive, StatusCancelled},
+	StatusCancelled: {StatusActive},
+}
+
+// Valid reports whether s is one of the defined statuses
+func (s MembershipStatus) Valid() bool {
+	_, ok := membershipTransitions[s]
+	return ok
+}
+
+// CanBecome reports whether a membership in status s may change to status to
+func (s MembershipStatus) CanBecome(to MembershipStatus) bool {
+	if s == "" {
+		// users created before statuses were tracked
+		s = StatusNone
+	}
+	for _, allowed := range membershipTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// MembershipStatusChange records one transition of a member's membership status
+type MembershipStatusChange struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	From   MembershipStatus   `json:"from" bson:"from"`
+	To     MembershipStatus   `json:"to" bson:"to"`
+	Reason string             `json:"reason" bson:"reason"`
+	// ActorID is the staff member or member who made the change, nil for automatic changes
+	ActorID *primitive.ObjectID `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	At      time.Time           `json:"at" bson:"at"`
+}
+
 func GetDefaultPlans() []MembershipPlan {
 	now := time.Now()
 	return []MembershipPlan{
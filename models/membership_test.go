@@ -0,0 +1,61 @@
+package models
+
+import "testing"
+
+func TestMembershipStatusCanBecome(t *testing.T) {
+	statuses := []MembershipStatus{StatusNone, StatusActive, StatusExpired, StatusSuspended, StatusCancelled}
+	allowed := map[MembershipStatus][]MembershipStatus{
+		StatusNone:      {StatusActive},
+		StatusActive:    {StatusExpired, StatusSuspended, StatusCancelled},
+		StatusExpired:   {StatusActive, StatusSuspended, StatusCancelled},
+		StatusSuspended: {StatusActive, StatusCancelled},
+		StatusCancelled: {StatusActive},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := false
+			for _, status := range allowed[from] {
+				want = want || status == to
+			}
+			if got := from.CanBecome(to); got != want {
+				t.Errorf("%s.CanBecome(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+
+	tests := []struct {
+		name string
+		from MembershipStatus
+		to   MembershipStatus
+		want bool
+	}{
+		{"unset status is none", "", StatusActive, true},
+		{"unset status can't lapse", "", StatusExpired, false},
+		{"unknown status", "frozen", StatusActive, false},
+		{"to unknown status", StatusActive, "frozen", false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanBecome(tt.to); got != tt.want {
+			t.Errorf("%s: CanBecome = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMembershipStatusValid(t *testing.T) {
+	tests := []struct {
+		status MembershipStatus
+		want   bool
+	}{
+		{StatusNone, true},
+		{StatusActive, true},
+		{StatusCancelled, true},
+		{"", false},
+		{"Active", false},
+	}
+	for _, tt := range tests {
+		if got := tt.status.Valid(); got != tt.want {
+			t.Errorf("MembershipStatus(%q).Valid() = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
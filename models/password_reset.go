@@ -0,0 +1,21 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// PasswordResetToken is a single-use reset link. ID is the SHA-256 of the token that was
+// emailed, the raw token is never stored.
+type PasswordResetToken struct {
+	ID        string             `json:"-" bson:"_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	RequestIP string             `json:"request_ip" bson:"request_ip"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time         `json:"used_at,omitempty" bson:"used_at,omitempty"`
+}
+
+func (t *PasswordResetToken) IsUsable(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// PaymentStatus is where a membership payment is in its life
+type PaymentStatus string
+
+const (
+	// PaymentPending is waiting for the member to pay or for the provider to report the outcome
+	PaymentPending   PaymentStatus = "pending"
+	PaymentSucceeded PaymentStatus = "succeeded"
+	PaymentFailed    PaymentStatus = "failed"
+	// PaymentRefunded has had its whole amount returned, partial refunds leave it succeeded
+	PaymentRefunded PaymentStatus = "refunded"
+)
+
+// Payment is a member's purchase of a membership plan
+type Payment struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	PlanID primitive.ObjectID `json:"plan_id" bson:"plan_id"`
+	// Amount is in minor units of Currency, tiyn for tenge
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+	// IdempotencyKey is chosen by the client, retrying a purchase with the same key never charges twice
+	IdempotencyKey string          `json:"-" bson:"idempotency_key"`
+	Provider       string          `json:"provider" bson:"provider"`
+	IntentID       string          `json:"-" bson:"intent_id,omitempty"`
+	Status         PaymentStatus   `json:"status" bson:"status"`
+	FailureReason  string          `json:"failure_reason,omitempty" bson:"failure_reason,omitempty"`
+	RefundedAmount int64           `json:"refunded_amount,omitempty" bson:"refunded_amount,omitempty"`
+	Refunds        []PaymentRefund `json:"refunds,omitempty" bson:"refunds,omitempty"`
+	// Renewal payments are made by the renewal scheduler, which retries them until NextAttemptAt
+	// is cleared
+	Renewal       bool       `json:"renewal,omitempty" bson:"renewal,omitempty"`
+	Attempts      int        `json:"attempts,omitempty" bson:"attempts,omitempty"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty" bson:"next_attempt_at,omitempty"`
+	// PlanChange is set on payments upgrading a membership in the middle of its period
+	PlanChange *PlanChange `json:"plan_change,omitempty" bson:"plan_change,omitempty"`
+	// AppliedAt is when the paid plan was added to the member's membership, it is set exactly once
+	AppliedAt *time.Time `json:"applied_at,omitempty" bson:"applied_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" bson:"updated_at"`
+}
+
+// PaymentRefund is money returned for a payment, ID is the provider's refund ID
+type PaymentRefund struct {
+	ID        string    `json:"id" bson:"id"`
+	Amount    int64     `json:"amount" bson:"amount"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+// PlanChange is the proration of an upgrade: the member pays for the new plan for the rest of
+// the current period, less the unused part of the old plan. The expiry stays where it was.
+type PlanChange struct {
+	FromPlanID primitive.ObjectID `json:"from_plan_id" bson:"from_plan_id"`
+	// RemainingDays of the PeriodDays long current period were left when the change was priced
+	RemainingDays int `json:"remaining_days" bson:"remaining_days"`
+	PeriodDays    int `json:"period_days" bson:"period_days"`
+	// Charge is the new plan for the remaining days, Credit the old plan for them; Amount is the difference
+	Charge    int64     `json:"charge" bson:"charge"`
+	Credit    int64     `json:"credit" bson:"credit"`
+	PeriodEnd time.Time `json:"period_end" bson:"period_end"`
+}
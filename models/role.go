@@ -0,0 +1,44 @@
+package models
+
+type Role string
+
+const (
+	RoleMember    Role = "member"
+	RoleTrainer   Role = "trainer"
+	RoleFrontDesk Role = "front_desk"
+	RoleAdmin     Role = "admin"
+)
+
+// Roles lists every assignable role
+func Roles() []Role {
+	return []Role{RoleMember, RoleTrainer, RoleFrontDesk, RoleAdmin}
+}
+
+// RequiresTwoFactor reports whether accounts with this role must sign in with a second factor
+func (r Role) RequiresTwoFactor() bool {
+	return r == RoleAdmin || r == RoleFrontDesk
+}
+
+// Outranks reports whether r is strictly above other, staff may only act on accounts below them
+func (r Role) Outranks(other Role) bool {
+	return r.rank() > other.rank()
+}
+
+// rank is the role's position in Roles, unknown roles rank lowest
+func (r Role) rank() int {
+	for i, role := range Roles() {
+		if r == role {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r Role) IsValid() bool {
+	for _, role := range Roles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Session is a server-side login session. ID is the SHA-256 of the token held in the cookie,
+// so a leaked sessions collection cannot be replayed as cookies.
+type Session struct {
+	ID                string                 `json:"id" bson:"_id"`
+	UserID            primitive.ObjectID     `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Values            map[string]interface{} `json:"-" bson:"values"`
+	IP                string                 `json:"ip" bson:"ip"`
+	UserAgent         string                 `json:"user_agent" bson:"user_agent"`
+	CreatedAt         time.Time              `json:"created_at" bson:"created_at"`
+	LastSeenAt        time.Time              `json:"last_seen_at" bson:"last_seen_at"`
+	AbsoluteExpiresAt time.Time              `json:"expires_at" bson:"absolute_expires_at"`
+}
+
+// IsExpired applies both the absolute lifetime and the idle timeout
+func (s *Session) IsExpired(now time.Time, idleTimeout time.Duration) bool {
+	if !now.Before(s.AbsoluteExpiresAt) {
+		return true
+	}
+	return idleTimeout > 0 && now.Sub(s.LastSeenAt) > idleTimeout
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// TwoFactor holds a user's TOTP enrollment. Secrets and recovery code hashes never leave the server.
+type TwoFactor struct {
+	Enabled bool   `json:"enabled" bson:"enabled"`
+	Secret  string `json:"-" bson:"secret,omitempty"`
+	// PendingSecret is set during enrollment until the member proves their app works
+	PendingSecret string `json:"-" bson:"pending_secret,omitempty"`
+	// LastStep is the most recently accepted TOTP time step, earlier codes are rejected as replays
+	LastStep      int64     `json:"-" bson:"last_step,omitempty"`
+	RecoveryCodes []string  `json:"-" bson:"recovery_codes,omitempty"`
+	EnabledAt     time.Time `json:"enabled_at,omitempty" bson:"enabled_at,omitempty"`
+}
+
+// RecoveryCodesLeft is the number of unused recovery codes
+func (t *TwoFactor) RecoveryCodesLeft() int {
+	return len(t.RecoveryCodes)
+}
+
+// UseRecoveryCode consumes the recovery code with the given hash, reporting whether it existed
+func (t *TwoFactor) UseRecoveryCode(hash string) bool {
+	for i, stored := range t.RecoveryCodes {
+		if stored == hash {
+			remaining := make([]string, 0, len(t.RecoveryCodes)-1)
+			remaining = append(remaining, t.RecoveryCodes[:i]...)
+			t.RecoveryCodes = append(remaining, t.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
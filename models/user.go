@@ -2,25 +2,34 @@ package models
 
 import (
 	"SSE/auth"
-	"fmt"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
 
 type User struct {
-	ID               primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Name             string             `json:"name" bson:"name"`
-	Email            string             `json:"email" bson:"email"`
-	Password         string             `json:"password" bson:"password"`
-	MembershipPlanID primitive.ObjectID `json:"membership_plan_id,omitempty" bson:"membership_plan_id,omitempty"`
-	MembershipStatus MembershipStatus   `json:"membership_status" bson:"membership_status"`
-	MembershipExpiry time.Time          `json:"membership_expiry" bson:"membership_expiry"`
-	MemberID         string             `json:"member_id" bson:"member_id"`
-	JoinDate         time.Time          `json:"join_date" bson:"join_date"`
-	LastCheckIn      time.Time          `json:"last_check_in,omitempty" bson:"last_check_in,omitempty"`
-	TotalVisits      int                `json:"total_visits" bson:"total_visits"`
-	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt        time.Time          `json:"updated_at" bson:"updated_at"`
+	ID                 primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name               string             `json:"name" bson:"name"`
+	Email              string             `json:"email" bson:"email"`
+	EmailVerified      bool               `json:"email_verified" bson:"email_verified"`
+	PendingEmail       string             `json:"pending_email,omitempty" bson:"pending_email,omitempty"` // new address awaiting confirmation
+	VerificationSentAt time.Time          `json:"-" bson:"verification_sent_at,omitempty"`
+	Password           string             `json:"-" bson:"password"`
+	Role               Role               `json:"role" bson:"role"`
+	TwoFactor          TwoFactor          `json:"two_factor" bson:"two_factor,omitempty"`
+	Identities         []ExternalIdentity `json:"identities,omitempty" bson:"identities,omitempty"`
+	MembershipPlanID   primitive.ObjectID `json:"membership_plan_id,omitempty" bson:"membership_plan_id,omitempty"`
+	MembershipStatus   MembershipStatus   `json:"membership_status" bson:"membership_status"`
+	MembershipExpiry   time.Time          `json:"membership_expiry" bson:"membership_expiry"`
+	ScheduledPlanID    primitive.ObjectID `json:"scheduled_plan_id,omitempty" bson:"scheduled_plan_id,omitempty"`       // downgrade taking effect at the expiry
+	ScheduledPlanStart time.Time          `json:"scheduled_plan_start,omitempty" bson:"scheduled_plan_start,omitempty"` // set once a renewal paid for the downgrade, which starts then
+	MemberID           string             `json:"member_id" bson:"member_id"`
+	AutoRenew          bool               `json:"auto_renew" bson:"auto_renew,omitempty"` // charge RenewalMethod for the plan before expiry
+	RenewalMethod      string             `json:"-" bson:"renewal_method,omitempty"`
+	JoinDate           time.Time          `json:"join_date" bson:"join_date"`
+	LastCheckIn        time.Time          `json:"last_check_in,omitempty" bson:"last_check_in,omitempty"`
+	TotalVisits        int                `json:"total_visits" bson:"total_visits"`
+	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at" bson:"updated_at"`
 }
 
 func (u *User) HashPassword() error {
@@ -33,17 +42,17 @@ func (u *User) HashPassword() error {
 }
 
 func (u *User) CheckPassword(providedPassword string) bool {
-	return auth.CheckPassword(u.Password, providedPassword)
+	match, _ := auth.CheckPassword(u.Password, providedPassword)
+	return match
 }
 
-func (u *User) GenerateMemberID() {
-	year := time.Now().Year()
-	timestamp := time.Now().Unix()
-	u.MemberID = fmt.Sprintf("GYM-%d-%06d", year, timestamp%1000000)
+func (u *User) IsActiveMember() bool {
+	return u.IsActiveMemberAt(time.Now())
 }
 
-func (u *User) IsActiveMember() bool {
-	return u.MembershipStatus == StatusActive && time.Now().Before(u.MembershipExpiry)
+// IsActiveMemberAt reports whether u's membership is active at now, for callers keeping their own clock
+func (u *User) IsActiveMemberAt(now time.Time) bool {
+	return u.MembershipStatus == StatusActive && now.Before(u.MembershipExpiry)
 }
 
 func (u *User) DaysUntilExpiry() int {
@@ -56,3 +65,21 @@ func (u *User) DaysUntilExpiry() int {
 	}
 	return days
 }
+
+// EffectiveRole treats accounts created before roles existed as plain members
+func (u *User) EffectiveRole() Role {
+	if u.Role == "" {
+		return RoleMember
+	}
+	return u.Role
+}
+
+// HasIdentity reports whether the external account issuer/subject is linked to u
+func (u *User) HasIdentity(issuer, subject string) bool {
+	for _, identity := range u.Identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// CheckInMethod is how a member was identified at the door
+type CheckInMethod string
+
+const (
+	// CheckInManual is a member looked up by staff, e.g. by name or member ID
+	CheckInManual CheckInMethod = "manual"
+	// CheckInCard is a member card scanned at the front desk
+	CheckInCard CheckInMethod = "card"
+	// CheckInQR is the signed, rotating QR code from the member's profile scanned at the front desk
+	CheckInQR CheckInMethod = "qr"
+)
+
+// Valid reports whether m is a known check-in method
+func (m CheckInMethod) Valid() bool {
+	switch m {
+	case CheckInManual, CheckInCard, CheckInQR:
+		return true
+	}
+	return false
+}
+
+// Visit records one check-in of a member at the gym
+type Visit struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CheckedInAt time.Time          `json:"checked_in_at" bson:"checked_in_at"`
+	Location    string             `json:"location" bson:"location"`
+	Method      CheckInMethod      `json:"method" bson:"method"`
+	// StaffID is the staff member who checked the member in
+	StaffID primitive.ObjectID `json:"staff_id,omitempty" bson:"staff_id,omitempty"`
+	// CheckedOutAt is unset while the member is still in the gym
+	CheckedOutAt *time.Time `json:"checked_out_at,omitempty" bson:"checked_out_at,omitempty"`
+	// AutoCheckedOut marks visits closed by the timeout rather than by the member or staff
+	AutoCheckedOut bool `json:"auto_checked_out,omitempty" bson:"auto_checked_out,omitempty"`
+}
+
+// IsOpen reports whether the member hasn't checked out of this visit yet
+func (v *Visit) IsOpen() bool {
+	return v.CheckedOutAt == nil
+}
@@ -0,0 +1,76 @@
+package occupancy
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// heatmapTTL is how long a computed heatmap is served before it is rebuilt from the visit history
+const heatmapTTL = 15 * time.Minute
+
+// maxCachedHeatmaps bounds the cache, the location comes from public requests
+const maxCachedHeatmaps = 64
+
+// Heatmap is the average number of members present in each hour of the week, in server time.
+// Hours[0] is Monday and Hours[d][h] covers h:00 to h:59 of that day.
+type Heatmap struct {
+	Location    string         `json:"location,omitempty"`
+	Weeks       int            `json:"weeks"`
+	Hours       [7][24]float64 `json:"hours"`
+	GeneratedAt time.Time      `json:"generated_at"`
+}
+
+// Heatmap returns the hour-of-week heatmap for location, or for all locations when it is ""
+func (t *Tracker) Heatmap(ctx context.Context, location string) (*Heatmap, error) {
+	now := t.now()
+	t.mu.Lock()
+	cached, ok := t.heatmaps[location]
+	t.mu.Unlock()
+	if ok && now.Sub(cached.GeneratedAt) < heatmapTTL {
+		return cached, nil
+	}
+
+	since := now.AddDate(0, 0, -7*t.cfg.HeatmapWeeks)
+	visits, err := t.visits.ListSince(ctx, location, since)
+	if err != nil {
+		return nil, err
+	}
+
+	heatmap := &Heatmap{Location: location, Weeks: t.cfg.HeatmapWeeks, GeneratedAt: now}
+	for _, visit := range visits {
+		end := now
+		if visit.CheckedOutAt != nil && visit.CheckedOutAt.Before(now) {
+			end = *visit.CheckedOutAt
+		}
+		addPresence(&heatmap.Hours, visit.CheckedInAt.Local(), end.Local())
+	}
+	for day := range heatmap.Hours {
+		for hour := range heatmap.Hours[day] {
+			average := heatmap.Hours[day][hour] / float64(t.cfg.HeatmapWeeks)
+			heatmap.Hours[day][hour] = math.Round(average*10) / 10
+		}
+	}
+
+	t.mu.Lock()
+	if len(t.heatmaps) >= maxCachedHeatmaps {
+		clear(t.heatmaps)
+	}
+	t.heatmaps[location] = heatmap
+	t.mu.Unlock()
+	return heatmap, nil
+}
+
+// addPresence adds the fraction of every hour between start and end that a member was present
+func addPresence(hours *[7][24]float64, start, end time.Time) {
+	for start.Before(end) {
+		hourStart := time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, start.Location())
+		hourEnd := hourStart.Add(time.Hour)
+		if hourEnd.After(end) {
+			hourEnd = end
+		}
+		day := (int(start.Weekday()) + 6) % 7
+		hours[day][start.Hour()] += hourEnd.Sub(start).Hours()
+		start = hourEnd
+	}
+}
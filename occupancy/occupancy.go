@@ -0,0 +1,153 @@
+// Package occupancy keeps a live count of the members in the gym at each location, pushes changes
+// to subscribers and closes the visits of members who left without checking out.
+package occupancy
+
+import (
+	"SSE/config"
+	"SSE/store"
+	"context"
+	"log"
+	"maps"
+	"sync"
+	"time"
+)
+
+// Snapshot is the occupancy at one moment
+type Snapshot struct {
+	Locations map[string]int `json:"locations"`
+	Total     int            `json:"total"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Tracker holds the current Snapshot. The counts are always reloaded from the visits store, so
+// several servers sharing a database agree within one refresh interval.
+type Tracker struct {
+	cfg    config.OccupancyConfig
+	visits store.VisitRepository
+	now    func() time.Time
+
+	// changed wakes Run early after a check-in or check-out on this server
+	changed chan struct{}
+
+	mu          sync.Mutex
+	current     Snapshot
+	subscribers map[chan Snapshot]struct{}
+	closed      bool
+	heatmaps    map[string]*Heatmap
+}
+
+func New(cfg config.OccupancyConfig, visits store.VisitRepository) *Tracker {
+	return &Tracker{
+		cfg:         cfg,
+		visits:      visits,
+		now:         time.Now,
+		changed:     make(chan struct{}, 1),
+		current:     Snapshot{Locations: map[string]int{}},
+		subscribers: make(map[chan Snapshot]struct{}),
+		heatmaps:    make(map[string]*Heatmap),
+	}
+}
+
+// Run closes stale visits and reloads the counts every refresh interval, or sooner after Notify,
+// until ctx is done
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		t.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-t.changed:
+		}
+	}
+}
+
+// Notify tells the tracker that a visit was opened or closed
+func (t *Tracker) Notify() {
+	select {
+	case t.changed <- struct{}{}:
+	default:
+		// a refresh is already pending and will see this change too
+	}
+}
+
+// Current returns the latest snapshot
+func (t *Tracker) Current() Snapshot {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current
+}
+
+// Subscribe returns a channel receiving every new snapshot, starting with the current one, and a
+// function to unsubscribe. The channel is closed on unsubscribe and when the tracker is closed.
+// A subscriber that falls behind only misses intermediate snapshots, never the latest.
+func (t *Tracker) Subscribe() (<-chan Snapshot, func()) {
+	updates := make(chan Snapshot, 1)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		close(updates)
+		return updates, func() {}
+	}
+	updates <- t.current
+	t.subscribers[updates] = struct{}{}
+
+	return updates, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if _, ok := t.subscribers[updates]; ok {
+			delete(t.subscribers, updates)
+			close(updates)
+		}
+	}
+}
+
+// Close ends every subscription, it is meant for server shutdown so open streams don't hold it up
+func (t *Tracker) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	for updates := range t.subscribers {
+		delete(t.subscribers, updates)
+		close(updates)
+	}
+}
+
+func (t *Tracker) refresh(ctx context.Context) {
+	now := t.now()
+	closed, err := t.visits.CloseStale(ctx, now.Add(-t.cfg.AutoCheckOut), t.cfg.AutoCheckOut)
+	if err != nil {
+		log.Printf("occupancy: failed to close stale visits: %v", err)
+	} else if closed > 0 {
+		log.Printf("occupancy: automatically checked out %d visit(s)", closed)
+	}
+
+	counts, err := t.visits.CountOpen(ctx)
+	if err != nil {
+		log.Printf("occupancy: failed to count open visits: %v", err)
+		return
+	}
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if maps.Equal(counts, t.current.Locations) && !t.current.UpdatedAt.IsZero() {
+		return
+	}
+	t.current = Snapshot{Locations: counts, Total: total, UpdatedAt: now}
+	for updates := range t.subscribers {
+		// replace an undelivered snapshot with the newer one
+		select {
+		case <-updates:
+		default:
+		}
+		updates <- t.current
+	}
+}
@@ -0,0 +1,130 @@
+package occupancy
+
+import (
+	"SSE/config"
+	"SSE/models"
+	"SSE/store"
+	"context"
+	"errors"
+	"maps"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testNow = time.Date(2026, 3, 10, 18, 0, 0, 0, time.UTC)
+
+func newTestTracker(now *time.Time) (*Tracker, store.VisitRepository) {
+	visits := store.NewMemoryStore().Visits
+	tracker := New(config.OccupancyConfig{AutoCheckOut: 3 * time.Hour, RefreshInterval: time.Minute, HeatmapWeeks: 1}, visits)
+	tracker.now = func() time.Time { return *now }
+	return tracker, visits
+}
+
+func checkIn(t *testing.T, visits store.VisitRepository, userID primitive.ObjectID, location string, at time.Time) {
+	t.Helper()
+	visit := models.Visit{UserID: userID, Location: location, CheckedInAt: at, Method: models.CheckInManual}
+	if err := visits.Create(context.Background(), &visit); err != nil {
+		t.Fatalf("Create visit: %v", err)
+	}
+}
+
+func TestTrackerCounts(t *testing.T) {
+	ctx := context.Background()
+	now := testNow
+	tracker, visits := newTestTracker(&now)
+	annabel, boris, chen := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	checkIn(t, visits, annabel, "downtown", now.Add(-time.Hour))
+	checkIn(t, visits, boris, "downtown", now.Add(-30*time.Minute))
+	checkIn(t, visits, chen, "riverside", now.Add(-10*time.Minute))
+	tracker.refresh(ctx)
+	assertSnapshot(t, tracker.Current(), map[string]int{"downtown": 2, "riverside": 1})
+
+	if _, err := visits.CheckOut(ctx, boris, now); err != nil {
+		t.Fatalf("CheckOut: %v", err)
+	}
+	if _, err := visits.CheckOut(ctx, boris, now); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("second CheckOut: %v, want ErrNotFound", err)
+	}
+	tracker.refresh(ctx)
+	assertSnapshot(t, tracker.Current(), map[string]int{"downtown": 1, "riverside": 1})
+}
+
+func TestTrackerAutoCheckOut(t *testing.T) {
+	ctx := context.Background()
+	now := testNow
+	tracker, visits := newTestTracker(&now)
+	stayed, forgot := primitive.NewObjectID(), primitive.NewObjectID()
+
+	checkIn(t, visits, forgot, "downtown", now.Add(-3*time.Hour-time.Minute))
+	checkIn(t, visits, stayed, "downtown", now.Add(-3*time.Hour+time.Minute))
+	tracker.refresh(ctx)
+	assertSnapshot(t, tracker.Current(), map[string]int{"downtown": 1})
+
+	history, _, _ := visits.ListByUser(ctx, forgot, 0, 10)
+	visit := history[0]
+	if visit.IsOpen() || !visit.AutoCheckedOut {
+		t.Fatalf("forgotten visit open = %v, auto checked out = %v, want it closed automatically", visit.IsOpen(), visit.AutoCheckedOut)
+	}
+	if stay := visit.CheckedOutAt.Sub(visit.CheckedInAt); stay != 3*time.Hour {
+		t.Fatalf("forgotten visit recorded a stay of %v, want 3h", stay)
+	}
+
+	now = now.Add(2 * time.Minute)
+	tracker.refresh(ctx)
+	assertSnapshot(t, tracker.Current(), map[string]int{})
+	history, _, _ = visits.ListByUser(ctx, stayed, 0, 10)
+	if !history[0].AutoCheckedOut {
+		t.Fatal("visit past the timeout on the next refresh wasn't closed")
+	}
+	if _, err := visits.CheckOut(ctx, stayed, now); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("checking out of an auto-closed visit: %v, want ErrNotFound", err)
+	}
+}
+
+func TestTrackerSubscribe(t *testing.T) {
+	ctx := context.Background()
+	now := testNow
+	tracker, visits := newTestTracker(&now)
+	tracker.refresh(ctx)
+
+	updates, unsubscribe := tracker.Subscribe()
+	assertSnapshot(t, <-updates, map[string]int{})
+
+	checkIn(t, visits, primitive.NewObjectID(), "downtown", now)
+	tracker.refresh(ctx)
+	checkIn(t, visits, primitive.NewObjectID(), "downtown", now)
+	tracker.refresh(ctx)
+	// a subscriber that fell behind gets only the latest snapshot
+	assertSnapshot(t, <-updates, map[string]int{"downtown": 2})
+
+	tracker.refresh(ctx)
+	select {
+	case snapshot := <-updates:
+		t.Fatalf("unchanged counts were pushed: %+v", snapshot)
+	default:
+	}
+
+	unsubscribe()
+	if _, open := <-updates; open {
+		t.Fatal("updates still open after unsubscribing")
+	}
+	tracker.Close()
+	late, _ := tracker.Subscribe()
+	if _, open := <-late; open {
+		t.Fatal("subscribing to a closed tracker returned an open channel")
+	}
+}
+
+func assertSnapshot(t *testing.T, snapshot Snapshot, want map[string]int) {
+	t.Helper()
+	total := 0
+	for _, count := range want {
+		total += count
+	}
+	if !maps.Equal(snapshot.Locations, want) || snapshot.Total != total {
+		t.Fatalf("snapshot %v with %d in total, want %v with %d", snapshot.Locations, snapshot.Total, want, total)
+	}
+}
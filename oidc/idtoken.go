@@ -0,0 +1,363 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// clockSkew is how far our clock and the provider's may disagree
+	clockSkew = time.Minute
+	// keyCacheTTL is how long fetched signing keys are trusted before they are fetched again
+	keyCacheTTL = time.Hour
+	// minKeyRefresh stops tokens with unknown key IDs from making us hammer the JWKS endpoint
+	minKeyRefresh = time.Minute
+)
+
+// idTokenClaims are the ID token claims the relying party checks or uses
+type idTokenClaims struct {
+	Issuer          string       `json:"iss"`
+	Subject         string       `json:"sub"`
+	Audience        audience     `json:"aud"`
+	AuthorizedParty string       `json:"azp"`
+	Expiry          float64      `json:"exp"`
+	IssuedAt        float64      `json:"iat"`
+	Nonce           string       `json:"nonce"`
+	Email           string       `json:"email"`
+	EmailVerified   flexibleBool `json:"email_verified"`
+	Name            string       `json:"name"`
+}
+
+// audience accepts both forms of the aud claim, a single string or an array
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// flexibleBool accepts true as well as "true", some providers send email_verified as a string
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case bool:
+		*b = flexibleBool(v)
+	case string:
+		*b = flexibleBool(v == "true")
+	default:
+		*b = false
+	}
+	return nil
+}
+
+// verifyIDToken checks the token's signature against the provider keys and validates its claims
+// as OpenID Connect Core 3.1.3.7 requires
+func (rp *RelyingParty) verifyIDToken(ctx context.Context, ep *endpoints, raw, nonce string) (*idTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("id_token is not a signed JWT")
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid id_token header: %w", err)
+	}
+	alg, ok := algorithms[header.Algorithm]
+	if !ok {
+		// this also turns away "none" and the HMAC algorithms, which would trust the client secret
+		return nil, fmt.Errorf("id_token uses unsupported algorithm %q", header.Algorithm)
+	}
+
+	key, err := rp.signingKey(ctx, ep, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("invalid id_token signature encoding")
+	}
+	if err := alg.verify(key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims idTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid id_token payload: %w", err)
+	}
+
+	now := rp.now()
+	switch {
+	case claims.Issuer != ep.Issuer:
+		return nil, fmt.Errorf("id_token issuer %q does not match %q", claims.Issuer, ep.Issuer)
+	case claims.Subject == "":
+		return nil, errors.New("id_token has no subject")
+	case !claims.Audience.contains(rp.cfg.ClientID):
+		return nil, errors.New("id_token was not issued for this client")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != rp.cfg.ClientID:
+		return nil, errors.New("id_token azp does not name this client")
+	case claims.Expiry == 0 || now.After(unixTime(claims.Expiry).Add(clockSkew)):
+		return nil, errors.New("id_token has expired")
+	case claims.IssuedAt == 0 || unixTime(claims.IssuedAt).After(now.Add(clockSkew)):
+		return nil, errors.New("id_token was issued in the future")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, errors.New("id_token nonce does not match the login")
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+// algorithm verifies one JWS signature algorithm
+type algorithm struct {
+	hash crypto.Hash
+	// family is "RSA", "PSS" or "EC"
+	family string
+	curve  elliptic.Curve
+}
+
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256, family: "RSA"},
+	"RS384": {hash: crypto.SHA384, family: "RSA"},
+	"RS512": {hash: crypto.SHA512, family: "RSA"},
+	"PS256": {hash: crypto.SHA256, family: "PSS"},
+	"PS384": {hash: crypto.SHA384, family: "PSS"},
+	"PS512": {hash: crypto.SHA512, family: "PSS"},
+	"ES256": {hash: crypto.SHA256, family: "EC", curve: elliptic.P256()},
+	"ES384": {hash: crypto.SHA384, family: "EC", curve: elliptic.P384()},
+	"ES512": {hash: crypto.SHA512, family: "EC", curve: elliptic.P521()},
+}
+
+var errBadSignature = errors.New("id_token signature is invalid")
+
+func (a algorithm) verify(key crypto.PublicKey, signed, signature []byte) error {
+	h := a.hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		switch a.family {
+		case "RSA":
+			err = rsa.VerifyPKCS1v15(pub, a.hash, digest, signature)
+		case "PSS":
+			err = rsa.VerifyPSS(pub, a.hash, digest, signature, nil)
+		default:
+			return errBadSignature
+		}
+		if err != nil {
+			return errBadSignature
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if a.family != "EC" || pub.Curve != a.curve {
+			return errBadSignature
+		}
+		// JWS carries the raw r||s pair, each left-padded to the curve size
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errBadSignature
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errBadSignature
+		}
+		return nil
+	default:
+		return errBadSignature
+	}
+}
+
+// keySet caches the provider's signing keys by key ID
+type keySet struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// signingKey returns the provider key kid, refetching the JWKS when the key is unknown so
+// that key rotation at the provider is picked up
+func (rp *RelyingParty) signingKey(ctx context.Context, ep *endpoints, kid string) (crypto.PublicKey, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	now := rp.now()
+	fresh := now.Sub(rp.keys.fetchedAt) < keyCacheTTL
+	if key, ok := rp.keys.lookup(kid); ok && fresh {
+		return key, nil
+	}
+	if !rp.keys.fetchedAt.IsZero() && now.Sub(rp.keys.fetchedAt) < minKeyRefresh {
+		return nil, fmt.Errorf("id_token is signed with unknown key %q", kid)
+	}
+
+	keys, err := rp.fetchKeys(ctx, ep.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	rp.keys = keySet{keys: keys, fetchedAt: now}
+
+	if key, ok := rp.keys.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("id_token is signed with unknown key %q", kid)
+}
+
+// lookup finds kid, a token without a key ID is accepted only when the provider has a single key
+func (ks keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if key, ok := ks.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// jsonWebKey holds the RFC 7517 fields of the RSA and EC public keys we accept
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+func (rp *RelyingParty) fetchKeys(ctx context.Context, jwksURL string) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	status, err := rp.doJSON(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("jwks request failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("jwks request returned status %d", status)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// keys we can't use are skipped rather than failing the whole set
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 || n.BitLen() < 2048 {
+			return nil, errors.New("unacceptable RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC key is not on its curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
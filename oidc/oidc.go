@@ -0,0 +1,215 @@
+// Package oidc signs members in through an external OpenID Connect provider using the
+// authorization code flow with PKCE. ID tokens are checked against the provider's published keys.
+package oidc
+
+import (
+	"SSE/config"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxResponseSize bounds what is read from the provider
+const maxResponseSize = 1 << 20
+
+// Identity is what the provider vouches for about the person who signed in
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an identity provider members can sign in with
+type Provider interface {
+	// DisplayName labels the sign-in button
+	DisplayName() string
+	// AuthCodeURL is where the browser is sent to sign in, state and nonce are echoed back
+	AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error)
+	// Exchange redeems the code from the callback and returns the verified identity
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// New returns the provider described by cfg, or nil when OIDC sign-in is disabled
+func New(cfg config.OIDCConfig) Provider {
+	if !cfg.Enabled {
+		return nil
+	}
+	rp := &RelyingParty{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.HTTPTimeout},
+		now:    time.Now,
+	}
+	if cfg.AuthorizationURL != "" {
+		rp.endpoints = &endpoints{
+			Issuer:                cfg.Issuer,
+			AuthorizationEndpoint: cfg.AuthorizationURL,
+			TokenEndpoint:         cfg.TokenURL,
+			JWKSURI:               cfg.JWKSURL,
+		}
+	}
+	return rp
+}
+
+// CodeChallenge is the S256 PKCE challenge sent in place of codeVerifier
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RelyingParty talks to a standard OpenID Connect provider
+type RelyingParty struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	endpoints *endpoints
+	keys      keySet
+}
+
+// endpoints is the part of the discovery document the relying party uses
+type endpoints struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func (rp *RelyingParty) DisplayName() string {
+	return rp.cfg.DisplayName
+}
+
+func (rp *RelyingParty) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	ep, err := rp.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", rp.cfg.ClientID)
+	query.Set("redirect_uri", rp.cfg.RedirectURL)
+	query.Set("scope", strings.Join(rp.cfg.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(codeVerifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(ep.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return ep.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (rp *RelyingParty) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	ep, err := rp.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", rp.cfg.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", rp.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if rp.cfg.ClientSecret != "" {
+		// RFC 6749 2.3.1: the credentials are form-encoded before going into the basic auth header
+		req.SetBasicAuth(url.QueryEscape(rp.cfg.ClientID), url.QueryEscape(rp.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := rp.doJSON(req, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	if status != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token request rejected with status %d: %s %s", status, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	claims, err := rp.verifyIDToken(ctx, ep, tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Issuer:        claims.Issuer,
+		Subject:       claims.Subject,
+		Email:         strings.TrimSpace(claims.Email),
+		EmailVerified: bool(claims.EmailVerified),
+		Name:          strings.TrimSpace(claims.Name),
+	}, nil
+}
+
+// discover returns the provider endpoints, fetching the discovery document on first use
+func (rp *RelyingParty) discover(ctx context.Context) (*endpoints, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.endpoints != nil {
+		return rp.endpoints, nil
+	}
+
+	wellKnown := strings.TrimRight(rp.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ep endpoints
+	status, err := rp.doJSON(req, &ep)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("discovery returned status %d", status)
+	}
+	// OpenID Connect Discovery 4.3: the document must be for exactly the issuer we asked about
+	if ep.Issuer != rp.cfg.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q, expected %q", ep.Issuer, rp.cfg.Issuer)
+	}
+	if ep.AuthorizationEndpoint == "" || ep.TokenEndpoint == "" || ep.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing an endpoint")
+	}
+
+	rp.endpoints = &ep
+	return rp.endpoints, nil
+}
+
+// doJSON performs req and decodes the JSON body into target, returning the status code
+func (rp *RelyingParty) doJSON(req *http.Request, target interface{}) (int, error) {
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(target); err != nil {
+		return resp.StatusCode, fmt.Errorf("invalid JSON response with status %d: %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, nil
+}
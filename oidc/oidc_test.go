@@ -0,0 +1,464 @@
+package oidc
+
+import (
+	"SSE/config"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testClientID = "gym-web"
+
+// testRSAKey signs the mock provider's tokens, generating it once keeps the tests fast
+var testRSAKey = func() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}()
+
+// mockIdP is an OpenID Connect provider serving discovery, a token endpoint that checks PKCE and
+// a JWKS, issuing whatever ID token the test hands it for a code
+type mockIdP struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	keys        []jsonWebKey
+	challenges  map[string]string
+	idTokens    map[string]string
+	jwksFetches int
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	idp := &mockIdP{
+		keys:       []jsonWebKey{rsaJWK("rsa-1", &testRSAKey.PublicKey)},
+		challenges: make(map[string]string),
+		idTokens:   make(map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(endpoints{
+			Issuer:                idp.server.URL,
+			AuthorizationEndpoint: idp.server.URL + "/authorize",
+			TokenEndpoint:         idp.server.URL + "/token",
+			JWKSURI:               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksFetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": idp.keys})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize plays the browser signing in at authURL: the code it returns is redeemed for idToken
+// only with the verifier matching the PKCE challenge in authURL
+func (idp *mockIdP) authorize(t *testing.T, authURL, idToken string) string {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parse authorization URL: %v", err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + parsed.Query().Get("state")
+	idp.challenges[code] = parsed.Query().Get("code_challenge")
+	idp.idTokens[code] = idToken
+	return code
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := r.PostFormValue("code")
+	challenge, ok := idp.challenges[code]
+	if !ok || r.PostFormValue("client_id") != testClientID || CodeChallenge(r.PostFormValue("code_verifier")) != challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+	// codes are single use
+	delete(idp.challenges, code)
+	json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idTokens[code], "token_type": "Bearer"})
+}
+
+func (idp *mockIdP) addKey(key jsonWebKey) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys = append(idp.keys, key)
+}
+
+func (idp *mockIdP) fetches() int {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	return idp.jwksFetches
+}
+
+// relyingParty is a client of idp whose clock reads *now
+func (idp *mockIdP) relyingParty(now *time.Time) *RelyingParty {
+	rp := New(config.OIDCConfig{
+		Enabled:     true,
+		Issuer:      idp.server.URL,
+		ClientID:    testClientID,
+		Scopes:      []string{"openid", "email", "profile"},
+		RedirectURL: "https://gym.example/oidc/callback",
+		HTTPTimeout: 5 * time.Second,
+	}).(*RelyingParty)
+	rp.now = func() time.Time { return *now }
+	return rp
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		KeyType: "RSA",
+		KeyID:   kid,
+		Use:     "sig",
+		N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		KeyType: "EC",
+		KeyID:   kid,
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:       base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signRS256 builds a JWT of claims signed with testRSAKey under kid
+func signRS256(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encodeSegment(t, map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, testRSAKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// signES256 builds a JWT of claims signed with key under kid
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// validClaims are the claims of a token idp issues at now for the login with nonce
+func validClaims(idp *mockIdP, now time.Time, nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            idp.server.URL,
+		"sub":            "user-42",
+		"aud":            testClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          " annabel@example.com ",
+		"email_verified": true,
+		"name":           "Annabel Lee",
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	now := time.Unix(1767225600, 0)
+	rp := idp.relyingParty(&now)
+
+	authURL, err := rp.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != idp.server.URL+"/authorize" {
+		t.Fatalf("authorization endpoint = %s, want the discovered one", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://gym.example/oidc/callback",
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        CodeChallenge("verifier-1"),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := parsed.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	if strings.Contains(authURL, "verifier-1") {
+		t.Error("authorization URL leaks the code verifier")
+	}
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// RFC 7636 appendix B
+	if got := CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Fatalf("CodeChallenge = %s", got)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	now := time.Unix(1767225600, 0)
+
+	tests := []struct {
+		name string
+		// token builds the ID token the provider issues from valid claims
+		token        func(t *testing.T, claims map[string]interface{}) string
+		verifier     string
+		nonce        string
+		wantErr      string
+		wantVerified bool
+	}{
+		{
+			name:         "valid token",
+			token:        func(t *testing.T, c map[string]interface{}) string { return signRS256(t, "rsa-1", c) },
+			wantVerified: true,
+		},
+		{
+			name: "unverified email",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["email_verified"] = false
+				return signRS256(t, "rsa-1", c)
+			},
+		},
+		{
+			name: "email verified sent as a string",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["email_verified"] = "true"
+				return signRS256(t, "rsa-1", c)
+			},
+			wantVerified: true,
+		},
+		{
+			name: "bad signature",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				parts := strings.Split(signRS256(t, "rsa-1", c), ".")
+				c["sub"] = "admin"
+				parts[1] = encodeSegment(t, c)
+				return strings.Join(parts, ".")
+			},
+			wantErr: "signature is invalid",
+		},
+		{
+			name: "unsigned token",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				return encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, c) + "."
+			},
+			wantErr: "unsupported algorithm",
+		},
+		{
+			name: "wrong audience",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["aud"] = "another-client"
+				return signRS256(t, "rsa-1", c)
+			},
+			wantErr: "not issued for this client",
+		},
+		{
+			name: "several audiences without this client as azp",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["aud"] = []string{testClientID, "another-client"}
+				return signRS256(t, "rsa-1", c)
+			},
+			wantErr: "azp",
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["iss"] = "https://evil.example"
+				return signRS256(t, "rsa-1", c)
+			},
+			wantErr: "issuer",
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["exp"] = now.Add(-2 * time.Minute).Unix()
+				return signRS256(t, "rsa-1", c)
+			},
+			wantErr: "expired",
+		},
+		{
+			name: "expired within the clock skew",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["exp"] = now.Add(-30 * time.Second).Unix()
+				return signRS256(t, "rsa-1", c)
+			},
+			wantVerified: true,
+		},
+		{
+			name: "issued in the future",
+			token: func(t *testing.T, c map[string]interface{}) string {
+				c["iat"] = now.Add(5 * time.Minute).Unix()
+				return signRS256(t, "rsa-1", c)
+			},
+			wantErr: "future",
+		},
+		{
+			name:    "nonce mismatch",
+			token:   func(t *testing.T, c map[string]interface{}) string { return signRS256(t, "rsa-1", c) },
+			nonce:   "another-login",
+			wantErr: "nonce",
+		},
+		{
+			name:     "wrong PKCE verifier",
+			token:    func(t *testing.T, c map[string]interface{}) string { return signRS256(t, "rsa-1", c) },
+			verifier: "stolen-code-without-verifier",
+			wantErr:  "invalid_grant",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			idp := newMockIdP(t)
+			clock := now
+			rp := idp.relyingParty(&clock)
+
+			authURL, err := rp.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-1")
+			if err != nil {
+				t.Fatalf("AuthCodeURL: %v", err)
+			}
+			code := idp.authorize(t, authURL, tt.token(t, validClaims(idp, now, "nonce-1")))
+
+			verifier, nonce := "verifier-1", "nonce-1"
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			identity, err := rp.Exchange(ctx, code, verifier, nonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Exchange = %v, want an error about %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			want := Identity{Issuer: idp.server.URL, Subject: "user-42", Email: "annabel@example.com", EmailVerified: tt.wantVerified, Name: "Annabel Lee"}
+			if *identity != want {
+				t.Fatalf("identity = %+v, want %+v", *identity, want)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	now := time.Unix(1767225600, 0)
+	rp := idp.relyingParty(&now)
+	ep, err := rp.discover(ctx)
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	verify := func(token string) error {
+		_, err := rp.verifyIDToken(ctx, ep, token, "nonce-1")
+		return err
+	}
+
+	if err := verify(signRS256(t, "rsa-1", validClaims(idp, now, "nonce-1"))); err != nil {
+		t.Fatalf("token signed with the published key: %v", err)
+	}
+	if err := verify(signRS256(t, "rsa-1", validClaims(idp, now, "nonce-1"))); err != nil || idp.fetches() != 1 {
+		t.Fatalf("second token: %v after %d JWKS fetches, want it verified from the cached keys", err, idp.fetches())
+	}
+
+	// the provider rotates to a new key, a token signed with it makes the keys be fetched again
+	// once the minimum refresh interval has passed
+	rotated, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	idp.addKey(ecJWK("ec-2", &rotated.PublicKey))
+	if err := verify(signES256(t, rotated, "ec-2", validClaims(idp, now, "nonce-1"))); err == nil || idp.fetches() != 1 {
+		t.Fatalf("unknown key right after a fetch: %v after %d fetches, want refused without fetching", err, idp.fetches())
+	}
+	now = now.Add(2 * time.Minute)
+	if err := verify(signES256(t, rotated, "ec-2", validClaims(idp, now, "nonce-1"))); err != nil || idp.fetches() != 2 {
+		t.Fatalf("rotated key: %v after %d fetches, want verified after a second fetch", err, idp.fetches())
+	}
+
+	// a key the provider never published is refused, and doesn't refetch until the interval passes
+	if err := verify(signRS256(t, "unpublished", validClaims(idp, now, "nonce-1"))); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Fatalf("unpublished key: %v, want an unknown key error", err)
+	}
+	if idp.fetches() != 2 {
+		t.Fatalf("%d JWKS fetches, an unknown key within the refresh interval must not fetch", idp.fetches())
+	}
+}
+
+func TestKeySetLookup(t *testing.T) {
+	single := keySet{keys: map[string]crypto.PublicKey{"a": &testRSAKey.PublicKey}}
+	several := keySet{keys: map[string]crypto.PublicKey{"a": &testRSAKey.PublicKey, "b": &testRSAKey.PublicKey}}
+
+	tests := []struct {
+		name string
+		set  keySet
+		kid  string
+		want bool
+	}{
+		{"known key", several, "a", true},
+		{"unknown key", several, "c", false},
+		{"no key ID with a single key", single, "", true},
+		{"no key ID with several keys", several, "", false},
+	}
+	for _, tt := range tests {
+		if _, ok := tt.set.lookup(tt.kid); ok != tt.want {
+			t.Errorf("%s: found = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestJSONWebKeyRejectsWeakRSA(t *testing.T) {
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if _, err := rsaJWK("weak", &weak.PublicKey).publicKey(); err == nil {
+		t.Fatal("1024 bit RSA key was accepted")
+	}
+	if _, err := rsaJWK("strong", &testRSAKey.PublicKey).publicKey(); err != nil {
+		t.Fatalf("2048 bit RSA key: %v", err)
+	}
+}
@@ -0,0 +1,224 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Test payment methods understood by the fake provider
+const (
+	FakeMethodSucceed = "fake_card_ok"
+	FakeMethodDecline = "fake_card_declined"
+	// FakeMethodAsync leaves the intent processing and reports the outcome by webhook, like 3-D Secure
+	FakeMethodAsync = "fake_card_async"
+)
+
+// FakeConfig configures the fake provider
+type FakeConfig struct {
+	// Allowed must be set to run the fake provider, which hands out paid memberships without
+	// charging anyone. It is meant for development and tests only.
+	Allowed bool `yaml:"allowed"`
+	// WebhookURL receives the events of intents confirmed with FakeMethodAsync, "" drops them
+	WebhookURL   string        `yaml:"webhook_url"`
+	WebhookDelay time.Duration `yaml:"webhook_delay"`
+}
+
+// FakeProvider keeps intents in memory and never moves money. It behaves like a real provider in
+// what the application relies on: idempotency keys, state checks and signed webhooks.
+type FakeProvider struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	intents map[string]*fakeIntent
+	// intentKeys and refundKeys map idempotency keys to what was created for them
+	intentKeys map[string]string
+	refundKeys map[string]*Refund
+}
+
+type fakeIntent struct {
+	Intent
+	refunded int64
+}
+
+// fakeWebhook is the body of the fake provider's webhook requests
+type fakeWebhook struct {
+	ID   string    `json:"id"`
+	Type EventType `json:"type"`
+	Data struct {
+		IntentID      string `json:"intent_id"`
+		Amount        int64  `json:"amount"`
+		FailureReason string `json:"failure_reason,omitempty"`
+	} `json:"data"`
+}
+
+func NewFakeProvider(cfg Config) *FakeProvider {
+	return &FakeProvider{
+		cfg:        cfg,
+		client:     &http.Client{Timeout: 10 * time.Second},
+		intents:    make(map[string]*fakeIntent),
+		intentKeys: make(map[string]string),
+		refundKeys: make(map[string]*Refund),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return ProviderFake
+}
+
+func (p *FakeProvider) CreateIntent(ctx context.Context, request IntentRequest) (*Intent, error) {
+	if request.Amount <= 0 {
+		return nil, fmt.Errorf("fake payments: amount must be positive")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if id, seen := p.intentKeys[request.IdempotencyKey]; seen && request.IdempotencyKey != "" {
+		intent := p.intents[id].Intent
+		return &intent, nil
+	}
+
+	intent := &fakeIntent{Intent: Intent{
+		ID:           "pi_fake_" + rand.Text(),
+		Status:       IntentRequiresConfirmation,
+		Amount:       request.Amount,
+		Currency:     request.Currency,
+		ClientSecret: "secret_fake_" + rand.Text(),
+	}}
+	p.intents[intent.ID] = intent
+	if request.IdempotencyKey != "" {
+		p.intentKeys[request.IdempotencyKey] = intent.ID
+	}
+	result := intent.Intent
+	return &result, nil
+}
+
+func (p *FakeProvider) Confirm(ctx context.Context, intentID, paymentMethod string) (*Intent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+	switch intent.Status {
+	case IntentSucceeded, IntentProcessing:
+		// confirming twice must not charge twice
+		result := intent.Intent
+		return &result, nil
+	}
+
+	switch paymentMethod {
+	case "":
+		return nil, ErrNoPaymentMethod
+	case FakeMethodSucceed:
+		intent.Status = IntentSucceeded
+		intent.FailureReason = ""
+	case FakeMethodDecline:
+		intent.Status = IntentFailed
+		intent.FailureReason = "card_declined"
+	case FakeMethodAsync:
+		intent.Status = IntentProcessing
+		go p.completeLater(intent.ID)
+	default:
+		intent.Status = IntentFailed
+		intent.FailureReason = "unsupported_payment_method"
+	}
+	result := intent.Intent
+	return &result, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, intentID string, amount int64, idempotencyKey string) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, seen := p.refundKeys[idempotencyKey]; seen && idempotencyKey != "" {
+		result := *refund
+		return &result, nil
+	}
+
+	intent, ok := p.intents[intentID]
+	if !ok {
+		return nil, ErrUnknownIntent
+	}
+	if intent.Status != IntentSucceeded {
+		return nil, ErrInvalidState
+	}
+	if amount <= 0 || intent.refunded+amount > intent.Amount {
+		return nil, ErrRefundTooLarge
+	}
+
+	intent.refunded += amount
+	refund := &Refund{ID: "re_fake_" + rand.Text(), IntentID: intentID, Amount: amount}
+	if idempotencyKey != "" {
+		p.refundKeys[idempotencyKey] = refund
+	}
+	result := *refund
+	return &result, nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, header http.Header) (*Event, error) {
+	if err := verifyWebhookSignature(p.cfg.WebhookSecret, payload, header.Get(SignatureHeader), time.Now(), p.cfg.WebhookTolerance); err != nil {
+		return nil, err
+	}
+
+	var webhook fakeWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil, fmt.Errorf("fake payments: malformed webhook: %w", err)
+	}
+	return &Event{
+		ID:            webhook.ID,
+		Type:          webhook.Type,
+		IntentID:      webhook.Data.IntentID,
+		Amount:        webhook.Data.Amount,
+		FailureReason: webhook.Data.FailureReason,
+	}, nil
+}
+
+// completeLater settles a processing intent after the configured delay and reports it by webhook
+func (p *FakeProvider) completeLater(intentID string) {
+	time.Sleep(p.cfg.Fake.WebhookDelay)
+
+	p.mu.Lock()
+	intent := p.intents[intentID]
+	intent.Status = IntentSucceeded
+	webhook := fakeWebhook{ID: "evt_fake_" + rand.Text(), Type: EventPaymentSucceeded}
+	webhook.Data.IntentID = intent.ID
+	webhook.Data.Amount = intent.Amount
+	p.mu.Unlock()
+
+	if p.cfg.Fake.WebhookURL == "" {
+		return
+	}
+	payload, err := json.Marshal(webhook)
+	if err != nil {
+		log.Printf("fake payments: failed to encode webhook: %v", err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, p.cfg.Fake.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("fake payments: failed to build webhook request: %v", err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SignatureHeader, SignWebhook(p.cfg.WebhookSecret, payload, time.Now()))
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		log.Printf("fake payments: failed to deliver webhook for %s: %v", intentID, err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		log.Printf("fake payments: webhook for %s was answered with %s", intentID, response.Status)
+	}
+}
@@ -0,0 +1,162 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"no provider", Config{WebhookSecret: "whsec_test"}, true},
+		{"fake without opt-in", Config{Provider: ProviderFake, WebhookSecret: "whsec_test"}, true},
+		{"fake without webhook secret", Config{Provider: ProviderFake, Fake: FakeConfig{Allowed: true}}, true},
+		{"fake allowed", Config{Provider: ProviderFake, WebhookSecret: "whsec_test", Fake: FakeConfig{Allowed: true}}, false},
+		{"unknown provider", Config{Provider: "acme", WebhookSecret: "whsec_test"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := New(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && provider.Name() != tt.cfg.Provider {
+				t.Fatalf("Name = %q, want %q", provider.Name(), tt.cfg.Provider)
+			}
+		})
+	}
+}
+
+func TestFakeCreateIntentIdempotency(t *testing.T) {
+	ctx := context.Background()
+	provider := NewFakeProvider(Config{})
+	first, err := provider.CreateIntent(ctx, IntentRequest{Amount: 1500000, Currency: "KZT", IdempotencyKey: "payment-1"})
+	if err != nil {
+		t.Fatalf("CreateIntent: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		request IntentRequest
+		same    bool
+		wantErr bool
+	}{
+		{"retry with the same key", IntentRequest{Amount: 1500000, Currency: "KZT", IdempotencyKey: "payment-1"}, true, false},
+		{"another key", IntentRequest{Amount: 1500000, Currency: "KZT", IdempotencyKey: "payment-2"}, false, false},
+		{"no key", IntentRequest{Amount: 1500000, Currency: "KZT"}, false, false},
+		{"no amount", IntentRequest{Currency: "KZT", IdempotencyKey: "payment-3"}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			intent, err := provider.CreateIntent(ctx, tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateIntent = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && (intent.ID == first.ID) != tt.same {
+				t.Fatalf("got intent %s, first was %s, want same %v", intent.ID, first.ID, tt.same)
+			}
+		})
+	}
+}
+
+func TestFakeConfirm(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		method     string
+		wantErr    error
+		wantStatus IntentStatus
+		wantReason string
+	}{
+		{"no payment method", "", ErrNoPaymentMethod, "", ""},
+		{"succeeding card", FakeMethodSucceed, nil, IntentSucceeded, ""},
+		{"declined card", FakeMethodDecline, nil, IntentFailed, "card_declined"},
+		{"unknown method", "tok_visa", nil, IntentFailed, "unsupported_payment_method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewFakeProvider(Config{})
+			intent, err := provider.CreateIntent(ctx, IntentRequest{Amount: 1500000, Currency: "KZT"})
+			if err != nil {
+				t.Fatalf("CreateIntent: %v", err)
+			}
+
+			confirmed, err := provider.Confirm(ctx, intent.ID, tt.method)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Confirm = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if confirmed.Status != tt.wantStatus || confirmed.FailureReason != tt.wantReason {
+				t.Fatalf("Confirm = %s (%q), want %s (%q)", confirmed.Status, confirmed.FailureReason, tt.wantStatus, tt.wantReason)
+			}
+		})
+	}
+
+	provider := NewFakeProvider(Config{})
+	if _, err := provider.Confirm(ctx, "pi_missing", FakeMethodSucceed); !errors.Is(err, ErrUnknownIntent) {
+		t.Fatalf("Confirm of unknown intent = %v, want ErrUnknownIntent", err)
+	}
+}
+
+func TestFakeConfirmTwiceKeepsOutcome(t *testing.T) {
+	ctx := context.Background()
+	provider := NewFakeProvider(Config{})
+	intent, _ := provider.CreateIntent(ctx, IntentRequest{Amount: 1500000, Currency: "KZT"})
+	if _, err := provider.Confirm(ctx, intent.ID, FakeMethodSucceed); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+
+	again, err := provider.Confirm(ctx, intent.ID, FakeMethodDecline)
+	if err != nil || again.Status != IntentSucceeded {
+		t.Fatalf("second Confirm = (%+v, %v), want the succeeded intent", again, err)
+	}
+}
+
+func TestFakeRefund(t *testing.T) {
+	ctx := context.Background()
+	provider := NewFakeProvider(Config{})
+	intent, _ := provider.CreateIntent(ctx, IntentRequest{Amount: 1000, Currency: "KZT"})
+	pending, _ := provider.CreateIntent(ctx, IntentRequest{Amount: 1000, Currency: "KZT"})
+	if _, err := provider.Confirm(ctx, intent.ID, FakeMethodSucceed); err != nil {
+		t.Fatalf("Confirm: %v", err)
+	}
+
+	// the steps run in order against the same intent
+	tests := []struct {
+		name     string
+		intentID string
+		amount   int64
+		key      string
+		wantErr  error
+	}{
+		{"partial refund", intent.ID, 600, "refund-1", nil},
+		{"retry of the partial refund", intent.ID, 600, "refund-1", nil},
+		{"more than what is left", intent.ID, 500, "refund-2", ErrRefundTooLarge},
+		{"the rest", intent.ID, 400, "refund-3", nil},
+		{"nothing left", intent.ID, 1, "refund-4", ErrRefundTooLarge},
+		{"zero amount", intent.ID, 0, "refund-5", ErrRefundTooLarge},
+		{"unconfirmed intent", pending.ID, 100, "refund-6", ErrInvalidState},
+		{"unknown intent", "pi_missing", 100, "refund-7", ErrUnknownIntent},
+	}
+	refunds := make(map[string]string)
+	for _, tt := range tests {
+		refund, err := provider.Refund(ctx, tt.intentID, tt.amount, tt.key)
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%s: Refund = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		if previous, seen := refunds[tt.key]; seen && previous != refund.ID {
+			t.Fatalf("%s: retry created refund %s, first was %s", tt.name, refund.ID, previous)
+		}
+		refunds[tt.key] = refund.ID
+	}
+}
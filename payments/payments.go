@@ -0,0 +1,125 @@
+// Package payments charges members through an external payment provider. Amounts are always in
+// minor units of the currency, tiyn for tenge.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// IntentStatus is where a payment intent is in its life
+type IntentStatus string
+
+const (
+	// IntentRequiresConfirmation is a new intent waiting for the member's payment details
+	IntentRequiresConfirmation IntentStatus = "requires_confirmation"
+	// IntentProcessing is a confirmed intent whose outcome arrives later by webhook
+	IntentProcessing IntentStatus = "processing"
+	IntentSucceeded  IntentStatus = "succeeded"
+	IntentFailed     IntentStatus = "failed"
+)
+
+// EventType names the webhook events the application acts on
+type EventType string
+
+const (
+	EventPaymentSucceeded EventType = "payment.succeeded"
+	EventPaymentFailed    EventType = "payment.failed"
+	EventRefundSucceeded  EventType = "refund.succeeded"
+)
+
+var (
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	ErrUnknownIntent    = errors.New("payment intent does not exist")
+	// ErrInvalidState is returned when an intent can't be confirmed or refunded in its current state
+	ErrInvalidState = errors.New("payment intent is in the wrong state")
+	// ErrRefundTooLarge is returned when refunds would exceed what was paid
+	ErrRefundTooLarge = errors.New("refund exceeds the amount paid")
+	// ErrNoPaymentMethod is returned when an intent is confirmed without a payment method
+	ErrNoPaymentMethod = errors.New("payment method is required")
+)
+
+// IntentRequest describes a charge to prepare
+type IntentRequest struct {
+	Amount      int64
+	Currency    string
+	Description string
+	// IdempotencyKey makes retries safe, the provider returns the existing intent for a key it has seen
+	IdempotencyKey string
+	Metadata       map[string]string
+}
+
+// Intent is the provider's record of one charge
+type Intent struct {
+	ID       string
+	Status   IntentStatus
+	Amount   int64
+	Currency string
+	// ClientSecret lets a browser SDK confirm the intent without server credentials
+	ClientSecret  string
+	FailureReason string
+}
+
+// Refund is money returned for a succeeded intent
+type Refund struct {
+	ID       string
+	IntentID string
+	Amount   int64
+}
+
+// Event is a verified webhook notification
+type Event struct {
+	ID            string
+	Type          EventType
+	IntentID      string
+	Amount        int64
+	FailureReason string
+}
+
+// Provider is a payment service provider. Implementations must honour idempotency keys so a
+// retried request never charges or refunds twice.
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, request IntentRequest) (*Intent, error)
+	// Confirm charges the intent with paymentMethod, a provider specific token for the member's card
+	Confirm(ctx context.Context, intentID, paymentMethod string) (*Intent, error)
+	// Refund returns amount of a succeeded intent to the member
+	Refund(ctx context.Context, intentID string, amount int64, idempotencyKey string) (*Refund, error)
+	// VerifyWebhook authenticates a webhook request and parses its event
+	VerifyWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// Config selects and configures the Provider built by New
+type Config struct {
+	// Provider is "fake", a stand-in that never moves money, for local runs
+	Provider string `yaml:"provider"`
+	Currency string `yaml:"currency"`
+	// WebhookSecret authenticates webhook requests from the provider
+	WebhookSecret     string        `yaml:"webhook_secret"`
+	WebhookSecretFile string        `yaml:"webhook_secret_file"`
+	WebhookTolerance  time.Duration `yaml:"webhook_tolerance"`
+	Fake              FakeConfig    `yaml:"fake"`
+}
+
+const ProviderFake = "fake"
+
+// New builds the Provider selected by cfg.Provider
+func New(cfg Config) (Provider, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, fmt.Errorf("payments.provider is required")
+	case ProviderFake:
+		if !cfg.Fake.Allowed {
+			return nil, fmt.Errorf("the fake payment provider doesn't charge anyone, set payments.fake.allowed to use it")
+		}
+		if cfg.WebhookSecret == "" {
+			return nil, fmt.Errorf("payments.webhook_secret is required")
+		}
+		return NewFakeProvider(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", cfg.Provider)
+	}
+}
@@ -0,0 +1,61 @@
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader carries "t=<unix time>,v1=<hex HMAC-SHA256 of t.payload>" on webhook requests.
+// Signing the time with the payload lets receivers reject replays of old deliveries.
+const SignatureHeader = "Payment-Signature"
+
+// SignWebhook returns the SignatureHeader value for payload sent at at
+func SignWebhook(secret string, payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + webhookMAC(secret, timestamp, payload)
+}
+
+// verifyWebhookSignature checks a SignatureHeader value and that it was made within tolerance of now
+func verifyWebhookSignature(secret string, payload []byte, header string, now time.Time, tolerance time.Duration) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			// several signatures are sent while the secret is being rotated
+			signatures = append(signatures, value)
+		}
+	}
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	expected := webhookMAC(secret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+func webhookMAC(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
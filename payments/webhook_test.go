@@ -0,0 +1,65 @@
+package payments
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	const secret = "whsec_test"
+	now := time.Unix(1767225600, 0)
+	payload := []byte(`{"id":"evt_1","type":"payment.succeeded"}`)
+	valid := SignWebhook(secret, payload, now)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		wantErr bool
+	}{
+		{"valid", payload, valid, false},
+		{"sent a little earlier", payload, SignWebhook(secret, payload, now.Add(-4*time.Minute)), false},
+		{"replayed after the tolerance", payload, SignWebhook(secret, payload, now.Add(-6*time.Minute)), true},
+		{"dated in the future", payload, SignWebhook(secret, payload, now.Add(6*time.Minute)), true},
+		{"other secret", payload, SignWebhook("whsec_other", payload, now), true},
+		{"tampered payload", []byte(`{"id":"evt_1","type":"payment.failed"}`), valid, true},
+		{"rotated secret among signatures", payload, valid + ",v1=" + webhookMAC("whsec_old", "1767225600", payload), false},
+		{"old secret only", payload, "t=1767225600,v1=" + webhookMAC("whsec_old", "1767225600", payload), true},
+		{"missing timestamp", payload, "v1=" + webhookMAC(secret, "1767225600", payload), true},
+		{"missing signature", payload, "t=1767225600", true},
+		{"empty header", payload, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyWebhookSignature(secret, tt.payload, tt.header, now, 5*time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyWebhookSignature = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("error %v is not ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestFakeVerifyWebhook(t *testing.T) {
+	provider := NewFakeProvider(Config{WebhookSecret: "whsec_test", WebhookTolerance: 5 * time.Minute})
+	payload := []byte(`{"id":"evt_1","type":"payment.failed","data":{"intent_id":"pi_1","amount":1500000,"failure_reason":"card_declined"}}`)
+	header := http.Header{}
+	header.Set(SignatureHeader, SignWebhook("whsec_test", payload, time.Now()))
+
+	event, err := provider.VerifyWebhook(payload, header)
+	if err != nil {
+		t.Fatalf("VerifyWebhook: %v", err)
+	}
+	want := Event{ID: "evt_1", Type: EventPaymentFailed, IntentID: "pi_1", Amount: 1500000, FailureReason: "card_declined"}
+	if *event != want {
+		t.Fatalf("event = %+v, want %+v", *event, want)
+	}
+
+	if _, err := provider.VerifyWebhook(payload, http.Header{}); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("unsigned webhook: err = %v, want ErrInvalidSignature", err)
+	}
+}
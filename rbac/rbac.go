@@ -0,0 +1,65 @@
+package rbac
+
+import "SSE/models"
+
+type Permission string
+
+const (
+	// PermManagePlans allows replacing the membership plan catalogue
+	PermManagePlans Permission = "plans:manage"
+	// PermViewMembers allows reading other members' records
+	PermViewMembers Permission = "members:view"
+	// PermManageMembers allows changing other members' records and memberships
+	PermManageMembers Permission = "members:manage"
+	// PermDeleteUsers allows deleting user accounts
+	PermDeleteUsers Permission = "users:delete"
+	// PermManageRoles allows assigning roles to users
+	PermManageRoles Permission = "roles:manage"
+	// PermCheckInMembers allows checking members in at the front desk
+	PermCheckInMembers Permission = "members:checkin"
+	// PermUnlockAccounts allows clearing login lockouts and reading the failed login audit trail
+	PermUnlockAccounts Permission = "accounts:unlock"
+	// PermRefundPayments allows returning members' payments
+	PermRefundPayments Permission = "payments:refund"
+	// PermExportInvoices allows exporting every member's invoices for accounting
+	PermExportInvoices Permission = "invoices:export"
+)
+
+// policy is the single source of truth for which role holds which permission
+var policy = map[models.Role][]Permission{
+	models.RoleMember: {},
+	models.RoleTrainer: {
+		PermViewMembers,
+	},
+	models.RoleFrontDesk: {
+		PermViewMembers,
+		PermManageMembers,
+		PermCheckInMembers,
+	},
+	models.RoleAdmin: {
+		PermManagePlans,
+		PermViewMembers,
+		PermManageMembers,
+		PermDeleteUsers,
+		PermManageRoles,
+		PermCheckInMembers,
+		PermUnlockAccounts,
+		PermRefundPayments,
+		PermExportInvoices,
+	},
+}
+
+// Can reports whether role has been granted permission
+func Can(role models.Role, permission Permission) bool {
+	for _, granted := range policy[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions granted to role
+func Permissions(role models.Role) []Permission {
+	return append([]Permission(nil), policy[role]...)
+}
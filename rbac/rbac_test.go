@@ -0,0 +1,53 @@
+package rbac
+
+import (
+	"SSE/models"
+	"testing"
+)
+
+func TestPolicy(t *testing.T) {
+	all := []Permission{
+		PermManagePlans, PermViewMembers, PermManageMembers, PermDeleteUsers, PermManageRoles,
+		PermCheckInMembers, PermUnlockAccounts, PermRefundPayments, PermExportInvoices,
+	}
+	granted := map[models.Role][]Permission{
+		models.RoleMember:    {},
+		models.RoleTrainer:   {PermViewMembers},
+		models.RoleFrontDesk: {PermViewMembers, PermManageMembers, PermCheckInMembers},
+		models.RoleAdmin:     all,
+		// roles that aren't assignable get nothing, including the unset one
+		"":      {},
+		"owner": {},
+	}
+
+	for role, permissions := range granted {
+		for _, permission := range all {
+			want := false
+			for _, p := range permissions {
+				want = want || p == permission
+			}
+			if got := Can(role, permission); got != want {
+				t.Errorf("Can(%q, %s) = %v, want %v", role, permission, got, want)
+			}
+		}
+	}
+}
+
+func TestPolicyCoversEveryRole(t *testing.T) {
+	for _, role := range models.Roles() {
+		if _, ok := policy[role]; !ok {
+			t.Errorf("role %s has no policy entry", role)
+		}
+	}
+}
+
+func TestPermissionsReturnsCopy(t *testing.T) {
+	permissions := Permissions(models.RoleTrainer)
+	if len(permissions) != 1 || permissions[0] != PermViewMembers {
+		t.Fatalf("Permissions(trainer) = %v, want [%s]", permissions, PermViewMembers)
+	}
+	permissions[0] = PermDeleteUsers
+	if Can(models.RoleTrainer, PermDeleteUsers) {
+		t.Fatal("changing the returned slice granted the permission")
+	}
+}
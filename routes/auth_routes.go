@@ -9,4 +9,28 @@ import (
 func RegisterAuthRoutes() {
 	logoutHandler := middleware.AuthRequired(http.HandlerFunc(handlers.LogoutCustomer))
 	http.Handle("/logout", logoutHandler)
+
+	http.HandleFunc("/login", handlers.LoginPage)
+	http.HandleFunc("/oidc/login", handlers.OIDCLogin)
+	http.HandleFunc("/oidc/callback", handlers.OIDCCallback)
+
+	http.HandleFunc("/login/2fa", middleware.LoginThrottle("2fa", middleware.AccountFromPendingLogin, handlers.LoginSecondFactor))
+	http.HandleFunc("/2fa", handlers.TwoFactorPage)
+	http.HandleFunc("/2fa/setup", handlers.BeginTwoFactorSetup)
+	http.HandleFunc("/2fa/confirm", middleware.LoginThrottle("2fa", middleware.AccountFromPendingLogin, handlers.ConfirmTwoFactorSetup))
+	http.HandleFunc("/2fa/recovery-codes", middleware.AuthRequired(handlers.RegenerateRecoveryCodes))
+	http.HandleFunc("/2fa/disable", middleware.AuthRequired(handlers.DisableTwoFactor))
+
+	http.HandleFunc("/password/forgot", handlers.ForgotPassword)
+	http.HandleFunc("/password/reset", handlers.ResetPassword)
+	http.HandleFunc("/verify-email", handlers.VerifyEmail)
+	http.HandleFunc("/verify-email/resend", middleware.AuthRequired(handlers.ResendVerification))
+
+	http.HandleFunc("/api-tokens", middleware.AuthRequired(handlers.ListAPITokens))
+	http.HandleFunc("/api-tokens/revoke", middleware.AuthRequired(handlers.RevokeAPIToken))
+	http.HandleFunc("/profile/api-tokens", middleware.AuthRequired(handlers.APITokensPage))
+
+	http.HandleFunc("/sessions", middleware.AuthRequired(handlers.ListSessions))
+	http.HandleFunc("/sessions/revoke", middleware.AuthRequired(handlers.RevokeSession))
+	http.HandleFunc("/sessions/revoke-all", middleware.AuthRequired(handlers.RevokeAllSessions))
 }
@@ -1,32 +1,62 @@
 package routes
 
 import (
+	"SSE/csrf"
 	"SSE/handlers"
 	"SSE/middleware"
+	"SSE/models"
+	"SSE/rbac"
 	"net/http"
 )
 
 func RegisterRoutes() {
 	http.HandleFunc("/", handlers.HomePage)
 	http.HandleFunc("/users", handlers.CreateUser)
-	http.HandleFunc("/users/get", handlers.GetUser)
-	http.HandleFunc("/users/update", handlers.UpdateUser)
-	http.HandleFunc("/users/delete", handlers.DeleteUser)
-	http.HandleFunc("/loginuser", handlers.LoginCustomer)
+	http.HandleFunc("/users/get", middleware.TokenScope(models.ScopeProfileRead, middleware.AuthRequired(handlers.GetUser)))
+	http.HandleFunc("/users/update", middleware.AuthRequired(handlers.UpdateUser))
+	http.HandleFunc("/users/delete", middleware.RequirePermission(rbac.PermDeleteUsers, handlers.DeleteUser))
+	http.HandleFunc("/loginuser", middleware.LoginThrottle("password", middleware.AccountFromJSONEmail, handlers.LoginCustomer))
 	http.HandleFunc("/profile", handlers.Profile)
 	http.HandleFunc("/edit-profile", middleware.AuthRequired(handlers.EditProfile))
+	http.HandleFunc("/profile/card.png", middleware.AuthRequired(handlers.MemberCardImage))
 
 	http.HandleFunc("/membership/plans", handlers.GetMembershipPlans)
-	http.HandleFunc("/membership/select", handlers.SelectMembershipPlan)
-	http.HandleFunc("/membership/user", handlers.GetUserMembership)
+	http.HandleFunc("/membership/select", middleware.AuthRequired(handlers.SelectMembershipPlan))
+	http.HandleFunc("/membership/change/preview", middleware.AuthRequired(handlers.PreviewPlanChange))
+	http.HandleFunc("/membership/change", middleware.AuthRequired(handlers.ChangeMembershipPlan))
+	http.HandleFunc("/membership/auto-renew", middleware.AuthRequired(handlers.SetAutoRenew))
+	http.HandleFunc("/membership/status", middleware.AuthRequired(handlers.ChangeMembershipStatus))
+	http.HandleFunc("/membership/history", middleware.AuthRequired(handlers.GetMembershipHistory))
+	http.HandleFunc("/membership/user", middleware.TokenScope(models.ScopeMembershipRead, middleware.AuthRequired(handlers.GetUserMembership)))
 	http.HandleFunc("/membership", handlers.MembershipPlansPage)
-	http.HandleFunc("/membership/update-plans", handlers.UpdateMembershipPlans)
+	http.HandleFunc("/payments", middleware.AuthRequired(handlers.ListPayments))
+	http.HandleFunc("/payments/confirm", middleware.AuthRequired(handlers.ConfirmPayment))
+	http.HandleFunc("/payments/refund", middleware.RequirePermission(rbac.PermRefundPayments, handlers.RefundPayment))
+	http.HandleFunc("/invoices", middleware.AuthRequired(handlers.ListInvoices))
+	http.HandleFunc("/invoices/receipt", middleware.AuthRequired(handlers.InvoiceReceipt))
+	// the provider signs webhooks instead of sending a CSRF token
+	http.HandleFunc("/payments/webhook", handlers.PaymentWebhook)
+	csrf.Exempt("/payments/webhook")
+	http.HandleFunc("/membership/update-plans", middleware.RequirePermission(rbac.PermManagePlans, handlers.UpdateMembershipPlans))
 	http.HandleFunc("/fitness-chat", handlers.FitnessChatPageHandler)
 	http.HandleFunc("/ask-fitness", handlers.AskFitnessHandler)
 
 	http.HandleFunc("/fitness-tracker", middleware.AuthRequired(handlers.FitnessTrackerPageHandler))
-	http.HandleFunc("/fitness/profile", middleware.AuthRequired(handlers.CreateFitnessProfileHandler))
-	http.HandleFunc("/fitness/activity", middleware.AuthRequired(handlers.AddActivityHandler))
-	http.HandleFunc("/fitness/recommendations", middleware.AuthRequired(handlers.GetFitnessRecommendationsHandler))
+	http.HandleFunc("/fitness/profile", middleware.TokenScope(models.ScopeFitnessWrite, middleware.AuthRequired(handlers.CreateFitnessProfileHandler)))
+	http.HandleFunc("/fitness/activity", middleware.TokenScope(models.ScopeFitnessWrite, middleware.AuthRequired(handlers.AddActivityHandler)))
+	http.HandleFunc("/fitness/recommendations", middleware.TokenScope(models.ScopeFitnessRead, middleware.AuthRequired(handlers.GetFitnessRecommendationsHandler)))
+
+	http.HandleFunc("/checkin", middleware.RequirePermission(rbac.PermCheckInMembers, handlers.CheckInMember))
+	http.HandleFunc("/checkin/scan", middleware.RequirePermission(rbac.PermCheckInMembers, handlers.ScanMemberCard))
+	http.HandleFunc("/checkout", middleware.AuthRequired(handlers.CheckOutMember))
+	http.HandleFunc("/visits", middleware.AuthRequired(handlers.ListVisits))
+	http.HandleFunc("/occupancy", handlers.Occupancy)
+	http.HandleFunc("/occupancy/heatmap", handlers.OccupancyHeatmap)
+	http.HandleFunc("/occupancy/stream", handlers.OccupancyStream)
+
+	http.HandleFunc("/admin/users/role", middleware.RequirePermission(rbac.PermManageRoles, handlers.UpdateUserRole))
+	http.HandleFunc("/admin/users/unlock", middleware.RequirePermission(rbac.PermUnlockAccounts, handlers.UnlockAccount))
+	http.HandleFunc("/admin/invoices", middleware.RequirePermission(rbac.PermExportInvoices, handlers.ExportInvoices))
+	http.HandleFunc("/admin/login-attempts", middleware.RequirePermission(rbac.PermUnlockAccounts, handlers.ListFailedLogins))
 
 }
@@ -0,0 +1,82 @@
+package sessions
+
+import (
+	"SSE/auth"
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// loginFlowCookie carries a sign-in through the round trip to an external identity provider.
+// The session cookie is SameSite=Strict and isn't sent when the provider redirects back, this one is Lax.
+const loginFlowCookie = "sse-login-flow"
+
+// loginFlowTimeout bounds how long a member may take at the identity provider
+const loginFlowTimeout = 10 * time.Minute
+
+// LoginFlow holds the single-use values that tie a provider callback to the browser that started it
+type LoginFlow struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    int64
+}
+
+// StartLoginFlow generates fresh state, nonce and PKCE verifier values and stores them in a signed cookie
+func StartLoginFlow(w http.ResponseWriter) (LoginFlow, error) {
+	var values [3]string
+	for i := range values {
+		token, _, err := auth.GenerateToken()
+		if err != nil {
+			return LoginFlow{}, err
+		}
+		values[i] = token
+	}
+
+	flow := LoginFlow{
+		State:        values[0],
+		Nonce:        values[1],
+		CodeVerifier: values[2],
+		ExpiresAt:    time.Now().Add(loginFlowTimeout).Unix(),
+	}
+	encoded, err := securecookie.EncodeMulti(loginFlowCookie, flow, serverSessions.codecs...)
+	if err != nil {
+		return LoginFlow{}, err
+	}
+
+	http.SetCookie(w, loginFlowCookieWith(encoded, int(loginFlowTimeout.Seconds())))
+	return flow, nil
+}
+
+// TakeLoginFlow returns the flow started in this browser if state matches it. The cookie is
+// removed either way so a flow can only ever complete once.
+func TakeLoginFlow(w http.ResponseWriter, r *http.Request, state string) (LoginFlow, bool) {
+	cookie, err := r.Cookie(loginFlowCookie)
+	if err != nil {
+		return LoginFlow{}, false
+	}
+	http.SetCookie(w, loginFlowCookieWith("", -1))
+
+	var flow LoginFlow
+	if err := securecookie.DecodeMulti(loginFlowCookie, cookie.Value, &flow, serverSessions.codecs...); err != nil {
+		return LoginFlow{}, false
+	}
+	if time.Now().Unix() > flow.ExpiresAt || subtle.ConstantTimeCompare([]byte(flow.State), []byte(state)) != 1 {
+		return LoginFlow{}, false
+	}
+	return flow, true
+}
+
+func loginFlowCookieWith(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     loginFlowCookie,
+		Value:    value,
+		Path:     "/oidc/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   serverSessions.options.Secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,156 @@
+package sessions
+
+import (
+	"SSE/auth"
+	"SSE/models"
+	"SSE/store"
+	"SSE/web"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// touchInterval limits how often LastSeenAt is written back for busy sessions
+const touchInterval = time.Minute
+
+// serverStore is a gorilla sessions.Store that keeps session data in a SessionRepository
+// and only puts a signed, random session token in the cookie
+type serverStore struct {
+	repo            store.SessionRepository
+	codecs          []securecookie.Codec
+	options         *sessions.Options
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+}
+
+func (s *serverStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *serverStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var token string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &token, s.codecs...); err != nil {
+		// tampered or rotated-key cookies just start a fresh session
+		return session, nil
+	}
+
+	record, err := s.repo.Get(r.Context(), auth.HashToken(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	now := time.Now()
+	if record.IsExpired(now, s.idleTimeout) {
+		s.repo.Delete(r.Context(), record.ID)
+		return session, nil
+	}
+
+	session.ID = token
+	session.IsNew = false
+	for key, value := range record.Values {
+		session.Values[key] = value
+	}
+
+	if now.Sub(record.LastSeenAt) > touchInterval {
+		record.LastSeenAt = now
+		if err := s.repo.Save(r.Context(), record); err != nil {
+			return session, err
+		}
+	}
+	return session, nil
+}
+
+func (s *serverStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if _, ok := session.Values[apiTokenKey]; ok {
+		return nil
+	}
+
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repo.Delete(r.Context(), auth.HashToken(session.ID)); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	now := time.Now()
+	record := &models.Session{
+		CreatedAt:         now,
+		AbsoluteExpiresAt: now.Add(s.absoluteTimeout),
+	}
+
+	if session.ID == "" {
+		token, _, err := auth.GenerateToken()
+		if err != nil {
+			return err
+		}
+		session.ID = token
+	} else if existing, err := s.repo.Get(r.Context(), auth.HashToken(session.ID)); err == nil {
+		record = existing
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	record.ID = auth.HashToken(session.ID)
+	record.LastSeenAt = now
+	record.IP = web.ClientIP(r)
+	record.UserAgent = r.UserAgent()
+	record.Values = make(map[string]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		name, ok := key.(string)
+		if !ok {
+			return fmt.Errorf("session value keys must be strings, got %T", key)
+		}
+		record.Values[name] = value
+	}
+	record.UserID = primitive.NilObjectID
+	if userID, ok := session.Values["user_id"].(string); ok {
+		record.UserID, _ = primitive.ObjectIDFromHex(userID)
+	}
+
+	if err := s.repo.Save(r.Context(), record); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+
+	cookieOptions := *session.Options
+	cookieOptions.MaxAge = int(time.Until(record.AbsoluteExpiresAt).Seconds())
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, &cookieOptions))
+	return nil
+}
+
+// rotate drops the stored session and forces a fresh token on the next save, preventing fixation
+func (s *serverStore) rotate(ctx context.Context, session *sessions.Session) error {
+	if session.ID != "" {
+		if err := s.repo.Delete(ctx, auth.HashToken(session.ID)); err != nil {
+			return err
+		}
+	}
+	session.ID = ""
+	return nil
+}
@@ -1,28 +1,50 @@
 package sessions
 
 import (
+	"SSE/auth"
+	"SSE/config"
+	"SSE/models"
+	"SSE/store"
+	"context"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"time"
 )
 
 var (
-	store       *sessions.CookieStore
-	sessionName = "sse-session"
+	serverSessions *serverStore
+	sessionName    = "sse-session"
 )
 
-func Initialize(secret []byte) {
-	store = sessions.NewCookieStore(secret)
-	store.Options = &sessions.Options{
-		Path:     "/",
-		MaxAge:   86400 * 7,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
+// apiTokenKey marks sessions that only exist for one API token request
+const apiTokenKey = "api_token_id"
+
+// pendingLoginTimeout bounds how long a password-verified login may wait for its second factor
+const pendingLoginTimeout = 5 * time.Minute
+
+// maxSecondFactorAttempts is how many wrong codes a pending login tolerates before it is dropped
+const maxSecondFactorAttempts = 5
+
+func Initialize(cfg config.SessionConfig, repo store.SessionRepository) {
+	serverSessions = &serverStore{
+		repo:   repo,
+		codecs: securecookie.CodecsFromPairs([]byte(cfg.Key)),
+		options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   int(cfg.MaxAge.Seconds()),
+			HttpOnly: true,
+			Secure:   cfg.SecureCookies,
+			SameSite: http.SameSiteStrictMode,
+		},
+		idleTimeout:     cfg.IdleTimeout,
+		absoluteTimeout: cfg.MaxAge,
 	}
 }
 
 func Get(r *http.Request) (*sessions.Session, error) {
-	return store.Get(r, sessionName)
+	return serverSessions.Get(r, sessionName)
 }
 
 func SetUserSession(w http.ResponseWriter, r *http.Request, userID string) error {
@@ -31,11 +53,106 @@ func SetUserSession(w http.ResponseWriter, r *http.Request, userID string) error
 		return err
 	}
 
+	if err := serverSessions.rotate(r.Context(), session); err != nil {
+		return err
+	}
+
+	delete(session.Values, "pending_user_id")
+	delete(session.Values, "pending_expires_at")
+	delete(session.Values, "pending_attempts")
+	session.Values["authenticated"] = true
+	session.Values["user_id"] = userID
+	return session.Save(r, w)
+}
+
+// AuthenticateRequest signs userID in for the current request only, on behalf of the API token
+// tokenID. The session is never saved, so no cookie or stored session results from it.
+func AuthenticateRequest(r *http.Request, userID, tokenID string) error {
+	session, err := Get(r)
+	if err != nil {
+		return err
+	}
+
 	session.Values["authenticated"] = true
 	session.Values["user_id"] = userID
+	session.Values[apiTokenKey] = tokenID
+	return nil
+}
+
+// APITokenID returns the API token that authenticated the request, if any
+func APITokenID(r *http.Request) (string, bool) {
+	session, err := Get(r)
+	if err != nil {
+		return "", false
+	}
+	tokenID, ok := session.Values[apiTokenKey].(string)
+	return tokenID, ok
+}
+
+// SetPendingLogin records that userID passed the password check but still owes a second factor.
+// The session is not authenticated until SetUserSession is called.
+func SetPendingLogin(w http.ResponseWriter, r *http.Request, userID string) error {
+	session, err := Get(r)
+	if err != nil {
+		return err
+	}
+
+	if err := serverSessions.rotate(r.Context(), session); err != nil {
+		return err
+	}
+
+	session.Values = map[interface{}]interface{}{
+		"pending_user_id":    userID,
+		"pending_expires_at": time.Now().Add(pendingLoginTimeout).Unix(),
+		"pending_attempts":   int64(0),
+	}
 	return session.Save(r, w)
 }
 
+// PendingLoginUserID returns the user whose login is waiting for a second factor, if it hasn't expired
+func PendingLoginUserID(r *http.Request) (string, bool) {
+	session, err := Get(r)
+	if err != nil {
+		return "", false
+	}
+
+	userID, _ := session.Values["pending_user_id"].(string)
+	if userID == "" || time.Now().Unix() > int64Value(session.Values["pending_expires_at"]) {
+		return "", false
+	}
+	return userID, true
+}
+
+// RecordFailedSecondFactor counts a wrong code against the pending login and drops it once
+// the attempts run out. It reports whether the login can still be completed.
+func RecordFailedSecondFactor(w http.ResponseWriter, r *http.Request) (bool, error) {
+	session, err := Get(r)
+	if err != nil {
+		return false, err
+	}
+
+	attempts := int64Value(session.Values["pending_attempts"]) + 1
+	if attempts >= maxSecondFactorAttempts {
+		return false, ClearSession(w, r)
+	}
+	session.Values["pending_attempts"] = attempts
+	return true, session.Save(r, w)
+}
+
+// int64Value reads a number back from session values, which may come from the store as any integer type
+func int64Value(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int32:
+		return int64(v)
+	case int:
+		return int64(v)
+	default:
+		return 0
+	}
+}
+
 func ClearSession(w http.ResponseWriter, r *http.Request) error {
 	session, err := Get(r)
 	if err != nil {
@@ -43,5 +160,37 @@ func ClearSession(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	session.Values = make(map[interface{}]interface{})
+	session.Options.MaxAge = -1
 	return session.Save(r, w)
 }
+
+// CurrentSessionID returns the stored ID of the request's session, or "" when there is none
+func CurrentSessionID(r *http.Request) string {
+	session, err := Get(r)
+	if err != nil || session.ID == "" {
+		return ""
+	}
+	return auth.HashToken(session.ID)
+}
+
+// ListUserSessions returns every active session belonging to userID
+func ListUserSessions(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	return serverSessions.repo.ListByUser(ctx, userID)
+}
+
+// RevokeSession signs out a single session, it must belong to userID
+func RevokeSession(ctx context.Context, userID primitive.ObjectID, sessionID string) error {
+	session, err := serverSessions.repo.Get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return store.ErrNotFound
+	}
+	return serverSessions.repo.Delete(ctx, sessionID)
+}
+
+// RevokeUserSessions signs userID out everywhere except the session exceptID, which may be ""
+func RevokeUserSessions(ctx context.Context, userID primitive.ObjectID, exceptID string) (int64, error) {
+	return serverSessions.repo.DeleteByUser(ctx, userID, exceptID)
+}
@@ -0,0 +1,278 @@
+package sessions
+
+import (
+	"SSE/config"
+	"SSE/store"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newTestSessions initializes server-side sessions on a memory store with a 12 hour idle timeout
+// and a 7 day lifetime
+func newTestSessions(t *testing.T) *store.Store {
+	t.Helper()
+	appStore := store.NewMemoryStore()
+	Initialize(config.SessionConfig{
+		Key:         strings.Repeat("session-key-", 4),
+		MaxAge:      7 * 24 * time.Hour,
+		IdleTimeout: 12 * time.Hour,
+	}, appStore.Sessions)
+	return appStore
+}
+
+func requestWith(cookies []*http.Cookie) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	return r
+}
+
+// signIn signs userID in and returns the session cookie along with the stored session ID
+func signIn(t *testing.T, userID primitive.ObjectID) ([]*http.Cookie, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r := requestWith(nil)
+	if err := SetUserSession(w, r, userID.Hex()); err != nil {
+		t.Fatalf("SetUserSession: %v", err)
+	}
+	return w.Result().Cookies(), CurrentSessionID(r)
+}
+
+// signedInAs returns the user the cookies are signed in as, "" when they aren't
+func signedInAs(t *testing.T, cookies []*http.Cookie) string {
+	t.Helper()
+	session, err := Get(requestWith(cookies))
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if authenticated, _ := session.Values["authenticated"].(bool); !authenticated {
+		return ""
+	}
+	userID, _ := session.Values["user_id"].(string)
+	return userID
+}
+
+func TestSessionTimeouts(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		lastSeen     time.Duration
+		expiresIn    time.Duration
+		wantSignedIn bool
+	}{
+		{"in use", -time.Hour, 24 * time.Hour, true},
+		{"idle just under the timeout", -12*time.Hour + time.Minute, 24 * time.Hour, true},
+		{"idle too long", -12*time.Hour - time.Minute, 24 * time.Hour, false},
+		{"past its absolute lifetime while in use", -time.Minute, -time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appStore := newTestSessions(t)
+			userID := primitive.NewObjectID()
+			cookies, id := signIn(t, userID)
+
+			record, err := appStore.Sessions.Get(ctx, id)
+			if err != nil {
+				t.Fatalf("stored session: %v", err)
+			}
+			record.LastSeenAt = time.Now().Add(tt.lastSeen)
+			record.AbsoluteExpiresAt = time.Now().Add(tt.expiresIn)
+			appStore.Sessions.Save(ctx, record)
+
+			if got := signedInAs(t, cookies) == userID.Hex(); got != tt.wantSignedIn {
+				t.Fatalf("signed in = %v, want %v", got, tt.wantSignedIn)
+			}
+			_, err = appStore.Sessions.Get(ctx, id)
+			if stored := err == nil; stored != tt.wantSignedIn {
+				t.Fatalf("session still stored = %v, want %v", stored, tt.wantSignedIn)
+			}
+		})
+	}
+}
+
+func TestSessionTouch(t *testing.T) {
+	ctx := context.Background()
+	appStore := newTestSessions(t)
+	cookies, id := signIn(t, primitive.NewObjectID())
+
+	record, _ := appStore.Sessions.Get(ctx, id)
+	record.LastSeenAt = time.Now().Add(-time.Hour)
+	appStore.Sessions.Save(ctx, record)
+
+	signedInAs(t, cookies)
+	touched, _ := appStore.Sessions.Get(ctx, id)
+	if time.Since(touched.LastSeenAt) > time.Minute {
+		t.Fatalf("last seen %v ago after a request, want it refreshed", time.Since(touched.LastSeenAt))
+	}
+}
+
+func TestSessionCookieHoldsOnlyToken(t *testing.T) {
+	ctx := context.Background()
+	appStore := newTestSessions(t)
+	userID := primitive.NewObjectID()
+	cookies, id := signIn(t, userID)
+
+	record, err := appStore.Sessions.Get(ctx, id)
+	if err != nil || record.UserID != userID {
+		t.Fatalf("stored session %+v (%v), want one for the user", record, err)
+	}
+	if strings.Contains(cookies[0].Value, userID.Hex()) {
+		t.Fatal("cookie carries the user ID")
+	}
+
+	tampered := []*http.Cookie{{Name: cookies[0].Name, Value: cookies[0].Value[:len(cookies[0].Value)-2] + "xx"}}
+	if got := signedInAs(t, tampered); got != "" {
+		t.Fatalf("tampered cookie signed in as %s", got)
+	}
+}
+
+func TestSignInRotatesSession(t *testing.T) {
+	ctx := context.Background()
+	appStore := newTestSessions(t)
+	userID := primitive.NewObjectID()
+
+	// a session planted before sign-in must not become the signed-in one
+	w := httptest.NewRecorder()
+	r := requestWith(nil)
+	if err := SetPendingLogin(w, r, userID.Hex()); err != nil {
+		t.Fatalf("SetPendingLogin: %v", err)
+	}
+	planted := w.Result().Cookies()
+	plantedID := CurrentSessionID(r)
+
+	w = httptest.NewRecorder()
+	r = requestWith(planted)
+	if pending, ok := PendingLoginUserID(r); !ok || pending != userID.Hex() {
+		t.Fatalf("pending login = %q, %v", pending, ok)
+	}
+	if err := SetUserSession(w, r, userID.Hex()); err != nil {
+		t.Fatalf("SetUserSession: %v", err)
+	}
+
+	if CurrentSessionID(r) == plantedID {
+		t.Fatal("sign-in kept the session ID from before it")
+	}
+	if _, err := appStore.Sessions.Get(ctx, plantedID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("session from before sign-in: %v, want it deleted", err)
+	}
+	if got := signedInAs(t, planted); got != "" {
+		t.Fatalf("cookie from before sign-in is signed in as %s", got)
+	}
+	if got := signedInAs(t, w.Result().Cookies()); got != userID.Hex() {
+		t.Fatalf("new cookie signed in as %q, want %s", got, userID.Hex())
+	}
+}
+
+func TestRevokeSessions(t *testing.T) {
+	ctx := context.Background()
+	newTestSessions(t)
+	userID, otherID := primitive.NewObjectID(), primitive.NewObjectID()
+	laptop, laptopID := signIn(t, userID)
+	phone, phoneID := signIn(t, userID)
+	tablet, _ := signIn(t, userID)
+	other, otherSessionID := signIn(t, otherID)
+
+	if err := RevokeSession(ctx, userID, otherSessionID); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("revoking another user's session: %v, want ErrNotFound", err)
+	}
+	if signedInAs(t, other) != otherID.Hex() {
+		t.Fatal("another user's session was revoked")
+	}
+
+	if err := RevokeSession(ctx, userID, phoneID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+	if signedInAs(t, phone) != "" {
+		t.Fatal("revoked session still signed in")
+	}
+
+	revoked, err := RevokeUserSessions(ctx, userID, laptopID)
+	if err != nil || revoked != 1 {
+		t.Fatalf("RevokeUserSessions = %d, %v, want the tablet revoked", revoked, err)
+	}
+	if signedInAs(t, tablet) != "" || signedInAs(t, laptop) != userID.Hex() {
+		t.Fatal("want only the session kept by RevokeUserSessions signed in")
+	}
+	listed, _ := ListUserSessions(ctx, userID)
+	if len(listed) != 1 || listed[0].ID != laptopID {
+		t.Fatalf("listed %d sessions, want only the laptop", len(listed))
+	}
+}
+
+func TestClearSession(t *testing.T) {
+	ctx := context.Background()
+	appStore := newTestSessions(t)
+	cookies, id := signIn(t, primitive.NewObjectID())
+
+	w := httptest.NewRecorder()
+	if err := ClearSession(w, requestWith(cookies)); err != nil {
+		t.Fatalf("ClearSession: %v", err)
+	}
+	if _, err := appStore.Sessions.Get(ctx, id); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("session after sign-out: %v, want it deleted", err)
+	}
+	if cleared := w.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Fatalf("cookies after sign-out %+v, want the session cookie removed", cleared)
+	}
+}
+
+func TestAPITokenRequestIsNotStored(t *testing.T) {
+	ctx := context.Background()
+	appStore := newTestSessions(t)
+	userID := primitive.NewObjectID()
+
+	w := httptest.NewRecorder()
+	r := requestWith(nil)
+	if err := AuthenticateRequest(r, userID.Hex(), "token-1"); err != nil {
+		t.Fatalf("AuthenticateRequest: %v", err)
+	}
+	if tokenID, ok := APITokenID(r); !ok || tokenID != "token-1" {
+		t.Fatalf("APITokenID = %q, %v", tokenID, ok)
+	}
+	session, _ := Get(r)
+	if err := session.Save(r, w); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("token request was given a session cookie")
+	}
+	if listed, _ := appStore.Sessions.ListByUser(ctx, userID); len(listed) != 0 {
+		t.Fatalf("token request stored %d sessions", len(listed))
+	}
+}
+
+func TestSecondFactorAttempts(t *testing.T) {
+	newTestSessions(t)
+	w := httptest.NewRecorder()
+	if err := SetPendingLogin(w, requestWith(nil), primitive.NewObjectID().Hex()); err != nil {
+		t.Fatalf("SetPendingLogin: %v", err)
+	}
+	cookies := w.Result().Cookies()
+
+	for attempt := 1; attempt <= maxSecondFactorAttempts; attempt++ {
+		w := httptest.NewRecorder()
+		r := requestWith(cookies)
+		canRetry, err := RecordFailedSecondFactor(w, r)
+		if err != nil {
+			t.Fatalf("RecordFailedSecondFactor: %v", err)
+		}
+		if want := attempt < maxSecondFactorAttempts; canRetry != want {
+			t.Fatalf("after %d wrong codes can retry = %v, want %v", attempt, canRetry, want)
+		}
+	}
+	if _, ok := PendingLoginUserID(requestWith(cookies)); ok {
+		t.Fatal("pending login survived running out of attempts")
+	}
+	if CurrentSessionID(requestWith(cookies)) != "" {
+		t.Fatal("session survived running out of attempts")
+	}
+}
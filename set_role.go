@@ -0,0 +1,47 @@
+package main
+
+import (
+	"SSE/config"
+	"SSE/database"
+	"SSE/models"
+	"SSE/store"
+	"context"
+	"log"
+	"time"
+)
+
+// runSetRoleCommand handles `set-role <email> <role>`, used to bootstrap the first admin
+func runSetRoleCommand(cfg *config.Config, args []string) {
+	if len(args) != 2 {
+		log.Fatalf("usage: set-role <email> <member|trainer|front_desk|admin>")
+	}
+	email, role := args[0], models.Role(args[1])
+	if !role.IsValid() {
+		log.Fatalf("Unknown role %q", role)
+	}
+	if cfg.Store.Backend != config.BackendMongo {
+		log.Fatalf("set-role only applies to the %q store backend", config.BackendMongo)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dbManager, err := database.Connect(ctx, cfg.MongoDB)
+	if err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer dbManager.Close(context.Background())
+
+	users := store.NewMongoStore(dbManager.Database()).Users
+	user, err := users.GetByEmail(ctx, email)
+	if err != nil {
+		log.Fatalf("Failed to find user %s: %v", email, err)
+	}
+
+	user.Role = role
+	user.UpdatedAt = time.Now()
+	if err := users.Update(ctx, user); err != nil {
+		log.Fatalf("Failed to update role: %v", err)
+	}
+	log.Printf("%s is now %s", email, role)
+}
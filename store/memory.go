@@ -0,0 +1,404 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemoryStore builds a Store that keeps everything in process memory.
+// It is meant for local development and tests where no MongoDB is available.
+func NewMemoryStore() *Store {
+	return &Store{
+		Users:             &memoryUserRepository{users: make(map[primitive.ObjectID]models.User)},
+		MembershipPlans:   &memoryPlanRepository{plans: make(map[primitive.ObjectID]models.MembershipPlan)},
+		FitnessProfiles:   &memoryFitnessProfileRepository{profiles: make(map[primitive.ObjectID]models.FitnessProfile)},
+		Activities:        &memoryActivityRepository{},
+		Sessions:          &memorySessionRepository{sessions: make(map[string]models.Session)},
+		PasswordResets:    &memoryPasswordResetRepository{tokens: make(map[string]models.PasswordResetToken)},
+		LoginThrottles:    &memoryLoginThrottleRepository{throttles: make(map[string]models.LoginThrottle)},
+		LoginAttempts:     &memoryLoginAttemptRepository{},
+		APITokens:         &memoryAPITokenRepository{tokens: make(map[primitive.ObjectID]models.APIToken)},
+		Visits:            &memoryVisitRepository{},
+		Counters:          &memoryCounterRepository{counters: make(map[string]int64)},
+		Payments:          &memoryPaymentRepository{payments: make(map[primitive.ObjectID]models.Payment)},
+		Invoices:          &memoryInvoiceRepository{invoices: make(map[primitive.ObjectID]models.Invoice)},
+		MembershipHistory: &memoryMembershipHistoryRepository{},
+	}
+}
+
+type memoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[primitive.ObjectID]models.User
+}
+
+func (r *memoryUserRepository) emailTaken(email string, except primitive.ObjectID) bool {
+	for id, user := range r.users {
+		if id != except && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// memberIDTaken mirrors the unique index on member_id, users without one are left out
+func (r *memoryUserRepository) memberIDTaken(memberID string) bool {
+	if memberID == "" {
+		return false
+	}
+	for _, user := range r.users {
+		if user.MemberID == memberID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, primitive.NilObjectID) || r.memberIDTaken(user.MemberID) {
+		return ErrDuplicate
+	}
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.users[user.ID]; exists {
+		return ErrDuplicate
+	}
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.HasIdentity(issuer, subject) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) GetByMemberID(ctx context.Context, memberID string) (*models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.MemberID == memberID {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) RecordCheckIn(ctx context.Context, id primitive.ObjectID, at time.Time, window time.Duration) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !user.LastCheckIn.IsZero() && user.LastCheckIn.After(at.Add(-window)) {
+		return nil, ErrDuplicate
+	}
+	user.LastCheckIn = at
+	user.TotalVisits++
+	r.users[id] = user
+	return &user, nil
+}
+
+func (r *memoryUserRepository) SetAutoRenew(ctx context.Context, id primitive.ObjectID, enabled bool, method string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.AutoRenew = enabled
+	user.RenewalMethod = method
+	user.UpdatedAt = at
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) RecordTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if user.TwoFactor.LastStep >= step {
+		return ErrConflict
+	}
+	user.TwoFactor.LastStep = step
+	r.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[user.ID]; !ok {
+		return ErrNotFound
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+	r.replace(user)
+	return nil
+}
+
+// replace stores user keeping the stored visit fields, like the Mongo store does
+func (r *memoryUserRepository) replace(user *models.User) {
+	replacement := *user
+	replacement.LastCheckIn = r.users[user.ID].LastCheckIn
+	replacement.TotalVisits = r.users[user.ID].TotalVisits
+	r.users[user.ID] = replacement
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateMembership(ctx context.Context, user *models.User, from models.MembershipStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, ok := r.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	current := existing.MembershipStatus
+	if current == "" {
+		current = models.StatusNone
+	}
+	if current != from {
+		return ErrConflict
+	}
+	if r.emailTaken(user.Email, user.ID) {
+		return ErrDuplicate
+	}
+	r.replace(user)
+	return nil
+}
+
+func (r *memoryUserRepository) ListAutoRenewing(ctx context.Context, before time.Time) ([]models.User, error) {
+	return r.list(func(user models.User) bool {
+		renewable := user.MembershipStatus == models.StatusActive || user.MembershipStatus == models.StatusExpired
+		return user.AutoRenew && renewable && user.MembershipExpiry.Before(before)
+	}), nil
+}
+
+func (r *memoryUserRepository) ListLapsed(ctx context.Context, now time.Time) ([]models.User, error) {
+	return r.list(func(user models.User) bool {
+		return user.MembershipStatus == models.StatusActive && user.MembershipExpiry.Before(now)
+	}), nil
+}
+
+func (r *memoryUserRepository) ListScheduledPlansDue(ctx context.Context, now time.Time) ([]models.User, error) {
+	return r.list(func(user models.User) bool {
+		return !user.ScheduledPlanStart.IsZero() && !user.ScheduledPlanStart.After(now)
+	}), nil
+}
+
+func (r *memoryUserRepository) list(match func(models.User) bool) []models.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range r.users {
+		if match(user) {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+type memoryPlanRepository struct {
+	mu    sync.RWMutex
+	plans map[primitive.ObjectID]models.MembershipPlan
+}
+
+func (r *memoryPlanRepository) ListActive(ctx context.Context) ([]models.MembershipPlan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var plans []models.MembershipPlan
+	for _, plan := range r.plans {
+		if plan.IsActive {
+			plans = append(plans, plan)
+		}
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Price < plans[j].Price })
+	return plans, nil
+}
+
+func (r *memoryPlanRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.MembershipPlan, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	plan, ok := r.plans[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &plan, nil
+}
+
+func (r *memoryPlanRepository) GetActiveByID(ctx context.Context, id primitive.ObjectID) (*models.MembershipPlan, error) {
+	plan, err := r.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !plan.IsActive {
+		return nil, ErrNotFound
+	}
+	return plan, nil
+}
+
+func (r *memoryPlanRepository) CreateMany(ctx context.Context, plans []models.MembershipPlan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range plans {
+		if plans[i].ID.IsZero() {
+			plans[i].ID = primitive.NewObjectID()
+		}
+		r.plans[plans[i].ID] = plans[i]
+	}
+	return nil
+}
+
+func (r *memoryPlanRepository) Sync(ctx context.Context, plans []models.MembershipPlan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	synced := make(map[string]bool)
+	for _, plan := range plans {
+		synced[plan.Name] = true
+		plan.ID = primitive.NewObjectID()
+		for id, existing := range r.plans {
+			if existing.Name == plan.Name {
+				plan.ID = id
+				plan.CreatedAt = existing.CreatedAt
+				break
+			}
+		}
+		r.plans[plan.ID] = plan
+	}
+	for id, plan := range r.plans {
+		if !synced[plan.Name] && plan.IsActive {
+			plan.IsActive = false
+			plan.UpdatedAt = now
+			r.plans[id] = plan
+		}
+	}
+	return nil
+}
+
+type memoryFitnessProfileRepository struct {
+	mu sync.RWMutex
+	// profiles is keyed by user ID since each user owns at most one profile
+	profiles map[primitive.ObjectID]models.FitnessProfile
+}
+
+func (r *memoryFitnessProfileRepository) GetByUserID(ctx context.Context, userID primitive.ObjectID) (*models.FitnessProfile, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profile, ok := r.profiles[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &profile, nil
+}
+
+func (r *memoryFitnessProfileRepository) Save(ctx context.Context, profile *models.FitnessProfile) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.profiles[profile.UserID]; ok {
+		profile.ID = existing.ID
+		profile.CreatedAt = existing.CreatedAt
+	} else if profile.ID.IsZero() {
+		profile.ID = primitive.NewObjectID()
+	}
+	r.profiles[profile.UserID] = *profile
+	return nil
+}
+
+type memoryActivityRepository struct {
+	mu         sync.RWMutex
+	activities []models.Activity
+}
+
+func (r *memoryActivityRepository) Create(ctx context.Context, activity *models.Activity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if activity.ID.IsZero() {
+		activity.ID = primitive.NewObjectID()
+	}
+	r.activities = append(r.activities, *activity)
+	return nil
+}
+
+func (r *memoryActivityRepository) ListRecentByUser(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.Activity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var activities []models.Activity
+	for _, activity := range r.activities {
+		if activity.UserID == userID {
+			activities = append(activities, activity)
+		}
+	}
+	sort.SliceStable(activities, func(i, j int) bool { return activities[i].Date.After(activities[j].Date) })
+	if limit > 0 && len(activities) > limit {
+		activities = activities[:limit]
+	}
+	return activities, nil
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryAPITokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[primitive.ObjectID]models.APIToken
+}
+
+func (r *memoryAPITokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	for _, existing := range r.tokens {
+		if existing.TokenHash == token.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	r.tokens[token.ID] = *token
+	return nil
+}
+
+func (r *memoryAPITokenRepository) GetByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == hash {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryAPITokenRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var tokens []models.APIToken
+	for _, token := range r.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.After(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (r *memoryAPITokenRepository) Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil
+	}
+	token.LastUsedAt = &at
+	r.tokens[id] = token
+	return nil
+}
+
+func (r *memoryAPITokenRepository) Delete(ctx context.Context, userID, id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.tokens, id)
+	return nil
+}
+
+func (r *memoryAPITokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.UserID == userID {
+			delete(r.tokens, id)
+		}
+	}
+	return nil
+}
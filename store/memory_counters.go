@@ -0,0 +1,19 @@
+package store
+
+import (
+	"context"
+	"sync"
+)
+
+type memoryCounterRepository struct {
+	mu       sync.Mutex
+	counters map[string]int64
+}
+
+func (r *memoryCounterRepository) Next(ctx context.Context, name string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counters[name]++
+	return r.counters[name], nil
+}
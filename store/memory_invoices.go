@@ -0,0 +1,86 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryInvoiceRepository struct {
+	mu       sync.RWMutex
+	invoices map[primitive.ObjectID]models.Invoice
+}
+
+func (r *memoryInvoiceRepository) Create(ctx context.Context, invoice *models.Invoice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.invoices {
+		if existing.PaymentID == invoice.PaymentID || existing.Number == invoice.Number {
+			return ErrDuplicate
+		}
+	}
+	if invoice.ID.IsZero() {
+		invoice.ID = primitive.NewObjectID()
+	}
+	r.invoices[invoice.ID] = *invoice
+	return nil
+}
+
+func (r *memoryInvoiceRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invoice, ok := r.invoices[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &invoice, nil
+}
+
+func (r *memoryInvoiceRepository) GetByPayment(ctx context.Context, paymentID primitive.ObjectID) (*models.Invoice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, invoice := range r.invoices {
+		if invoice.PaymentID == paymentID {
+			return &invoice, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryInvoiceRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Invoice, error) {
+	invoices := r.filter(func(invoice models.Invoice) bool { return invoice.UserID == userID })
+	sort.Slice(invoices, func(i, j int) bool {
+		return invoices[i].IssuedAt.After(invoices[j].IssuedAt)
+	})
+	return invoices, nil
+}
+
+func (r *memoryInvoiceRepository) ListIssued(ctx context.Context, from, to time.Time) ([]models.Invoice, error) {
+	invoices := r.filter(func(invoice models.Invoice) bool {
+		return !invoice.IssuedAt.Before(from) && invoice.IssuedAt.Before(to)
+	})
+	sort.Slice(invoices, func(i, j int) bool {
+		return invoices[i].IssuedAt.Before(invoices[j].IssuedAt)
+	})
+	return invoices, nil
+}
+
+func (r *memoryInvoiceRepository) filter(match func(models.Invoice) bool) []models.Invoice {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	invoices := []models.Invoice{}
+	for _, invoice := range r.invoices {
+		if match(invoice) {
+			invoices = append(invoices, invoice)
+		}
+	}
+	return invoices
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryLoginThrottleRepository struct {
+	mu        sync.Mutex
+	throttles map[string]models.LoginThrottle
+}
+
+// live returns the counter for id unless it has expired, pruning it if so
+func (r *memoryLoginThrottleRepository) live(id string, now time.Time) (models.LoginThrottle, bool) {
+	throttle, ok := r.throttles[id]
+	if ok && !now.Before(throttle.ExpiresAt) {
+		delete(r.throttles, id)
+		return models.LoginThrottle{}, false
+	}
+	return throttle, ok
+}
+
+func (r *memoryLoginThrottleRepository) Get(ctx context.Context, key models.ThrottleKey) (*models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle, ok := r.live(key.ID(), time.Now())
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &throttle, nil
+}
+
+func (r *memoryLoginThrottleRepository) RecordFailure(ctx context.Context, key models.ThrottleKey, at, expiresAt time.Time) (*models.LoginThrottle, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle, ok := r.live(key.ID(), at)
+	if !ok {
+		throttle = models.LoginThrottle{ID: key.ID(), ThrottleKey: key}
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = at
+	throttle.ExpiresAt = expiresAt
+	if throttle.LockedUntil.After(expiresAt) {
+		throttle.ExpiresAt = throttle.LockedUntil
+	}
+	r.throttles[key.ID()] = throttle
+	return &throttle, nil
+}
+
+func (r *memoryLoginThrottleRepository) Lock(ctx context.Context, key models.ThrottleKey, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	throttle, ok := r.throttles[key.ID()]
+	if !ok {
+		return ErrNotFound
+	}
+	throttle.LockedUntil = until
+	if until.After(throttle.ExpiresAt) {
+		throttle.ExpiresAt = until
+	}
+	r.throttles[key.ID()] = throttle
+	return nil
+}
+
+func (r *memoryLoginThrottleRepository) Delete(ctx context.Context, key models.ThrottleKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.throttles, key.ID())
+	return nil
+}
+
+func (r *memoryLoginThrottleRepository) DeleteBySubject(ctx context.Context, kind models.ThrottleKind, subject string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, throttle := range r.throttles {
+		if throttle.Kind == kind && throttle.Subject == subject {
+			delete(r.throttles, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+type memoryLoginAttemptRepository struct {
+	mu       sync.RWMutex
+	attempts []models.LoginAttempt
+}
+
+func (r *memoryLoginAttemptRepository) Create(ctx context.Context, attempt *models.LoginAttempt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attempt.ID.IsZero() {
+		attempt.ID = primitive.NewObjectID()
+	}
+	r.attempts = append(r.attempts, *attempt)
+	return nil
+}
+
+func (r *memoryLoginAttemptRepository) ListRecent(ctx context.Context, account string, limit int) ([]models.LoginAttempt, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	// attempts are appended in time order, so walking backwards yields the newest first
+	attempts := []models.LoginAttempt{}
+	for i := len(r.attempts) - 1; i >= 0; i-- {
+		if account != "" && r.attempts[i].Account != account {
+			continue
+		}
+		attempts = append(attempts, r.attempts[i])
+		if limit > 0 && len(attempts) == limit {
+			break
+		}
+	}
+	return attempts, nil
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryMembershipHistoryRepository struct {
+	mu sync.RWMutex
+	// changes is kept in the order they were recorded
+	changes []models.MembershipStatusChange
+}
+
+func (r *memoryMembershipHistoryRepository) Create(ctx context.Context, change *models.MembershipStatusChange) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if change.ID.IsZero() {
+		change.ID = primitive.NewObjectID()
+	}
+	r.changes = append(r.changes, *change)
+	return nil
+}
+
+func (r *memoryMembershipHistoryRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.MembershipStatusChange, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	changes := []models.MembershipStatusChange{}
+	for i := len(r.changes) - 1; i >= 0; i-- {
+		if r.changes[i].UserID == userID {
+			changes = append(changes, r.changes[i])
+		}
+	}
+	return changes, nil
+}
+
+func (r *memoryMembershipHistoryRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.changes[:0]
+	for _, change := range r.changes {
+		if change.UserID != userID {
+			kept = append(kept, change)
+		}
+	}
+	r.changes = kept
+	return nil
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryPasswordResetRepository struct {
+	mu     sync.Mutex
+	tokens map[string]models.PasswordResetToken
+}
+
+func (r *memoryPasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tokens[token.ID]; exists {
+		return ErrDuplicate
+	}
+	r.tokens[token.ID] = *token
+	return nil
+}
+
+func (r *memoryPasswordResetRepository) Get(ctx context.Context, id string) (*models.PasswordResetToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &token, nil
+}
+
+func (r *memoryPasswordResetRepository) MarkUsed(ctx context.Context, id string, usedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.UsedAt != nil {
+		return ErrNotFound
+	}
+	token.UsedAt = &usedAt
+	r.tokens[id] = token
+	return nil
+}
+
+func (r *memoryPasswordResetRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.UserID == userID {
+			delete(r.tokens, id)
+		}
+	}
+	return nil
+}
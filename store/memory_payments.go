@@ -0,0 +1,197 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryPaymentRepository struct {
+	mu       sync.RWMutex
+	payments map[primitive.ObjectID]models.Payment
+}
+
+func (r *memoryPaymentRepository) Create(ctx context.Context, payment *models.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.payments {
+		if existing.UserID == payment.UserID && existing.IdempotencyKey == payment.IdempotencyKey {
+			return ErrDuplicate
+		}
+	}
+	if payment.ID.IsZero() {
+		payment.ID = primitive.NewObjectID()
+	}
+	r.payments[payment.ID] = *payment
+	return nil
+}
+
+func (r *memoryPaymentRepository) find(match func(models.Payment) bool) (*models.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, payment := range r.payments {
+		if match(payment) {
+			return &payment, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryPaymentRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	return r.find(func(payment models.Payment) bool { return payment.ID == id })
+}
+
+func (r *memoryPaymentRepository) GetByIdempotencyKey(ctx context.Context, userID primitive.ObjectID, key string) (*models.Payment, error) {
+	return r.find(func(payment models.Payment) bool {
+		return payment.UserID == userID && payment.IdempotencyKey == key
+	})
+}
+
+func (r *memoryPaymentRepository) GetByIntent(ctx context.Context, provider, intentID string) (*models.Payment, error) {
+	return r.find(func(payment models.Payment) bool {
+		return payment.Provider == provider && payment.IntentID == intentID
+	})
+}
+
+func (r *memoryPaymentRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	payments := []models.Payment{}
+	for _, payment := range r.payments {
+		if payment.UserID == userID {
+			payments = append(payments, payment)
+		}
+	}
+	sort.Slice(payments, func(i, j int) bool {
+		return payments[i].CreatedAt.After(payments[j].CreatedAt)
+	})
+	return payments, nil
+}
+
+// update applies change to the payment with id while holding the lock
+func (r *memoryPaymentRepository) update(id primitive.ObjectID, change func(*models.Payment) bool) (*models.Payment, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment, ok := r.payments[id]
+	if !ok {
+		return nil, false, ErrNotFound
+	}
+	if !change(&payment) {
+		return &payment, false, nil
+	}
+	r.payments[id] = payment
+	return &payment, true, nil
+}
+
+func (r *memoryPaymentRepository) SetIntent(ctx context.Context, id primitive.ObjectID, intentID string) error {
+	_, _, err := r.update(id, func(payment *models.Payment) bool {
+		payment.IntentID = intentID
+		payment.UpdatedAt = time.Now()
+		return true
+	})
+	return err
+}
+
+func (r *memoryPaymentRepository) Transition(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, status models.PaymentStatus, failureReason string) (bool, error) {
+	_, changed, err := r.update(id, func(payment *models.Payment) bool {
+		if !slices.Contains(from, payment.Status) {
+			return false
+		}
+		payment.Status = status
+		payment.FailureReason = failureReason
+		payment.UpdatedAt = time.Now()
+		return true
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return changed, err
+}
+
+func (r *memoryPaymentRepository) MarkApplied(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	_, changed, err := r.update(id, func(payment *models.Payment) bool {
+		if payment.AppliedAt != nil {
+			return false
+		}
+		payment.AppliedAt = &at
+		payment.UpdatedAt = at
+		return true
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return changed, err
+}
+
+func (r *memoryPaymentRepository) UnmarkApplied(ctx context.Context, id primitive.ObjectID) error {
+	_, _, err := r.update(id, func(payment *models.Payment) bool {
+		payment.AppliedAt = nil
+		return true
+	})
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (r *memoryPaymentRepository) ClaimAttempt(ctx context.Context, id primitive.ObjectID, now, until time.Time) (bool, error) {
+	_, changed, err := r.update(id, func(payment *models.Payment) bool {
+		if payment.Status != models.PaymentPending || (payment.NextAttemptAt != nil && payment.NextAttemptAt.After(now)) {
+			return false
+		}
+		payment.NextAttemptAt = &until
+		payment.UpdatedAt = now
+		return true
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return changed, err
+}
+
+func (r *memoryPaymentRepository) RecordFailedAttempt(ctx context.Context, id primitive.ObjectID, next *time.Time, failureReason string) error {
+	_, changed, err := r.update(id, func(payment *models.Payment) bool {
+		if payment.Status != models.PaymentPending {
+			return false
+		}
+		payment.Attempts++
+		payment.FailureReason = failureReason
+		payment.NextAttemptAt = next
+		if next == nil {
+			payment.Status = models.PaymentFailed
+		}
+		payment.UpdatedAt = time.Now()
+		return true
+	})
+	if err == nil && !changed {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (r *memoryPaymentRepository) AddRefund(ctx context.Context, id primitive.ObjectID, refund models.PaymentRefund) (*models.Payment, error) {
+	payment, _, err := r.update(id, func(payment *models.Payment) bool {
+		for _, existing := range payment.Refunds {
+			if existing.ID == refund.ID {
+				return false
+			}
+		}
+		payment.Refunds = append(slices.Clone(payment.Refunds), refund)
+		payment.RefundedAmount += refund.Amount
+		if payment.RefundedAmount >= payment.Amount {
+			payment.Status = models.PaymentRefunded
+		}
+		payment.UpdatedAt = time.Now()
+		return true
+	})
+	return payment, err
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memorySessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]models.Session
+}
+
+func (r *memorySessionRepository) Save(ctx context.Context, session *models.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// prune sessions past their absolute lifetime, Mongo does the same with a TTL index
+	now := time.Now()
+	for id, existing := range r.sessions {
+		if !now.Before(existing.AbsoluteExpiresAt) {
+			delete(r.sessions, id)
+		}
+	}
+
+	stored := *session
+	stored.Values = make(map[string]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		stored.Values[key] = value
+	}
+	r.sessions[session.ID] = stored
+	return nil
+}
+
+func (r *memorySessionRepository) Get(ctx context.Context, id string) (*models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	values := make(map[string]interface{}, len(session.Values))
+	for key, value := range session.Values {
+		values[key] = value
+	}
+	session.Values = values
+	return &session, nil
+}
+
+func (r *memorySessionRepository) Delete(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.sessions, id)
+	return nil
+}
+
+func (r *memorySessionRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sessions []models.Session
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, exceptID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, session := range r.sessions {
+		if session.UserID == userID && id != exceptID {
+			delete(r.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,503 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryUserCreate(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	existing := &models.User{Email: "taken@example.com", MemberID: "GYM-2026-0000018"}
+	if err := s.Users.Create(ctx, existing); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if existing.ID.IsZero() {
+		t.Fatal("Create did not assign an ID")
+	}
+
+	tests := []struct {
+		name string
+		user models.User
+		want error
+	}{
+		{"new email", models.User{Email: "new@example.com"}, nil},
+		{"taken email", models.User{Email: "taken@example.com"}, ErrDuplicate},
+		{"taken member ID", models.User{Email: "other@example.com", MemberID: "GYM-2026-0000018"}, ErrDuplicate},
+		{"taken ID", models.User{ID: existing.ID, Email: "third@example.com"}, ErrDuplicate},
+		{"users without member ID", models.User{Email: "fourth@example.com"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			if err := s.Users.Create(ctx, &user); !errors.Is(err, tt.want) {
+				t.Fatalf("Create = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryUserLookups(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	user := &models.User{
+		Email:      "member@example.com",
+		MemberID:   "GYM-2026-0000018",
+		Identities: []models.ExternalIdentity{{Issuer: "https://id.example.com", Subject: "abc"}},
+	}
+	if err := s.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		lookup func() (*models.User, error)
+		want   error
+	}{
+		{"by ID", func() (*models.User, error) { return s.Users.GetByID(ctx, user.ID) }, nil},
+		{"by unknown ID", func() (*models.User, error) { return s.Users.GetByID(ctx, primitive.NewObjectID()) }, ErrNotFound},
+		{"by email", func() (*models.User, error) { return s.Users.GetByEmail(ctx, "member@example.com") }, nil},
+		{"by unknown email", func() (*models.User, error) { return s.Users.GetByEmail(ctx, "nobody@example.com") }, ErrNotFound},
+		{"by member ID", func() (*models.User, error) { return s.Users.GetByMemberID(ctx, "GYM-2026-0000018") }, nil},
+		{"by identity", func() (*models.User, error) { return s.Users.GetByIdentity(ctx, "https://id.example.com", "abc") }, nil},
+		{"by identity of other issuer", func() (*models.User, error) { return s.Users.GetByIdentity(ctx, "https://other.example.com", "abc") }, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.lookup()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if err == nil && got.ID != user.ID {
+				t.Fatalf("got user %s, want %s", got.ID.Hex(), user.ID.Hex())
+			}
+		})
+	}
+}
+
+func TestMemoryUserUpdate(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	first := &models.User{Email: "first@example.com"}
+	second := &models.User{Email: "second@example.com"}
+	for _, user := range []*models.User{first, second} {
+		if err := s.Users.Create(ctx, user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		user models.User
+		want error
+	}{
+		{"keeps own email", models.User{ID: first.ID, Email: "first@example.com", Name: "First"}, nil},
+		{"takes free email", models.User{ID: first.ID, Email: "renamed@example.com"}, nil},
+		{"takes other's email", models.User{ID: first.ID, Email: "second@example.com"}, ErrDuplicate},
+		{"unknown user", models.User{ID: primitive.NewObjectID(), Email: "ghost@example.com"}, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := tt.user
+			if err := s.Users.Update(ctx, &user); !errors.Is(err, tt.want) {
+				t.Fatalf("Update = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryUserRecordCheckIn(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	window := 30 * time.Minute
+
+	tests := []struct {
+		name       string
+		last       time.Time
+		want       error
+		wantVisits int
+	}{
+		{"first visit", time.Time{}, nil, 1},
+		{"outside window", now.Add(-time.Hour), nil, 1},
+		{"inside window", now.Add(-10 * time.Minute), ErrDuplicate, 0},
+		{"exactly one window ago", now.Add(-window), nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			user := &models.User{Email: "member@example.com", LastCheckIn: tt.last}
+			if err := s.Users.Create(ctx, user); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			updated, err := s.Users.RecordCheckIn(ctx, user.ID, now, window)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("RecordCheckIn = %v, want %v", err, tt.want)
+			}
+			stored, _ := s.Users.GetByID(ctx, user.ID)
+			if stored.TotalVisits != tt.wantVisits {
+				t.Fatalf("TotalVisits = %d, want %d", stored.TotalVisits, tt.wantVisits)
+			}
+			if err == nil && !updated.LastCheckIn.Equal(now) {
+				t.Fatalf("LastCheckIn = %v, want %v", updated.LastCheckIn, now)
+			}
+		})
+	}
+}
+
+func TestMemoryUserUpdateKeepsVisits(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+
+	saves := []struct {
+		name string
+		save func(s *Store, stale *models.User) error
+	}{
+		{"Update", func(s *Store, stale *models.User) error { return s.Users.Update(ctx, stale) }},
+		{"UpdateMembership", func(s *Store, stale *models.User) error {
+			return s.Users.UpdateMembership(ctx, stale, models.StatusActive)
+		}},
+	}
+	for _, tt := range saves {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			user := &models.User{Email: "member@example.com", MembershipStatus: models.StatusActive}
+			if err := s.Users.Create(ctx, user); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			stale, _ := s.Users.GetByID(ctx, user.ID)
+			if _, err := s.Users.RecordCheckIn(ctx, user.ID, now, time.Hour); err != nil {
+				t.Fatalf("RecordCheckIn: %v", err)
+			}
+
+			stale.Name = "Renamed"
+			if err := tt.save(s, stale); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			stored, _ := s.Users.GetByID(ctx, user.ID)
+			if stored.Name != "Renamed" || stored.TotalVisits != 1 || !stored.LastCheckIn.Equal(now) {
+				t.Fatalf("stored %q with %d visits last at %v, want the rename and the check-in kept", stored.Name, stored.TotalVisits, stored.LastCheckIn)
+			}
+		})
+	}
+}
+
+func TestMemoryUserRecordTOTPStep(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	user := &models.User{Email: "member@example.com", TwoFactor: models.TwoFactor{Enabled: true, Secret: "SECRET"}}
+	if err := s.Users.Create(ctx, user); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	steps := []struct {
+		step    int64
+		wantErr error
+	}{
+		{100, nil},
+		{100, ErrConflict},
+		{99, ErrConflict},
+		{101, nil},
+	}
+	for _, tt := range steps {
+		if err := s.Users.RecordTOTPStep(ctx, user.ID, tt.step); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("RecordTOTPStep(%d) = %v, want %v", tt.step, err, tt.wantErr)
+		}
+	}
+	stored, _ := s.Users.GetByID(ctx, user.ID)
+	if stored.TwoFactor.LastStep != 101 || stored.TwoFactor.Secret != "SECRET" {
+		t.Fatalf("stored two factor %+v, want step 101 and the secret kept", stored.TwoFactor)
+	}
+	if err := s.Users.RecordTOTPStep(ctx, primitive.NewObjectID(), 1); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RecordTOTPStep for a missing user = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryUserUpdateMembership(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		stored models.MembershipStatus
+		from   models.MembershipStatus
+		want   error
+	}{
+		{"matching status", models.StatusActive, models.StatusActive, nil},
+		{"status changed meanwhile", models.StatusExpired, models.StatusActive, ErrConflict},
+		{"unset status counts as none", "", models.StatusNone, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			user := &models.User{Email: "member@example.com", MembershipStatus: tt.stored}
+			if err := s.Users.Create(ctx, user); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			changed := *user
+			changed.MembershipStatus = models.StatusCancelled
+			if err := s.Users.UpdateMembership(ctx, &changed, tt.from); !errors.Is(err, tt.want) {
+				t.Fatalf("UpdateMembership = %v, want %v", err, tt.want)
+			}
+			stored, _ := s.Users.GetByID(ctx, user.ID)
+			wantStatus := tt.stored
+			if tt.want == nil {
+				wantStatus = models.StatusCancelled
+			}
+			if stored.MembershipStatus != wantStatus {
+				t.Fatalf("stored status = %q, want %q", stored.MembershipStatus, wantStatus)
+			}
+		})
+	}
+}
+
+func TestMemoryUserListings(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+
+	users := map[string]models.User{
+		"active lapsed":       {MembershipStatus: models.StatusActive, MembershipExpiry: now.Add(-time.Hour)},
+		"active current":      {MembershipStatus: models.StatusActive, MembershipExpiry: now.Add(24 * time.Hour)},
+		"renewing soon":       {MembershipStatus: models.StatusActive, MembershipExpiry: now.Add(time.Hour), AutoRenew: true},
+		"renewing expired":    {MembershipStatus: models.StatusExpired, MembershipExpiry: now.Add(-time.Hour), AutoRenew: true},
+		"renewing later":      {MembershipStatus: models.StatusActive, MembershipExpiry: now.Add(72 * time.Hour), AutoRenew: true},
+		"renewing cancelled":  {MembershipStatus: models.StatusCancelled, MembershipExpiry: now.Add(-time.Hour), AutoRenew: true},
+		"expired not renewed": {MembershipStatus: models.StatusExpired, MembershipExpiry: now.Add(-time.Hour)},
+	}
+	ids := make(map[primitive.ObjectID]string)
+	for name, user := range users {
+		user.Email = name + "@example.com"
+		if err := s.Users.Create(ctx, &user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids[user.ID] = name
+	}
+
+	tests := []struct {
+		name string
+		list func() ([]models.User, error)
+		want []string
+	}{
+		{"lapsed", func() ([]models.User, error) { return s.Users.ListLapsed(ctx, now) }, []string{"active lapsed"}},
+		{"auto-renewing within a day", func() ([]models.User, error) { return s.Users.ListAutoRenewing(ctx, now.Add(24*time.Hour)) },
+			[]string{"renewing expired", "renewing soon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.list()
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			found := make(map[string]bool)
+			for _, user := range got {
+				found[ids[user.ID]] = true
+			}
+			if len(found) != len(tt.want) {
+				t.Fatalf("got %v, want %v", found, tt.want)
+			}
+			for _, name := range tt.want {
+				if !found[name] {
+					t.Fatalf("got %v, want %v", found, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryPlanListActive(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	plans := []models.MembershipPlan{
+		{Name: "Premium", Price: 49.99, IsActive: true},
+		{Name: "Retired", Price: 9.99, IsActive: false},
+		{Name: "Basic", Price: 29.99, IsActive: true},
+	}
+	if err := s.MembershipPlans.CreateMany(ctx, plans); err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+
+	active, err := s.MembershipPlans.ListActive(ctx)
+	if err != nil {
+		t.Fatalf("ListActive: %v", err)
+	}
+	if len(active) != 2 || active[0].Name != "Basic" || active[1].Name != "Premium" {
+		t.Fatalf("ListActive = %+v, want Basic then Premium", active)
+	}
+
+	tests := []struct {
+		name string
+		id   primitive.ObjectID
+		want error
+	}{
+		{"active plan", plans[0].ID, nil},
+		{"retired plan", plans[1].ID, ErrNotFound},
+		{"unknown plan", primitive.NewObjectID(), ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.MembershipPlans.GetActiveByID(ctx, tt.id); !errors.Is(err, tt.want) {
+				t.Fatalf("GetActiveByID = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryPlanSync(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	stored := []models.MembershipPlan{
+		{Name: "Basic", Price: 9999, Duration: 1, IsActive: true, CreatedAt: created},
+		{Name: "Student", Price: 4999, Duration: 1, IsActive: true, CreatedAt: created},
+	}
+	if err := s.MembershipPlans.CreateMany(ctx, stored); err != nil {
+		t.Fatalf("CreateMany: %v", err)
+	}
+	basic, student := stored[0], stored[1]
+
+	catalogue := []models.MembershipPlan{
+		{Name: "Basic", Price: 13499, Duration: 1, IsActive: true, CreatedAt: time.Now()},
+		{Name: "Premium", Price: 22499, Duration: 1, IsActive: true, CreatedAt: time.Now()},
+	}
+	for range 2 {
+		if err := s.MembershipPlans.Sync(ctx, catalogue); err != nil {
+			t.Fatalf("Sync: %v", err)
+		}
+	}
+
+	updated, err := s.MembershipPlans.GetActiveByID(ctx, basic.ID)
+	if err != nil || updated.Price != 13499 || !updated.CreatedAt.Equal(created) {
+		t.Fatalf("Basic after sync = %+v, %v, want the new price under the same ID and creation time", updated, err)
+	}
+	retired, err := s.MembershipPlans.GetByID(ctx, student.ID)
+	if err != nil || retired.IsActive {
+		t.Fatalf("Student after sync = %+v, %v, want it kept but inactive", retired, err)
+	}
+	active, _ := s.MembershipPlans.ListActive(ctx)
+	if len(active) != 2 || active[0].ID != basic.ID || active[1].Name != "Premium" {
+		t.Fatalf("active plans %+v, want Basic and one Premium", active)
+	}
+}
+
+func TestMemoryFitnessProfileSave(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	userID := primitive.NewObjectID()
+	created := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	first := &models.FitnessProfile{UserID: userID, CreatedAt: created}
+	if err := s.FitnessProfiles.Save(ctx, first); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	second := &models.FitnessProfile{UserID: userID, CreatedAt: created.AddDate(0, 1, 0)}
+	if err := s.FitnessProfiles.Save(ctx, second); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	stored, err := s.FitnessProfiles.GetByUserID(ctx, userID)
+	if err != nil {
+		t.Fatalf("GetByUserID: %v", err)
+	}
+	if stored.ID != first.ID || !stored.CreatedAt.Equal(created) {
+		t.Fatalf("second save replaced the profile identity: got %s created %v", stored.ID.Hex(), stored.CreatedAt)
+	}
+	if _, err := s.FitnessProfiles.GetByUserID(ctx, primitive.NewObjectID()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetByUserID of unknown user = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMemoryActivityListRecentByUser(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	userID := primitive.NewObjectID()
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for day := 0; day < 5; day++ {
+		activity := &models.Activity{UserID: userID, Date: start.AddDate(0, 0, day)}
+		if err := s.Activities.Create(ctx, activity); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := s.Activities.Create(ctx, &models.Activity{UserID: primitive.NewObjectID(), Date: start}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{"limited", 3, 3},
+		{"unlimited", 0, 5},
+		{"limit above count", 10, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			activities, err := s.Activities.ListRecentByUser(ctx, userID, tt.limit)
+			if err != nil {
+				t.Fatalf("ListRecentByUser: %v", err)
+			}
+			if len(activities) != tt.want {
+				t.Fatalf("got %d activities, want %d", len(activities), tt.want)
+			}
+			if !activities[0].Date.Equal(start.AddDate(0, 0, 4)) {
+				t.Fatalf("newest activity is %v, want %v", activities[0].Date, start.AddDate(0, 0, 4))
+			}
+		})
+	}
+}
+
+func TestMemoryPasswordResetMarkUsed(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	now := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	if err := s.PasswordResets.Create(ctx, &models.PasswordResetToken{ID: "hash", UserID: primitive.NewObjectID()}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		want error
+	}{
+		{"first use", "hash", nil},
+		{"second use", "hash", ErrNotFound},
+		{"unknown token", "other", ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.PasswordResets.MarkUsed(ctx, tt.id, now); !errors.Is(err, tt.want) {
+				t.Fatalf("MarkUsed = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCounterNext(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+
+	tests := []struct {
+		counter string
+		want    int64
+	}{
+		{"invoices", 1},
+		{"invoices", 2},
+		{"member_ids", 1},
+		{"invoices", 3},
+	}
+	for _, tt := range tests {
+		got, err := s.Counters.Next(ctx, tt.counter)
+		if err != nil {
+			t.Fatalf("Next(%q): %v", tt.counter, err)
+		}
+		if got != tt.want {
+			t.Fatalf("Next(%q) = %d, want %d", tt.counter, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type memoryVisitRepository struct {
+	mu     sync.RWMutex
+	visits []models.Visit
+}
+
+func (r *memoryVisitRepository) Create(ctx context.Context, visit *models.Visit) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if visit.ID.IsZero() {
+		visit.ID = primitive.NewObjectID()
+	}
+	r.visits = append(r.visits, *visit)
+	return nil
+}
+
+func (r *memoryVisitRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, offset, limit int) ([]models.Visit, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching := []models.Visit{}
+	for _, visit := range r.visits {
+		if visit.UserID == userID {
+			matching = append(matching, visit)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].CheckedInAt.After(matching[j].CheckedInAt)
+	})
+
+	total := int64(len(matching))
+	if offset >= len(matching) {
+		return []models.Visit{}, total, nil
+	}
+	matching = matching[offset:]
+	if len(matching) > limit {
+		matching = matching[:limit]
+	}
+	return matching, total, nil
+}
+
+func (r *memoryVisitRepository) ListSince(ctx context.Context, location string, since time.Time) ([]models.Visit, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	matching := []models.Visit{}
+	for _, visit := range r.visits {
+		if !visit.CheckedInAt.Before(since) && (location == "" || visit.Location == location) {
+			matching = append(matching, visit)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].CheckedInAt.Before(matching[j].CheckedInAt)
+	})
+	return matching, nil
+}
+
+func (r *memoryVisitRepository) CheckOut(ctx context.Context, userID primitive.ObjectID, at time.Time) (*models.Visit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latest := -1
+	for i, visit := range r.visits {
+		if visit.UserID == userID && visit.IsOpen() && (latest < 0 || visit.CheckedInAt.After(r.visits[latest].CheckedInAt)) {
+			latest = i
+		}
+	}
+	if latest < 0 {
+		return nil, ErrNotFound
+	}
+	r.visits[latest].CheckedOutAt = &at
+	visit := r.visits[latest]
+	return &visit, nil
+}
+
+func (r *memoryVisitRepository) CloseStale(ctx context.Context, cutoff time.Time, stay time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var closed int64
+	for i := range r.visits {
+		visit := &r.visits[i]
+		if visit.IsOpen() && visit.CheckedInAt.Before(cutoff) {
+			checkedOut := visit.CheckedInAt.Add(stay)
+			visit.CheckedOutAt = &checkedOut
+			visit.AutoCheckedOut = true
+			closed++
+		}
+	}
+	return closed, nil
+}
+
+func (r *memoryVisitRepository) CountOpen(ctx context.Context) (map[string]int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, visit := range r.visits {
+		if visit.IsOpen() {
+			counts[visit.Location]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *memoryVisitRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.visits[:0]
+	for _, visit := range r.visits {
+		if visit.UserID != userID {
+			kept = append(kept, visit)
+		}
+	}
+	r.visits = kept
+	return nil
+}
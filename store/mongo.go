@@ -0,0 +1,385 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoStore builds a Store backed by the collections of db
+func NewMongoStore(db *mongo.Database) *Store {
+	return &Store{
+		Users:             &mongoUserRepository{collection: db.Collection("users")},
+		MembershipPlans:   &mongoPlanRepository{collection: db.Collection("membership_plans")},
+		FitnessProfiles:   &mongoFitnessProfileRepository{collection: db.Collection("fitness_profiles")},
+		Activities:        &mongoActivityRepository{collection: db.Collection("activities")},
+		Sessions:          &mongoSessionRepository{collection: db.Collection("sessions")},
+		PasswordResets:    &mongoPasswordResetRepository{collection: db.Collection("password_resets")},
+		LoginThrottles:    &mongoLoginThrottleRepository{collection: db.Collection("login_throttles")},
+		LoginAttempts:     &mongoLoginAttemptRepository{collection: db.Collection("login_attempts")},
+		APITokens:         &mongoAPITokenRepository{collection: db.Collection("api_tokens")},
+		Visits:            &mongoVisitRepository{collection: db.Collection("visits")},
+		Counters:          &mongoCounterRepository{collection: db.Collection("counters")},
+		Payments:          &mongoPaymentRepository{collection: db.Collection("payments")},
+		Invoices:          &mongoInvoiceRepository{collection: db.Collection("invoices")},
+		MembershipHistory: &mongoMembershipHistoryRepository{collection: db.Collection("membership_status_history")},
+	}
+}
+
+// translateError maps driver errors onto the store sentinel errors
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// Create relies on the unique email index from the migrations to reject duplicates
+func (r *mongoUserRepository) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, user)
+	return translateError(err)
+}
+
+func (r *mongoUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error) {
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}}}
+
+	var user models.User
+	if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) GetByMemberID(ctx context.Context, memberID string) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, bson.M{"member_id": memberID}).Decode(&user); err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+// RecordCheckIn only matches a user whose last check-in is outside window, so two desks
+// scanning the same card at once can't both count the visit
+func (r *mongoUserRepository) RecordCheckIn(ctx context.Context, id primitive.ObjectID, at time.Time, window time.Duration) (*models.User, error) {
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"last_check_in": nil},
+			bson.M{"last_check_in": bson.M{"$lte": at.Add(-window)}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{"last_check_in": at},
+		"$inc": bson.M{"total_visits": 1},
+	}
+
+	var user models.User
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// tell a missing user apart from one that checked in too recently
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrDuplicate
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) SetAutoRenew(ctx context.Context, id primitive.ObjectID, enabled bool, method string, at time.Time) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"auto_renew":     enabled,
+		"renewal_method": method,
+		"updated_at":     at,
+	}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) RecordTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error {
+	filter := bson.M{
+		"_id": id,
+		"$or": bson.A{
+			bson.M{"two_factor.last_step": nil},
+			bson.M{"two_factor.last_step": bson.M{"$lt": step}},
+		},
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"two_factor.last_step": step}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		// tell a missing user apart from a step that was already used
+		if _, err := r.GetByID(ctx, id); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+// userReplacement replaces a user document with user but keeps its stored visit fields, the
+// literal stops values starting with $ being read as field paths
+func userReplacement(user *models.User) bson.A {
+	return bson.A{bson.M{"$replaceWith": bson.M{"$mergeObjects": bson.A{
+		bson.M{"$literal": user},
+		bson.M{"last_check_in": "$last_check_in", "total_visits": "$total_visits"},
+	}}}}
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, user *models.User) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": user.ID}, userReplacement(user))
+	if err != nil {
+		return translateError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) UpdateMembership(ctx context.Context, user *models.User, from models.MembershipStatus) error {
+	filter := bson.M{"_id": user.ID, "membership_status": from}
+	if from == models.StatusNone {
+		// users created before statuses were tracked have none stored
+		filter["membership_status"] = bson.M{"$in": bson.A{from, "", nil}}
+	}
+	result, err := r.collection.UpdateOne(ctx, filter, userReplacement(user))
+	if err != nil {
+		return translateError(err)
+	}
+	if result.MatchedCount == 0 {
+		if _, err := r.GetByID(ctx, user.ID); err != nil {
+			return err
+		}
+		return ErrConflict
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) ListAutoRenewing(ctx context.Context, before time.Time) ([]models.User, error) {
+	return r.list(ctx, bson.M{
+		"auto_renew":        true,
+		"membership_status": bson.M{"$in": bson.A{models.StatusActive, models.StatusExpired}},
+		"membership_expiry": bson.M{"$lt": before},
+	})
+}
+
+func (r *mongoUserRepository) ListLapsed(ctx context.Context, now time.Time) ([]models.User, error) {
+	return r.list(ctx, bson.M{
+		"membership_status": models.StatusActive,
+		"membership_expiry": bson.M{"$lt": now},
+	})
+}
+
+func (r *mongoUserRepository) ListScheduledPlansDue(ctx context.Context, now time.Time) ([]models.User, error) {
+	return r.list(ctx, bson.M{
+		"scheduled_plan_start": bson.M{"$lte": now},
+	})
+}
+
+func (r *mongoUserRepository) list(ctx context.Context, filter bson.M) ([]models.User, error) {
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+type mongoPlanRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPlanRepository) ListActive(ctx context.Context) ([]models.MembershipPlan, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"is_active": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var plans []models.MembershipPlan
+	if err := cursor.All(ctx, &plans); err != nil {
+		return nil, err
+	}
+	return plans, nil
+}
+
+func (r *mongoPlanRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.MembershipPlan, error) {
+	var plan models.MembershipPlan
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&plan); err != nil {
+		return nil, translateError(err)
+	}
+	return &plan, nil
+}
+
+func (r *mongoPlanRepository) GetActiveByID(ctx context.Context, id primitive.ObjectID) (*models.MembershipPlan, error) {
+	var plan models.MembershipPlan
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "is_active": true}).Decode(&plan); err != nil {
+		return nil, translateError(err)
+	}
+	return &plan, nil
+}
+
+func (r *mongoPlanRepository) CreateMany(ctx context.Context, plans []models.MembershipPlan) error {
+	if len(plans) == 0 {
+		return nil
+	}
+	var documents []interface{}
+	for i := range plans {
+		if plans[i].ID.IsZero() {
+			plans[i].ID = primitive.NewObjectID()
+		}
+		documents = append(documents, plans[i])
+	}
+	_, err := r.collection.InsertMany(ctx, documents)
+	return translateError(err)
+}
+
+func (r *mongoPlanRepository) Sync(ctx context.Context, plans []models.MembershipPlan) error {
+	names := bson.A{}
+	for _, plan := range plans {
+		names = append(names, plan.Name)
+		_, err := r.collection.UpdateOne(ctx, bson.M{"name": plan.Name}, bson.M{
+			"$set": bson.M{
+				"description": plan.Description,
+				"price":       plan.Price,
+				"duration":    plan.Duration,
+				"features":    plan.Features,
+				"is_active":   plan.IsActive,
+				"updated_at":  plan.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"created_at": plan.CreatedAt},
+		}, options.Update().SetUpsert(true))
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"name": bson.M{"$nin": names}, "is_active": true},
+		bson.M{"$set": bson.M{"is_active": false, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+type mongoFitnessProfileRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoFitnessProfileRepository) GetByUserID(ctx context.Context, userID primitive.ObjectID) (*models.FitnessProfile, error) {
+	var profile models.FitnessProfile
+	if err := r.collection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&profile); err != nil {
+		return nil, translateError(err)
+	}
+	return &profile, nil
+}
+
+func (r *mongoFitnessProfileRepository) Save(ctx context.Context, profile *models.FitnessProfile) error {
+	existing, err := r.GetByUserID(ctx, profile.UserID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	if existing != nil {
+		profile.ID = existing.ID
+		profile.CreatedAt = existing.CreatedAt
+		_, err = r.collection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, profile)
+		return translateError(err)
+	}
+
+	if profile.ID.IsZero() {
+		profile.ID = primitive.NewObjectID()
+	}
+	_, err = r.collection.InsertOne(ctx, profile)
+	return translateError(err)
+}
+
+type mongoActivityRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoActivityRepository) Create(ctx context.Context, activity *models.Activity) error {
+	if activity.ID.IsZero() {
+		activity.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, activity)
+	return translateError(err)
+}
+
+func (r *mongoActivityRepository) ListRecentByUser(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.Activity, error) {
+	findOptions := options.Find().SetSort(bson.M{"date": -1})
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var activities []models.Activity
+	if err := cursor.All(ctx, &activities); err != nil {
+		return nil, err
+	}
+	return activities, nil
+}
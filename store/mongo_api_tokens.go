@@ -0,0 +1,67 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAPITokenRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAPITokenRepository) Create(ctx context.Context, token *models.APIToken) error {
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, token)
+	return translateError(err)
+}
+
+func (r *mongoAPITokenRepository) GetByHash(ctx context.Context, hash string) (*models.APIToken, error) {
+	var token models.APIToken
+	if err := r.collection.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&token); err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *mongoAPITokenRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIToken, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tokens []models.APIToken
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *mongoAPITokenRepository) Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": at}})
+	return err
+}
+
+func (r *mongoAPITokenRepository) Delete(ctx context.Context, userID, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAPITokenRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoCounterRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoCounterRepository) Next(ctx context.Context, name string) (int64, error) {
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": name},
+		bson.M{"$inc": bson.M{"value": int64(1)}},
+		opts,
+	).Decode(&counter)
+	if mongo.IsDuplicateKeyError(err) {
+		// two first uses raced to create the counter, it exists now so the retry only increments
+		err = r.collection.FindOneAndUpdate(ctx,
+			bson.M{"_id": name},
+			bson.M{"$inc": bson.M{"value": int64(1)}},
+			opts,
+		).Decode(&counter)
+	}
+	if err != nil {
+		return 0, translateError(err)
+	}
+	return counter.Value, nil
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoInvoiceRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoInvoiceRepository) Create(ctx context.Context, invoice *models.Invoice) error {
+	if invoice.ID.IsZero() {
+		invoice.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, invoice)
+	return translateError(err)
+}
+
+func (r *mongoInvoiceRepository) findOne(ctx context.Context, filter bson.M) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := r.collection.FindOne(ctx, filter).Decode(&invoice); err != nil {
+		return nil, translateError(err)
+	}
+	return &invoice, nil
+}
+
+func (r *mongoInvoiceRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoInvoiceRepository) GetByPayment(ctx context.Context, paymentID primitive.ObjectID) (*models.Invoice, error) {
+	return r.findOne(ctx, bson.M{"payment_id": paymentID})
+}
+
+func (r *mongoInvoiceRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Invoice, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "issued_at", Value: -1}})
+	return r.find(ctx, bson.M{"user_id": userID}, opts)
+}
+
+func (r *mongoInvoiceRepository) ListIssued(ctx context.Context, from, to time.Time) ([]models.Invoice, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "issued_at", Value: 1}})
+	return r.find(ctx, bson.M{"issued_at": bson.M{"$gte": from, "$lt": to}}, opts)
+}
+
+func (r *mongoInvoiceRepository) find(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Invoice, error) {
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	invoices := []models.Invoice{}
+	if err := cursor.All(ctx, &invoices); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
@@ -0,0 +1,111 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoLoginThrottleRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoLoginThrottleRepository) Get(ctx context.Context, key models.ThrottleKey) (*models.LoginThrottle, error) {
+	var throttle models.LoginThrottle
+	// the TTL monitor only runs once a minute, so expired counters are filtered out here too
+	filter := bson.M{"_id": key.ID(), "expires_at": bson.M{"$gt": time.Now()}}
+	if err := r.collection.FindOne(ctx, filter).Decode(&throttle); err != nil {
+		return nil, translateError(err)
+	}
+	return &throttle, nil
+}
+
+func (r *mongoLoginThrottleRepository) RecordFailure(ctx context.Context, key models.ThrottleKey, at, expiresAt time.Time) (*models.LoginThrottle, error) {
+	live := bson.D{{Key: "$gt", Value: bson.A{"$expires_at", at}}}
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.D{
+		{Key: "scope", Value: key.Scope},
+		{Key: "kind", Value: key.Kind},
+		{Key: "subject", Value: key.Subject},
+		{Key: "failures", Value: bson.D{{Key: "$cond", Value: bson.A{live, bson.D{{Key: "$add", Value: bson.A{"$failures", 1}}}, 1}}}},
+		{Key: "locked_until", Value: bson.D{{Key: "$cond", Value: bson.A{live, "$locked_until", "$$REMOVE"}}}},
+		{Key: "last_failure_at", Value: at},
+		{Key: "expires_at", Value: bson.D{{Key: "$cond", Value: bson.A{
+			bson.D{{Key: "$gt", Value: bson.A{"$locked_until", expiresAt}}}, "$locked_until", expiresAt,
+		}}}},
+	}}}}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var throttle models.LoginThrottle
+	if err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": key.ID()}, update, opts).Decode(&throttle); err != nil {
+		return nil, translateError(err)
+	}
+	return &throttle, nil
+}
+
+func (r *mongoLoginThrottleRepository) Lock(ctx context.Context, key models.ThrottleKey, until time.Time) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": key.ID()},
+		bson.M{"$set": bson.M{"locked_until": until}, "$max": bson.M{"expires_at": until}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoLoginThrottleRepository) Delete(ctx context.Context, key models.ThrottleKey) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": key.ID()})
+	return err
+}
+
+func (r *mongoLoginThrottleRepository) DeleteBySubject(ctx context.Context, kind models.ThrottleKind, subject string) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"kind": kind, "subject": subject})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type mongoLoginAttemptRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoLoginAttemptRepository) Create(ctx context.Context, attempt *models.LoginAttempt) error {
+	if attempt.ID.IsZero() {
+		attempt.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, attempt)
+	return translateError(err)
+}
+
+func (r *mongoLoginAttemptRepository) ListRecent(ctx context.Context, account string, limit int) ([]models.LoginAttempt, error) {
+	filter := bson.M{}
+	if account != "" {
+		filter["account"] = account
+	}
+
+	findOptions := options.Find().SetSort(bson.M{"created_at": -1})
+	if limit > 0 {
+		findOptions.SetLimit(int64(limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	attempts := []models.LoginAttempt{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
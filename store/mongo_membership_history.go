@@ -0,0 +1,43 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoMembershipHistoryRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoMembershipHistoryRepository) Create(ctx context.Context, change *models.MembershipStatusChange) error {
+	if change.ID.IsZero() {
+		change.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, change)
+	return translateError(err)
+}
+
+func (r *mongoMembershipHistoryRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.MembershipStatusChange, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	changes := []models.MembershipStatusChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (r *mongoMembershipHistoryRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
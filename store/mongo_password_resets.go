@@ -0,0 +1,47 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoPasswordResetRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPasswordResetRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	_, err := r.collection.InsertOne(ctx, token)
+	return translateError(err)
+}
+
+func (r *mongoPasswordResetRepository) Get(ctx context.Context, id string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&token); err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+func (r *mongoPasswordResetRepository) MarkUsed(ctx context.Context, id string, usedAt time.Time) error {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": usedAt}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoPasswordResetRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
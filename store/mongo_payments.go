@@ -0,0 +1,166 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoPaymentRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPaymentRepository) Create(ctx context.Context, payment *models.Payment) error {
+	if payment.ID.IsZero() {
+		payment.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, payment)
+	return translateError(err)
+}
+
+func (r *mongoPaymentRepository) findOne(ctx context.Context, filter bson.M) (*models.Payment, error) {
+	var payment models.Payment
+	if err := r.collection.FindOne(ctx, filter).Decode(&payment); err != nil {
+		return nil, translateError(err)
+	}
+	return &payment, nil
+}
+
+func (r *mongoPaymentRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoPaymentRepository) GetByIdempotencyKey(ctx context.Context, userID primitive.ObjectID, key string) (*models.Payment, error) {
+	return r.findOne(ctx, bson.M{"user_id": userID, "idempotency_key": key})
+}
+
+func (r *mongoPaymentRepository) GetByIntent(ctx context.Context, provider, intentID string) (*models.Payment, error) {
+	return r.findOne(ctx, bson.M{"provider": provider, "intent_id": intentID})
+}
+
+func (r *mongoPaymentRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Payment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	payments := []models.Payment{}
+	if err := cursor.All(ctx, &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (r *mongoPaymentRepository) SetIntent(ctx context.Context, id primitive.ObjectID, intentID string) error {
+	result, err := r.collection.UpdateByID(ctx, id, bson.M{"$set": bson.M{"intent_id": intentID, "updated_at": time.Now()}})
+	if err != nil {
+		return translateError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoPaymentRepository) Transition(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, status models.PaymentStatus, failureReason string) (bool, error) {
+	update := bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}}
+	if failureReason != "" {
+		update["$set"].(bson.M)["failure_reason"] = failureReason
+	} else {
+		update["$unset"] = bson.M{"failure_reason": ""}
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": bson.M{"$in": from}}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *mongoPaymentRepository) MarkApplied(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "applied_at": nil},
+		bson.M{"$set": bson.M{"applied_at": at, "updated_at": at}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *mongoPaymentRepository) UnmarkApplied(ctx context.Context, id primitive.ObjectID) error {
+	_, err := r.collection.UpdateByID(ctx, id, bson.M{"$unset": bson.M{"applied_at": ""}})
+	return err
+}
+
+func (r *mongoPaymentRepository) ClaimAttempt(ctx context.Context, id primitive.ObjectID, now, until time.Time) (bool, error) {
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{
+			"_id":    id,
+			"status": models.PaymentPending,
+			"$or": bson.A{
+				bson.M{"next_attempt_at": nil},
+				bson.M{"next_attempt_at": bson.M{"$lte": now}},
+			},
+		},
+		bson.M{"$set": bson.M{"next_attempt_at": until, "updated_at": now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *mongoPaymentRepository) RecordFailedAttempt(ctx context.Context, id primitive.ObjectID, next *time.Time, failureReason string) error {
+	set := bson.M{"failure_reason": failureReason, "updated_at": time.Now()}
+	update := bson.M{"$inc": bson.M{"attempts": 1}, "$set": set}
+	if next != nil {
+		set["next_attempt_at"] = *next
+	} else {
+		set["status"] = models.PaymentFailed
+		update["$unset"] = bson.M{"next_attempt_at": ""}
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "status": models.PaymentPending}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoPaymentRepository) AddRefund(ctx context.Context, id primitive.ObjectID, refund models.PaymentRefund) (*models.Payment, error) {
+	// a pipeline update so the status can be decided from the new total in the same write
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"refunds":         bson.M{"$concatArrays": bson.A{bson.M{"$ifNull": bson.A{"$refunds", bson.A{}}}, bson.M{"$literal": bson.A{refund}}}},
+			"refunded_amount": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$refunded_amount", 0}}, refund.Amount}},
+			"updated_at":      time.Now(),
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"status": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$refunded_amount", "$amount"}}, models.PaymentRefunded, "$status"}},
+		}}},
+	}
+	var payment models.Payment
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "refunds.id": bson.M{"$ne": refund.ID}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&payment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// already recorded, or the payment doesn't exist
+		return r.GetByID(ctx, id)
+	}
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &payment, nil
+}
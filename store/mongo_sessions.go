@@ -0,0 +1,59 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoSessionRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoSessionRepository) Save(ctx context.Context, session *models.Session) error {
+	_, err := r.collection.ReplaceOne(ctx, bson.M{"_id": session.ID}, session, options.Replace().SetUpsert(true))
+	return translateError(err)
+}
+
+func (r *mongoSessionRepository) Get(ctx context.Context, id string) (*models.Session, error) {
+	var session models.Session
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&session); err != nil {
+		return nil, translateError(err)
+	}
+	return &session, nil
+}
+
+func (r *mongoSessionRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (r *mongoSessionRepository) ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.M{"last_seen_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var sessions []models.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *mongoSessionRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID, exceptID string) (int64, error) {
+	filter := bson.M{"user_id": userID}
+	if exceptID != "" {
+		filter["_id"] = bson.M{"$ne": exceptID}
+	}
+	result, err := r.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoVisitRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoVisitRepository) Create(ctx context.Context, visit *models.Visit) error {
+	if visit.ID.IsZero() {
+		visit.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, visit)
+	return translateError(err)
+}
+
+func (r *mongoVisitRepository) ListByUser(ctx context.Context, userID primitive.ObjectID, offset, limit int) ([]models.Visit, int64, error) {
+	filter := bson.M{"user_id": userID}
+	total, err := r.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "checked_in_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(offset)).
+		SetLimit(int64(limit))
+	cursor, err := r.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	visits := []models.Visit{}
+	if err := cursor.All(ctx, &visits); err != nil {
+		return nil, 0, err
+	}
+	return visits, total, nil
+}
+
+func (r *mongoVisitRepository) ListSince(ctx context.Context, location string, since time.Time) ([]models.Visit, error) {
+	filter := bson.M{"checked_in_at": bson.M{"$gte": since}}
+	if location != "" {
+		filter["location"] = location
+	}
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "checked_in_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	visits := []models.Visit{}
+	if err := cursor.All(ctx, &visits); err != nil {
+		return nil, err
+	}
+	return visits, nil
+}
+
+func (r *mongoVisitRepository) CheckOut(ctx context.Context, userID primitive.ObjectID, at time.Time) (*models.Visit, error) {
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "checked_in_at", Value: -1}}).
+		SetReturnDocument(options.After)
+	var visit models.Visit
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "checked_out_at": nil},
+		bson.M{"$set": bson.M{"checked_out_at": at}},
+		opts,
+	).Decode(&visit)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &visit, nil
+}
+
+func (r *mongoVisitRepository) CloseStale(ctx context.Context, cutoff time.Time, stay time.Duration) (int64, error) {
+	// a pipeline update so every visit gets its own check-in time plus stay
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"checked_out_at":   bson.M{"$add": bson.A{"$checked_in_at", stay.Milliseconds()}},
+		"auto_checked_out": true,
+	}}}}
+	result, err := r.collection.UpdateMany(ctx, bson.M{"checked_out_at": nil, "checked_in_at": bson.M{"$lt": cutoff}}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoVisitRepository) CountOpen(ctx context.Context) (map[string]int, error) {
+	cursor, err := r.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"checked_out_at": nil}}},
+		{{Key: "$group", Value: bson.M{"_id": "$location", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var groups []struct {
+		Location string `bson:"_id"`
+		Count    int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(groups))
+	for _, group := range groups {
+		counts[group.Location] = group.Count
+	}
+	return counts, nil
+}
+
+func (r *mongoVisitRepository) DeleteByUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
@@ -0,0 +1,214 @@
+package store
+
+import (
+	"SSE/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotFound  = errors.New("store: document not found")
+	ErrDuplicate = errors.New("store: duplicate key")
+	// ErrConflict is returned by conditional writes when the document changed since it was read
+	ErrConflict = errors.New("store: document was changed concurrently")
+)
+
+// UserRepository persists gym members
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// GetByIdentity finds the user linked to the external account issuer/subject
+	GetByIdentity(ctx context.Context, issuer, subject string) (*models.User, error)
+	GetByMemberID(ctx context.Context, memberID string) (*models.User, error)
+	// Update replaces user except for LastCheckIn and TotalVisits, which only RecordCheckIn
+	// writes, so saving a copy read before a check-in doesn't lose the visit
+	Update(ctx context.Context, user *models.User) error
+	// RecordCheckIn atomically sets LastCheckIn to at and increments TotalVisits, returning the
+	// updated user. It returns ErrDuplicate if the previous check-in was less than window ago.
+	RecordCheckIn(ctx context.Context, id primitive.ObjectID, at time.Time, window time.Duration) (*models.User, error)
+	// SetAutoRenew sets only AutoRenew, RenewalMethod and UpdatedAt, leaving changes made to the
+	// rest of the user since it was read in place
+	SetAutoRenew(ctx context.Context, id primitive.ObjectID, enabled bool, method string, at time.Time) error
+	// RecordTOTPStep sets TwoFactor.LastStep to step only while the stored one is earlier, so a
+	// code can't be accepted twice by concurrent requests. It returns ErrConflict when it isn't.
+	RecordTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// UpdateMembership replaces user like Update, but only while the stored membership status is
+	// still from. It returns ErrConflict when it isn't.
+	UpdateMembership(ctx context.Context, user *models.User, from models.MembershipStatus) error
+	// ListAutoRenewing returns active and expired members with auto-renew on whose membership
+	// expires before before
+	ListAutoRenewing(ctx context.Context, before time.Time) ([]models.User, error)
+	// ListLapsed returns active members whose membership expired before now
+	ListLapsed(ctx context.Context, now time.Time) ([]models.User, error)
+	// ListScheduledPlansDue returns members whose renewed scheduled plan starts at or before now
+	ListScheduledPlansDue(ctx context.Context, now time.Time) ([]models.User, error)
+}
+
+// MembershipPlanRepository persists the membership plan catalogue
+type MembershipPlanRepository interface {
+	ListActive(ctx context.Context) ([]models.MembershipPlan, error)
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.MembershipPlan, error)
+	GetActiveByID(ctx context.Context, id primitive.ObjectID) (*models.MembershipPlan, error)
+	CreateMany(ctx context.Context, plans []models.MembershipPlan) error
+	// Sync updates the stored plans to plans matching them by name, so members and payments keep
+	// pointing at the plan they bought. Plans missing from plans are deactivated, never deleted.
+	Sync(ctx context.Context, plans []models.MembershipPlan) error
+}
+
+// FitnessProfileRepository persists one fitness profile per user
+type FitnessProfileRepository interface {
+	GetByUserID(ctx context.Context, userID primitive.ObjectID) (*models.FitnessProfile, error)
+	Save(ctx context.Context, profile *models.FitnessProfile) error
+}
+
+// ActivityRepository persists logged fitness activities
+type ActivityRepository interface {
+	Create(ctx context.Context, activity *models.Activity) error
+	ListRecentByUser(ctx context.Context, userID primitive.ObjectID, limit int) ([]models.Activity, error)
+}
+
+// SessionRepository persists server-side login sessions
+type SessionRepository interface {
+	Save(ctx context.Context, session *models.Session) error
+	Get(ctx context.Context, id string) (*models.Session, error)
+	Delete(ctx context.Context, id string) error
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error)
+	// DeleteByUser removes every session of userID except the one with exceptID
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID, exceptID string) (int64, error)
+}
+
+// PasswordResetRepository persists hashed password reset tokens
+type PasswordResetRepository interface {
+	Create(ctx context.Context, token *models.PasswordResetToken) error
+	Get(ctx context.Context, id string) (*models.PasswordResetToken, error)
+	// MarkUsed atomically consumes a token, returning ErrNotFound if it was already used
+	MarkUsed(ctx context.Context, id string, usedAt time.Time) error
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// LoginThrottleRepository persists counters of recent failed credential checks
+type LoginThrottleRepository interface {
+	// Get returns ErrNotFound once a counter has expired
+	Get(ctx context.Context, key models.ThrottleKey) (*models.LoginThrottle, error)
+	// RecordFailure atomically counts a failure at at, starting over if the counter had expired
+	RecordFailure(ctx context.Context, key models.ThrottleKey, at, expiresAt time.Time) (*models.LoginThrottle, error)
+	// Lock blocks the key until until, keeping the counter around at least that long
+	Lock(ctx context.Context, key models.ThrottleKey, until time.Time) error
+	Delete(ctx context.Context, key models.ThrottleKey) error
+	// DeleteBySubject clears the counters of subject in every scope
+	DeleteBySubject(ctx context.Context, kind models.ThrottleKind, subject string) (int64, error)
+}
+
+// LoginAttemptRepository persists the audit trail of failed logins
+type LoginAttemptRepository interface {
+	Create(ctx context.Context, attempt *models.LoginAttempt) error
+	// ListRecent returns the newest attempts first, for every account when account is ""
+	ListRecent(ctx context.Context, account string, limit int) ([]models.LoginAttempt, error)
+}
+
+// APITokenRepository persists hashed personal API tokens
+type APITokenRepository interface {
+	Create(ctx context.Context, token *models.APIToken) error
+	GetByHash(ctx context.Context, hash string) (*models.APIToken, error)
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.APIToken, error)
+	// Touch records a use of the token
+	Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// Delete removes the token id, returning ErrNotFound unless it belongs to userID
+	Delete(ctx context.Context, userID, id primitive.ObjectID) error
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// VisitRepository persists the check-in history
+type VisitRepository interface {
+	Create(ctx context.Context, visit *models.Visit) error
+	// ListByUser returns one page of userID's visits, newest first, and the total number of visits
+	ListByUser(ctx context.Context, userID primitive.ObjectID, offset, limit int) ([]models.Visit, int64, error)
+	// ListSince returns the visits checked in at or after since, at location or everywhere when it is ""
+	ListSince(ctx context.Context, location string, since time.Time) ([]models.Visit, error)
+	// CheckOut closes userID's latest open visit at at, returning ErrNotFound when there is none
+	CheckOut(ctx context.Context, userID primitive.ObjectID, at time.Time) (*models.Visit, error)
+	// CloseStale auto-checks-out every open visit checked in before cutoff, recording a stay of
+	// stay, and returns how many were closed
+	CloseStale(ctx context.Context, cutoff time.Time, stay time.Duration) (int64, error)
+	// CountOpen returns how many visits are open at each location
+	CountOpen(ctx context.Context) (map[string]int, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// PaymentRepository persists membership payments
+type PaymentRepository interface {
+	// Create returns ErrDuplicate when the user has already used payment.IdempotencyKey
+	Create(ctx context.Context, payment *models.Payment) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Payment, error)
+	GetByIdempotencyKey(ctx context.Context, userID primitive.ObjectID, key string) (*models.Payment, error)
+	GetByIntent(ctx context.Context, provider, intentID string) (*models.Payment, error)
+	// ListByUser returns userID's payments, newest first
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Payment, error)
+	SetIntent(ctx context.Context, id primitive.ObjectID, intentID string) error
+	// Transition moves the payment to status if it is currently in one of from, reporting whether it did
+	Transition(ctx context.Context, id primitive.ObjectID, from []models.PaymentStatus, status models.PaymentStatus, failureReason string) (bool, error)
+	// MarkApplied sets AppliedAt unless it is already set, reporting whether this call set it
+	MarkApplied(ctx context.Context, id primitive.ObjectID, at time.Time) (bool, error)
+	// UnmarkApplied clears AppliedAt after applying the payment failed, so it can be retried
+	UnmarkApplied(ctx context.Context, id primitive.ObjectID) error
+	// ClaimAttempt reserves a pending payment's next charge attempt until until, reporting whether
+	// it was due at now and nobody else holds it
+	ClaimAttempt(ctx context.Context, id primitive.ObjectID, now, until time.Time) (bool, error)
+	// RecordFailedAttempt counts a failed charge and schedules the next one at next, or marks the
+	// payment failed when next is nil
+	RecordFailedAttempt(ctx context.Context, id primitive.ObjectID, next *time.Time, failureReason string) error
+	// AddRefund records refund and marks the payment refunded once all of it is. Recording a
+	// refund ID a second time changes nothing, so retried refunds are counted once.
+	AddRefund(ctx context.Context, id primitive.ObjectID, refund models.PaymentRefund) (*models.Payment, error)
+}
+
+// InvoiceRepository persists the invoices issued for payments
+type InvoiceRepository interface {
+	// Create returns ErrDuplicate when the payment already has an invoice or the number is taken
+	Create(ctx context.Context, invoice *models.Invoice) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.Invoice, error)
+	GetByPayment(ctx context.Context, paymentID primitive.ObjectID) (*models.Invoice, error)
+	// ListByUser returns userID's invoices, newest first
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.Invoice, error)
+	// ListIssued returns the invoices issued in [from, to), oldest first
+	ListIssued(ctx context.Context, from, to time.Time) ([]models.Invoice, error)
+}
+
+// MembershipHistoryRepository records every change of members' membership status
+type MembershipHistoryRepository interface {
+	Create(ctx context.Context, change *models.MembershipStatusChange) error
+	// ListByUser returns userID's status changes, newest first
+	ListByUser(ctx context.Context, userID primitive.ObjectID) ([]models.MembershipStatusChange, error)
+	DeleteByUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// CounterRepository hands out sequence numbers
+type CounterRepository interface {
+	// Next atomically increments the counter called name and returns its new value, the first
+	// value of a counter is 1
+	Next(ctx context.Context, name string) (int64, error)
+}
+
+// Store groups every repository used by the handlers
+type Store struct {
+	Users           UserRepository
+	MembershipPlans MembershipPlanRepository
+	FitnessProfiles FitnessProfileRepository
+	Activities      ActivityRepository
+	Sessions        SessionRepository
+	PasswordResets  PasswordResetRepository
+	LoginThrottles  LoginThrottleRepository
+	LoginAttempts   LoginAttemptRepository
+	APITokens       APITokenRepository
+	Visits          VisitRepository
+	Counters        CounterRepository
+	Payments        PaymentRepository
+	Invoices        InvoiceRepository
+	// MembershipHistory is kept in the membership_status_history collection
+	MembershipHistory MembershipHistoryRepository
+}
@@ -0,0 +1,16 @@
+package web
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the host part of the request's remote address, or the whole address when it
+// has no port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
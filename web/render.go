@@ -0,0 +1,89 @@
+package web
+
+import (
+	"SSE/csrf"
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+)
+
+// csrfHead is added to every rendered page. It exposes the CSRF token and makes same-origin
+// fetch calls and POST forms send it, so templates don't need to handle it themselves.
+var csrfHead = template.Must(template.New("csrf").Parse(`<meta name="csrf-token" content="{{.}}">
+  <script>
+    (function() {
+      var token = {{.}};
+      var originalFetch = window.fetch;
+      window.fetch = function(input, init) {
+        init = init || {};
+        var method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+        var url = new URL(input instanceof Request ? input.url : input, window.location.href);
+        if (['GET', 'HEAD', 'OPTIONS'].indexOf(method) === -1 && url.origin === window.location.origin) {
+          var headers = new Headers(init.headers || {});
+          headers.set('X-CSRF-Token', token);
+          init.headers = headers;
+        }
+        return originalFetch.call(this, input, init);
+      };
+      document.addEventListener('submit', function(event) {
+        var form = event.target;
+        if (form.method.toLowerCase() !== 'post' || form.querySelector('input[name="csrf_token"]')) {
+          return;
+        }
+        var field = document.createElement('input');
+        field.type = 'hidden';
+        field.name = 'csrf_token';
+        field.value = token;
+        form.appendChild(field);
+      }, true);
+    })();
+  </script>
+`))
+
+// Render executes the template at path with data and writes it with the CSRF token injected
+func Render(w http.ResponseWriter, r *http.Request, path string, data interface{}) {
+	tmpl, err := template.ParseFiles(path)
+	if err != nil {
+		log.Printf("template parse error: %v", err)
+		http.Error(w, "Failed to load template", http.StatusInternalServerError)
+		return
+	}
+
+	var page bytes.Buffer
+	if err := tmpl.Execute(&page, data); err != nil {
+		log.Printf("template execute error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	token, err := csrf.Token(w, r)
+	if err != nil {
+		log.Printf("csrf token error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	var head bytes.Buffer
+	if err := csrfHead.Execute(&head, token); err != nil {
+		log.Printf("template execute error: %v", err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(injectHead(page.Bytes(), head.Bytes()))
+}
+
+// injectHead places snippet at the end of the page's <head>, or at the very start when it has none
+func injectHead(page, snippet []byte) []byte {
+	index := bytes.Index(page, []byte("</head>"))
+	if index < 0 {
+		return append(snippet, page...)
+	}
+
+	result := make([]byte, 0, len(page)+len(snippet))
+	result = append(result, page[:index]...)
+	result = append(result, snippet...)
+	return append(result, page[index:]...)
+}
@@ -11,10 +11,7 @@ func SetupTemplates() {
 	//http.HandleFunc("/", handlers.HomePage)
 
 	http.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./templates/register.html")
-	})
-	http.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./templates/login.html")
+		Render(w, r, "./templates/register.html", nil)
 	})
 
 }